@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
 
 	"time"
 
+	"github.com/Nucleussss/auth-service/internal/authz"
 	"github.com/Nucleussss/auth-service/internal/config"
 	"github.com/Nucleussss/auth-service/internal/db"
 	"github.com/Nucleussss/auth-service/internal/handlers"
 	"github.com/Nucleussss/auth-service/internal/middleware"
+	"github.com/Nucleussss/auth-service/internal/policy"
 	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/risk"
+	"github.com/Nucleussss/auth-service/internal/scheduler"
 	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/internal/utils"
 	"github.com/Nucleussss/auth-service/pkg/logger"
 	"github.com/gin-gonic/gin"
 )
@@ -32,25 +39,120 @@ func main() {
 	defer dbconn.Close()
 	log.Infof("Database connected successfully")
 
+	// Initialize password hasher
+	hasher, err := utils.NewPasswordHasher(utils.PasswordHashConfig{
+		Algorithm:         config.PasswordHashAlgorithm,
+		BcryptCost:        config.BcryptCost,
+		Argon2Memory:      uint32(config.Argon2Memory),
+		Argon2Iterations:  uint32(config.Argon2Iterations),
+		Argon2Parallelism: uint8(config.Argon2Parallelism),
+		ScryptLogN:        uint8(config.ScryptLogN),
+		ScryptR:           config.ScryptR,
+		ScryptP:           config.ScryptP,
+	})
+	if err != nil {
+		log.Fatalf("Error configuring password hasher: %v", err)
+		return
+	}
+	utils.SetPasswordHasher(hasher)
+
 	// Initialize user repository
 	userRepo := repositories.NewUserRepository(dbconn)
 
-	// Initialize auth service
-	authService := service.NewAuthService(userRepo, log)
+	// Initialize session repository
+	sessionRepo := repositories.NewSessionRepository(dbconn)
+
+	// Initialize password policy
+	passwordPolicy := &service.PasswordPolicy{
+		MinLength:     config.PasswordMinLength,
+		MaxLength:     config.PasswordMaxLength,
+		RequireUpper:  config.PasswordRequireUpper,
+		RequireLower:  config.PasswordRequireLower,
+		RequireDigit:  config.PasswordRequireDigit,
+		RequireSymbol: config.PasswordRequireSymbol,
+	}
+	if config.BreachedPasswordsDir != "" {
+		breached, err := service.LoadBreachedPasswordList(config.BreachedPasswordsDir)
+		if err != nil {
+			log.Fatalf("Error loading breached password list: %v", err)
+			return
+		}
+		passwordPolicy.Breached = breached
+		log.Infof("Using the breached password hashes in %s (%d range files)", config.BreachedPasswordsDir, breached.Ranges())
+	}
+
+	// Initialize password history
+	passwordHistory := &service.PasswordHistory{
+		Repo:   repositories.NewPasswordHistoryRepository(dbconn),
+		Size:   config.PasswordHistorySize,
+		MinAge: config.PasswordMinAge,
+	}
+
+	// Initialize session service
+	sessionService := service.NewSessionService(log, sessionRepo)
+
+	// Initialize transaction manager
+	txManager := repositories.NewTxManager(dbconn)
 
 	// Initialize password reset repository
 	passwordResetRepo := repositories.NewPasswordRepository(dbconn)
 
-	// Initialize email service
-	emailService := service.NewSmtpEmailService(
-		config.SMTPHost,
-		config.SMTPPort,
-		config.SMTPUser,
-		config.SMTPPass,
+	// Load email templates, with overrides from EMAIL_TEMPLATES_DIR if set
+	emailTemplates, err := service.NewEmailTemplates(config.EmailTemplatesDir)
+	if err != nil {
+		log.Fatalf("Error loading email templates: %v", err)
+		return
+	}
+
+	// Initialize email transport selected by EMAIL_BACKEND
+	emailTransport, err := service.NewEmailTransport(service.EmailTransportConfig{
+		Backend:                config.EmailBackend,
+		SMTPHost:               config.SMTPHost,
+		SMTPPort:               config.SMTPPort,
+		SMTPUsername:           config.SMTPUser,
+		SMTPPassword:           config.SMTPPass,
+		SMTPTLS:                config.SMTPTLS,
+		SMTPInsecureSkipVerify: config.SMTPInsecureSkipVerify,
+		MaildirPath:            config.EmailMaildirPath,
+		CaptureLimit:           config.EmailCaptureLimit,
+	})
+	if err != nil {
+		log.Fatalf("Error configuring email backend: %v", err)
+		return
+	}
+	log.Infof("Using %s email backend", config.EmailBackend)
+
+	// Initialize email sender used by the outbox dispatcher
+	emailSender := service.NewTemplateEmailService(
+		emailTransport,
 		config.SMTPFrom,
+		config.AppBaseURL,
+		config.PasswordResetURL,
+		config.InvitationURL,
+		emailTemplates,
 		log,
 	)
 
+	// Initialize email service. Emails are queued in the outbox and sent in the background.
+	// Tokens in queued emails are sealed, so reading the outbox does not give access to accounts.
+	emailOutboxRepo := repositories.NewEmailOutboxRepository(dbconn)
+	outboxSealer, err := utils.NewSealer(utils.DeriveKey(config.EmailOutboxKey, "email-outbox"))
+	if err != nil {
+		log.Fatalf("Error configuring email outbox: %v", err)
+		return
+	}
+	emailService := service.NewOutboxEmailService(emailOutboxRepo, outboxSealer)
+	emailDispatcher := &service.EmailDispatcher{
+		Repo:        emailOutboxRepo,
+		Sender:      emailSender,
+		Sealer:      outboxSealer,
+		Logger:      log,
+		BatchSize:   config.EmailDispatchBatchSize,
+		MaxAttempts: config.EmailMaxAttempts,
+		BaseBackoff: config.EmailRetryBaseDelay,
+		MaxBackoff:  config.EmailRetryMaxDelay,
+	}
+
 	// Parse token expiration duration
 	duration, err := time.ParseDuration(config.TokenExpiration)
 	if err != nil {
@@ -62,30 +164,462 @@ func main() {
 		log,
 		userRepo,
 		passwordResetRepo,
+		sessionRepo,
+		txManager,
+		emailService,
+		passwordPolicy,
+		passwordHistory,
+		duration,
+		config.InvitationTTL,
+	)
+
+	// Initialize known device repository
+	knownDeviceRepo := repositories.NewKnownDeviceRepository(dbconn)
+
+	// Initialize new-login alerts
+	var loginNotifier *service.LoginNotifier
+	loginAlertRepo := repositories.NewLoginAlertRepository(dbconn)
+	if config.LoginAlertsEnabled {
+		loginNotifier = &service.LoginNotifier{
+			Devices:   knownDeviceRepo,
+			Alerts:    loginAlertRepo,
+			Sessions:  sessionRepo,
+			Users:     userRepo,
+			TxManager: txManager,
+			Email:     emailService,
+			Resets:    passwordResetService,
+			Logger:    log,
+			AlertTTL:  config.LoginAlertTokenTTL,
+		}
+	}
+
+	// Initialize login risk scoring
+	loginAttemptRepo := repositories.NewLoginAttemptRepository(dbconn)
+	loginChallengeRepo := repositories.NewLoginChallengeRepository(dbconn)
+	loginRisk := &service.LoginRisk{
+		Attempts:   loginAttemptRepo,
+		Devices:    knownDeviceRepo,
+		Challenges: loginChallengeRepo,
+		TxManager:  txManager,
+		Email:      emailService,
+		Engine: &risk.Engine{
+			Rules:           risk.DefaultRules(),
+			StepUpThreshold: config.RiskStepUpThreshold,
+			BlockThreshold:  config.RiskBlockThreshold,
+		},
+		Logger:        log,
+		FailureWindow: config.RiskFailureWindow,
+		ChallengeTTL:  config.LoginChallengeTTL,
+	}
+	if config.GeoIPDatabaseFile != "" {
+		geoIP, err := risk.LoadGeoIPDatabase(config.GeoIPDatabaseFile)
+		if err != nil {
+			log.Fatalf("Error loading GeoIP database: %v", err)
+			return
+		}
+		loginRisk.GeoIP = geoIP
+		log.Infof("Loaded %d GeoIP ranges", geoIP.Len())
+	}
+
+	// Initialize organization repository
+	orgRepo := repositories.NewOrganizationRepository(dbconn)
+
+	// Initialize role repository
+	roleRepo := repositories.NewRoleRepository(dbconn)
+
+	// Initialize audit log repository
+	auditLogRepo := repositories.NewAuditLogRepository(dbconn)
+
+	// Initialize authenticator
+	var authenticator service.Authenticator
+	switch config.AuthBackend {
+	case "local":
+		authenticator = service.NewLocalAuthenticator(userRepo, log)
+	case "ldap":
+		authenticator, err = service.NewLDAPAuthenticator(service.LDAPConfig{
+			URL:            config.LDAPURL,
+			StartTLS:       config.LDAPStartTLS,
+			BindDN:         config.LDAPBindDN,
+			BindPassword:   config.LDAPBindPassword,
+			UserBaseDN:     config.LDAPUserBaseDN,
+			UserFilter:     config.LDAPUserFilter,
+			EmailAttribute: config.LDAPEmailAttribute,
+			NameAttribute:  config.LDAPNameAttribute,
+			GroupRoles:     config.LDAPGroupRoles,
+			Timeout:        config.LDAPTimeout,
+		}, userRepo, roleRepo, txManager, log)
+		if err != nil {
+			log.Fatalf("Error configuring LDAP authentication: %v", err)
+			return
+		}
+		log.Infof("Authenticating logins against %s", config.LDAPURL)
+	default:
+		log.Fatalf("Unknown AUTH_BACKEND %q", config.AuthBackend)
+		return
+	}
+
+	// Initialize auth service
+	authService := service.NewAuthService(
+		userRepo,
+		sessionRepo,
+		repositories.NewEmailVerificationRepository(dbconn),
+		orgRepo,
+		roleRepo,
+		auditLogRepo,
+		txManager,
+		emailService,
+		passwordPolicy,
+		loginNotifier,
+		loginRisk,
+		config.PasswordMaxAge,
+		duration,
+		config.ImpersonationTTL,
+		authenticator,
+		log,
+	)
+
+	// Initialize email change repository
+	emailChangeRepo := repositories.NewEmailChangeRepository(dbconn)
+
+	// Initialize account service
+	accountService := service.NewAccountService(
+		log,
+		userRepo,
+		emailChangeRepo,
+		passwordResetRepo,
+		sessionRepo,
+		txManager,
 		emailService,
+		passwordPolicy,
+		passwordHistory,
 		duration,
 	)
 
+	// Initialize organization service
+	orgService := service.NewOrganizationService(log, orgRepo, txManager)
+
+	// Initialize invitation service
+	invitationRepo := repositories.NewOrganizationInvitationRepository(dbconn)
+	invitationService := service.NewInvitationService(
+		log,
+		invitationRepo,
+		orgRepo,
+		userRepo,
+		txManager,
+		emailService,
+		authService,
+		config.InvitationTTL,
+	)
+
+	// Initialize group service
+	groupService := service.NewGroupService(
+		log,
+		repositories.NewGroupRepository(dbconn),
+		orgRepo,
+		roleRepo,
+		txManager,
+	)
+
+	// Initialize authz service
+	authzSchema := authz.DefaultSchema()
+	if config.AuthzSchemaFile != "" {
+		authzSchema, err = authz.LoadSchema(config.AuthzSchemaFile)
+		if err != nil {
+			log.Fatalf("Error loading authorization schema: %v", err)
+			return
+		}
+		log.Infof("Loaded authorization schema with %d object types", len(authzSchema.Types))
+	}
+	authzService := service.NewAuthzService(log, repositories.NewRelationTupleRepository(dbconn), authzSchema)
+
+	// Initialize SCIM service
+	scimService := service.NewSCIMService(
+		log,
+		userRepo,
+		roleRepo,
+		sessionRepo,
+		passwordResetRepo,
+		txManager,
+		passwordPolicy,
+		passwordHistory,
+		config.SCIMBaseURL,
+	)
+
+	// Initialize admin service
+	adminService := service.NewAdminService(
+		log,
+		userRepo,
+		sessionRepo,
+		roleRepo,
+		auditLogRepo,
+		txManager,
+		passwordResetService,
+		passwordPolicy,
+	)
+
+	// Initialize user import service
+	userImportService := service.NewUserImportService(
+		log,
+		userRepo,
+		roleRepo,
+		auditLogRepo,
+		txManager,
+		passwordResetService,
+	)
+
+	// Run the users subcommand instead of the server when asked to
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		if err := runUsersCommand(context.Background(), userImportService, os.Args[2:]); err != nil {
+			log.Errorf("users: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Initialize background jobs
+	jobs := scheduler.NewScheduler(dbconn, log)
+	jobs.Register(scheduler.DispatchEmailOutbox(emailDispatcher, config.EmailDispatchInterval))
+	jobs.Register(scheduler.PurgeExpiredPasswordResets(passwordResetRepo, config.ResetTokenCleanupInterval))
+	jobs.Register(scheduler.PurgeExpiredSessions(sessionRepo, config.SessionCleanupInterval))
+	jobs.Register(scheduler.PurgeExpiredLoginAlerts(loginAlertRepo, config.LoginAlertCleanupInterval))
+	jobs.Register(scheduler.PurgeExpiredInvitations(invitationRepo, config.InvitationCleanupInterval))
+	jobs.Register(scheduler.PurgeExpiredLoginChallenges(loginChallengeRepo, config.LoginChallengeCleanupInterval))
+	jobs.Register(scheduler.PurgeOldLoginAttempts(
+		loginAttemptRepo,
+		config.LoginAttemptCleanupInterval,
+		config.LoginAttemptRetention,
+	))
+	jobs.Register(scheduler.PurgeOldAuditLogs(
+		auditLogRepo,
+		config.AuditLogCleanupInterval,
+		config.AuditLogRetention,
+	))
+	jobs.Register(scheduler.PurgeStaleUnverifiedUsers(
+		userRepo,
+		config.UnverifiedUserCleanupInterval,
+		config.UnverifiedUserRetention,
+	))
+	if config.JobsEnabled {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		jobs.Start(ctx)
+	}
+
+	// Initialize the attribute-based policy engine, reloading the file when it changes
+	var policyEngine *policy.Engine
+	var policyLocation *time.Location
+	if config.PolicyFile != "" {
+		policyLocation, err = time.LoadLocation(config.PolicyTimezone)
+		if err != nil {
+			log.Fatalf("Error loading policy timezone: %v", err)
+			return
+		}
+		policyEngine, err = policy.NewEngine(config.PolicyFile, config.PolicyDryRun)
+		if err != nil {
+			log.Fatalf("Error loading policies: %v", err)
+			return
+		}
+		log.Infof("Loaded %d policies from %s (dry run: %t)", policyEngine.Len(), config.PolicyFile, config.PolicyDryRun)
+
+		if config.PolicyReloadInterval > 0 {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go policyEngine.Watch(ctx, config.PolicyReloadInterval, log)
+		}
+	}
+
 	// Initialize auth handler
 	authHandler := handlers.NewAuthHandler(authService, passwordResetService, log)
 
+	// Initialize session handler
+	sessionHandler := handlers.NewSessionHandler(sessionService, log)
+
+	// Initialize account handler
+	accountHandler := handlers.NewAccountHandler(accountService, log)
+
+	// Initialize admin handler
+	adminHandler := handlers.NewAdminHandler(adminService, userImportService, log)
+
+	// Initialize organization handler
+	orgHandler := handlers.NewOrganizationHandler(orgService, authService, log)
+
+	// Initialize invitation handler
+	invitationHandler := handlers.NewInvitationHandler(invitationService, log)
+
+	// Initialize group handler
+	groupHandler := handlers.NewGroupHandler(groupService, log)
+
+	// Initialize authz handler
+	authzHandler := handlers.NewAuthzHandler(authzService, log)
+
+	// Initialize SCIM handler
+	scimHandler := handlers.NewSCIMHandler(scimService, log)
+
+	// Initialize metrics handler
+	metricsHandler := handlers.NewMetricsHandler(jobs, log)
+
 	// Initialize gin router
 	router := gin.Default()
 
 	// Register routes
 	router.POST("/register", authHandler.Register)
 	router.POST("/login", authHandler.Login)
+	router.POST("/login/challenge", authHandler.VerifyLoginChallenge)
+	// the metrics tell about the jobs and data of the service, so they need a token too
+	if config.MetricsToken != "" {
+		router.GET("/metrics", middleware.MetricsAuth(config.MetricsToken, log), metricsHandler.Metrics)
+	}
 
 	//
 	router.POST("/request-password-reset", authHandler.RequestPasswordReset)
+	router.GET("/reset-password", authHandler.ResetPasswordPage)
 	router.POST("/reset-password", authHandler.ResetPassword)
+	// the links in emails open pages, which post back to act
+	router.GET("/verify-email", authHandler.VerifyEmailPage)
+	router.POST("/verify-email", authHandler.VerifyEmail)
+	router.GET("/confirm-email-change", accountHandler.ConfirmEmailChangePage)
+	router.POST("/confirm-email-change", accountHandler.ConfirmEmailChange)
+	router.GET("/report-login", authHandler.ReportLoginPage)
+	router.POST("/report-login", authHandler.ReportLogin)
+	router.GET("/accept-invitation", invitationHandler.AcceptInvitationPage)
+	router.POST("/accept-invitation", invitationHandler.AcceptInvitation)
+
+	// captured emails can be inspected when using the in-memory email backend
+	if capture, ok := emailTransport.(*service.CaptureTransport); ok {
+		emailCaptureHandler := handlers.NewEmailCaptureHandler(capture, log)
+		router.GET("/debug/emails", emailCaptureHandler.ListEmails)
+		router.GET("/debug/emails/latest", emailCaptureHandler.LatestEmail)
+		router.DELETE("/debug/emails", emailCaptureHandler.ClearEmails)
+	}
+
+	// SCIM provisioning, enabled by configuring a bearer token
+	if config.SCIMBearerToken != "" {
+		scimRoutes := router.Group("/scim/v2")
+		scimRoutes.Use(middleware.SCIMAuth(config.SCIMBearerToken, log))
+		{
+			scimRoutes.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+
+			scimRoutes.GET("/Users", scimHandler.ListUsers)
+			scimRoutes.POST("/Users", scimHandler.CreateUser)
+			scimRoutes.GET("/Users/:id", scimHandler.GetUser)
+			scimRoutes.PUT("/Users/:id", scimHandler.ReplaceUser)
+			scimRoutes.PATCH("/Users/:id", scimHandler.PatchUser)
+			scimRoutes.DELETE("/Users/:id", scimHandler.DeleteUser)
+
+			scimRoutes.GET("/Groups", scimHandler.ListGroups)
+			scimRoutes.POST("/Groups", scimHandler.CreateGroup)
+			scimRoutes.GET("/Groups/:id", scimHandler.GetGroup)
+			scimRoutes.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+			scimRoutes.PATCH("/Groups/:id", scimHandler.PatchGroup)
+			scimRoutes.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+		}
+	}
 
 	// protected API group
 	api := router.Group("/api")
-	api.Use(middleware.JWTMiddleware(config.JWTSecret, log))
+	api.Use(middleware.JWTMiddleware(config.JWTSecret, sessionRepo, log))
+	if policyEngine != nil {
+		api.Use(middleware.EnforcePolicies(policyEngine, userRepo, roleRepo, policyLocation, log))
+	}
 	{
+		// admins impersonating a user may not change their credentials or act as admins
+		notImpersonating := middleware.DenyImpersonation(log)
+
 		api.GET("/profile", authHandler.Profile)
+		api.PATCH("/profile", accountHandler.UpdateProfile)
+		api.POST("/profile/email", notImpersonating, accountHandler.RequestEmailChange)
+		api.DELETE("/account", notImpersonating, accountHandler.DeleteAccount)
+
+		api.GET("/sessions", sessionHandler.ListSessions)
+		api.DELETE("/sessions/:id", sessionHandler.RevokeSession)
+
+		api.GET("/orgs", orgHandler.ListOrganizations)
+		api.POST("/orgs", orgHandler.CreateOrganization)
+		api.POST("/orgs/:id/switch", notImpersonating, orgHandler.SwitchOrganization)
+
+		api.POST("/impersonation/stop", authHandler.StopImpersonation)
+
+		// routes acting on the organization of the token
+		org := api.Group("/org")
+		{
+			org.GET("/members", middleware.RequirePermission(roleRepo, "org:members:read", log), orgHandler.ListMembers)
+
+			invitations := org.Group("/invitations")
+			invitations.Use(middleware.RequirePermission(roleRepo, "org:manage", log))
+			{
+				invitations.GET("", invitationHandler.ListInvitations)
+				invitations.POST("", invitationHandler.Invite)
+				invitations.POST("/:id/resend", invitationHandler.ResendInvitation)
+				invitations.DELETE("/:id", invitationHandler.RevokeInvitation)
+			}
+
+			groups := org.Group("/groups")
+			groups.Use(middleware.RequirePermission(roleRepo, "org:manage", log))
+			{
+				groups.GET("", groupHandler.ListGroups)
+				groups.POST("", groupHandler.CreateGroup)
+				groups.GET("/:id", groupHandler.GetGroup)
+				groups.PATCH("/:id", groupHandler.UpdateGroup)
+				groups.DELETE("/:id", groupHandler.DeleteGroup)
+				groups.GET("/:id/members", groupHandler.ListGroupMembers)
+				groups.PUT("/:id/members/:user_id", groupHandler.AddGroupMember)
+				groups.DELETE("/:id/members/:user_id", groupHandler.RemoveGroupMember)
+				groups.PUT("/:id/subgroups/:child_id", groupHandler.AddSubgroup)
+				groups.DELETE("/:id/subgroups/:child_id", groupHandler.RemoveSubgroup)
+				groups.PUT("/:id/roles/:role", groupHandler.AssignGroupRole)
+				groups.DELETE("/:id/roles/:role", groupHandler.UnassignGroupRole)
+			}
+
+			org.GET("/users/:id/permissions",
+				middleware.RequirePermission(roleRepo, "org:manage", log),
+				groupHandler.EffectivePermissions,
+			)
+		}
+
+		// relationship-based authorization within the organization of the token
+		authzRoutes := api.Group("/authz")
+		{
+			checkPermission := middleware.RequirePermission(roleRepo, "authz:check", log)
+			managePermission := middleware.RequirePermission(roleRepo, "authz:manage", log)
+
+			authzRoutes.POST("/check", checkPermission, authzHandler.Check)
+			authzRoutes.POST("/expand", checkPermission, authzHandler.Expand)
+			authzRoutes.POST("/list-objects", checkPermission, authzHandler.ListObjects)
+			authzRoutes.POST("/tuples", managePermission, authzHandler.WriteTuples)
+			authzRoutes.DELETE("/tuples", managePermission, authzHandler.DeleteTuples)
+		}
+
+		// admin routes
+		admin := api.Group("/admin")
+		admin.Use(notImpersonating, middleware.RequirePermission(roleRepo, "users:manage", log))
+		{
+			admin.POST("/users/force-password-change", adminHandler.ForcePasswordChange)
+			admin.GET("/users", adminHandler.ListUsers)
+			admin.POST("/users", adminHandler.CreateUser)
+			admin.POST("/users/import", adminHandler.ImportUsers)
+			admin.GET("/users/export", adminHandler.ExportUsers)
+			admin.GET("/users/:id", adminHandler.GetUser)
+			admin.DELETE("/users/:id", adminHandler.DeleteUser)
+			admin.POST("/users/:id/disable", adminHandler.DisableUser)
+			admin.POST("/users/:id/enable", adminHandler.EnableUser)
+			admin.POST("/users/:id/reset-password", adminHandler.ForcePasswordReset)
+			admin.POST("/users/:id/impersonate",
+				middleware.RequirePermission(roleRepo, "users:impersonate", log),
+				authHandler.Impersonate,
+			)
+		}
+	}
+
+	// change-password also accepts tokens restricted to changing the password. It is outside the
+	// api group for that, so the policies are enforced on it separately.
+	changePassword := []gin.HandlerFunc{
+		middleware.JWTMiddleware(config.JWTSecret, sessionRepo, log, utils.ScopePasswordChange),
+		middleware.DenyImpersonation(log),
+	}
+	if policyEngine != nil {
+		changePassword = append(changePassword, middleware.EnforcePolicies(policyEngine, userRepo, roleRepo, policyLocation, log))
 	}
+	router.POST("/api/change-password", append(changePassword, accountHandler.ChangePassword)...)
 
 	// Start the server
 	addr := fmt.Sprintf(":%s", config.ServerPort)
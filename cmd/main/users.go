@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/google/uuid"
+)
+
+const usersUsage = `usage:
+  users import [-format csv|json] [-dry-run] [-invite] FILE
+  users export [-format csv|json] [-password-hashes] -o FILE`
+
+// runUsersCommand runs the users subcommand, which imports and exports users from the command
+// line. Its entries in the audit log have no actor.
+func runUsersCommand(ctx context.Context, userImportService service.UserImportService, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usersUsage)
+	}
+
+	switch args[0] {
+	case "import":
+		return importUsers(ctx, userImportService, args[1:])
+	case "export":
+		return exportUsers(ctx, userImportService, args[1:])
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], usersUsage)
+}
+
+func importUsers(ctx context.Context, userImportService service.UserImportService, args []string) error {
+	flags := flag.NewFlagSet("users import", flag.ContinueOnError)
+	format := flags.String("format", "", "format of the file, csv or json; defaults to the file extension")
+	dryRun := flags.Bool("dry-run", false, "only validate the users")
+	invite := flags.Bool("invite", false, "email users without a password hash a link to set their password")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(usersUsage)
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users, err := service.DecodeUsers(file, *format)
+	if err != nil {
+		return err
+	}
+
+	result, err := userImportService.Import(ctx, uuid.Nil, users, models.ImportOptions{DryRun: *dryRun, Invite: *invite})
+	if err != nil {
+		return err
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	if err := out.Encode(result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d of %d users rejected, nothing imported", len(result.Errors), result.Total)
+	}
+	return nil
+}
+
+func exportUsers(ctx context.Context, userImportService service.UserImportService, args []string) error {
+	flags := flag.NewFlagSet("users export", flag.ContinueOnError)
+	format := flags.String("format", "", "format of the file, csv or json; defaults to the file extension")
+	withPasswordHashes := flags.Bool("password-hashes", false, "include the password hashes")
+	// a file rather than standard output, so password hashes do not end up in terminals and pipes
+	path := flags.String("o", "", "file to write the users to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" || flags.NArg() != 0 {
+		return errors.New(usersUsage)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*path)), ".")
+	}
+	if *format != service.UserFileCSV && *format != service.UserFileJSON {
+		return service.ErrUnsupportedFormat
+	}
+
+	// password hashes must not be readable by other users of the machine
+	file, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := userImportService.Export(ctx, uuid.Nil, file, *format, *withPasswordHashes); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,330 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrMaxDepth = errors.New("authorization check exceeded the maximum depth")
+
+// defaultMaxDepth is how many relations a check follows when Checker.MaxDepth is not set.
+const defaultMaxDepth = 25
+
+// Checker evaluates relations on top of the tuples in Store, applying the rewrites of Schema.
+// Cycles among relations are cut, so they never loop; an exclusion whose subtracted relation leads
+// back into the cycle may grant more than intended, so schemas should keep exclusions out of cycles.
+type Checker struct {
+	Store  Store
+	Schema *Schema
+	// MaxDepth bounds how many relations a check may follow. Zero uses 25.
+	MaxDepth int
+}
+
+// Check reports whether subject holds relation on object, directly or through a rewrite.
+func (c *Checker) Check(ctx context.Context, object Object, relation string, subject Subject) (bool, error) {
+	if _, err := c.Schema.Rewrite(object.Type, relation); err != nil {
+		return false, err
+	}
+	return c.newEvaluation(ctx, subject).check(object, relation, 0)
+}
+
+// ListObjects returns the IDs of the objects of a type on which subject holds relation. Candidates
+// are the objects of the type that appear in any tuple.
+func (c *Checker) ListObjects(ctx context.Context, objectType, relation string, subject Subject) ([]string, error) {
+	if _, err := c.Schema.Rewrite(objectType, relation); err != nil {
+		return nil, err
+	}
+
+	ids, err := c.Store.ObjectIDs(ctx, objectType)
+	if err != nil {
+		return nil, err
+	}
+
+	// one evaluation for every candidate, so relations shared between them are only resolved once
+	e := c.newEvaluation(ctx, subject)
+	objects := []string{}
+	for _, id := range ids {
+		ok, err := e.check(Object{Type: objectType, ID: id}, relation, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			objects = append(objects, id)
+		}
+	}
+	return objects, nil
+}
+
+func (c *Checker) maxDepth() int {
+	if c.MaxDepth > 0 {
+		return c.MaxDepth
+	}
+	return defaultMaxDepth
+}
+
+// evaluation is the state of checking relations for one subject.
+type evaluation struct {
+	c       *Checker
+	ctx     context.Context
+	subject Subject
+	// memo holds the result of every object#relation resolved so far
+	memo map[string]bool
+	// visiting holds the object#relation pairs being resolved, to cut cycles
+	visiting map[string]bool
+	// cuts counts the cycles cut so far. Results that depended on a cut are not memoized.
+	cuts int
+}
+
+func (c *Checker) newEvaluation(ctx context.Context, subject Subject) *evaluation {
+	return &evaluation{
+		c:        c,
+		ctx:      ctx,
+		subject:  subject,
+		memo:     make(map[string]bool),
+		visiting: make(map[string]bool),
+	}
+}
+
+func (e *evaluation) check(object Object, relation string, depth int) (bool, error) {
+	// a userset subject holds the relation it stands for
+	if e.subject.IsUserset() && e.subject.Object == object && e.subject.Relation == relation {
+		return true, nil
+	}
+
+	key := object.String() + "#" + relation
+	if result, ok := e.memo[key]; ok {
+		return result, nil
+	}
+	if e.visiting[key] {
+		e.cuts++
+		return false, nil
+	}
+	if depth > e.c.maxDepth() {
+		return false, ErrMaxDepth
+	}
+
+	rewrite, err := e.c.Schema.Rewrite(object.Type, relation)
+	if errors.Is(err, ErrUnknownRelation) {
+		// tuples may point at relations the schema does not define, which grant nothing
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cuts := e.cuts
+	e.visiting[key] = true
+	result, err := e.eval(rewrite, object, relation, depth)
+	delete(e.visiting, key)
+	if err != nil {
+		return false, err
+	}
+
+	if result || e.cuts == cuts {
+		e.memo[key] = result
+	}
+	return result, nil
+}
+
+func (e *evaluation) eval(r *Rewrite, object Object, relation string, depth int) (bool, error) {
+	switch {
+	case r.This:
+		subjects, err := e.c.Store.Read(e.ctx, object, relation)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range subjects {
+			if s == e.subject {
+				return true, nil
+			}
+			if s.IsUserset() {
+				ok, err := e.check(s.Object, s.Relation, depth+1)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+		}
+		return false, nil
+
+	case r.ComputedUserset != "":
+		return e.check(object, r.ComputedUserset, depth+1)
+
+	case r.TupleToUserset != nil:
+		subjects, err := e.c.Store.Read(e.ctx, object, r.TupleToUserset.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range subjects {
+			ok, err := e.check(s.Object, r.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case len(r.Union) > 0:
+		for _, child := range r.Union {
+			ok, err := e.eval(child, object, relation, depth)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case len(r.Intersection) > 0:
+		for _, child := range r.Intersection {
+			ok, err := e.eval(child, object, relation, depth)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case r.Exclusion != nil:
+		ok, err := e.eval(r.Exclusion.Base, object, relation, depth)
+		if err != nil || !ok {
+			return false, err
+		}
+		excluded, err := e.eval(r.Exclusion.Subtract, object, relation, depth)
+		if err != nil {
+			return false, err
+		}
+		return !excluded, nil
+	}
+
+	return false, fmt.Errorf("empty rewrite for %s#%s", object, relation)
+}
+
+// Kinds of expansion nodes.
+const (
+	NodeUserset      = "userset"
+	NodeThis         = "this"
+	NodeUnion        = "union"
+	NodeIntersection = "intersection"
+	NodeExclusion    = "exclusion"
+)
+
+// Node is a node of the tree returned by Expand. Userset nodes stand for the holders of Relation on
+// Object and have the expansion of its rewrite as their only child. This nodes list the subjects of
+// stored tuples, with the usersets among them expanded as children. Union, intersection and exclusion
+// nodes combine their children; the second child of an exclusion is subtracted from the first.
+type Node struct {
+	Kind     string    `json:"kind"`
+	Object   string    `json:"object,omitempty"`
+	Relation string    `json:"relation,omitempty"`
+	Subjects []Subject `json:"subjects,omitempty"`
+	Children []*Node   `json:"children,omitempty"`
+	// Cycle marks a userset already being expanded further up the tree. It is not expanded again.
+	Cycle bool `json:"cycle,omitempty"`
+}
+
+// Expand returns the tree of everyone holding relation on object and how they come to hold it.
+func (c *Checker) Expand(ctx context.Context, object Object, relation string) (*Node, error) {
+	if _, err := c.Schema.Rewrite(object.Type, relation); err != nil {
+		return nil, err
+	}
+	x := &expansion{c: c, ctx: ctx, visiting: make(map[string]bool)}
+	return x.userset(object, relation, 0)
+}
+
+// expansion is the state of one Expand call.
+type expansion struct {
+	c        *Checker
+	ctx      context.Context
+	visiting map[string]bool
+}
+
+func (x *expansion) userset(object Object, relation string, depth int) (*Node, error) {
+	node := &Node{Kind: NodeUserset, Object: object.String(), Relation: relation}
+
+	key := object.String() + "#" + relation
+	if x.visiting[key] {
+		node.Cycle = true
+		return node, nil
+	}
+	if depth > x.c.maxDepth() {
+		return nil, ErrMaxDepth
+	}
+
+	rewrite, err := x.c.Schema.Rewrite(object.Type, relation)
+	if errors.Is(err, ErrUnknownRelation) {
+		return node, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	x.visiting[key] = true
+	child, err := x.rewrite(rewrite, object, relation, depth)
+	delete(x.visiting, key)
+	if err != nil {
+		return nil, err
+	}
+
+	node.Children = []*Node{child}
+	return node, nil
+}
+
+func (x *expansion) rewrite(r *Rewrite, object Object, relation string, depth int) (*Node, error) {
+	switch {
+	case r.This:
+		subjects, err := x.c.Store.Read(x.ctx, object, relation)
+		if err != nil {
+			return nil, err
+		}
+		node := &Node{Kind: NodeThis, Object: object.String(), Relation: relation, Subjects: subjects}
+		for _, s := range subjects {
+			if !s.IsUserset() {
+				continue
+			}
+			child, err := x.userset(s.Object, s.Relation, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+
+	case r.ComputedUserset != "":
+		return x.userset(object, r.ComputedUserset, depth+1)
+
+	case r.TupleToUserset != nil:
+		subjects, err := x.c.Store.Read(x.ctx, object, r.TupleToUserset.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		node := &Node{Kind: NodeUnion}
+		for _, s := range subjects {
+			child, err := x.userset(s.Object, r.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+
+	case len(r.Union) > 0:
+		return x.combine(NodeUnion, r.Union, object, relation, depth)
+
+	case len(r.Intersection) > 0:
+		return x.combine(NodeIntersection, r.Intersection, object, relation, depth)
+
+	case r.Exclusion != nil:
+		return x.combine(NodeExclusion, []*Rewrite{r.Exclusion.Base, r.Exclusion.Subtract}, object, relation, depth)
+	}
+
+	return nil, fmt.Errorf("empty rewrite for %s#%s", object, relation)
+}
+
+func (x *expansion) combine(kind string, rewrites []*Rewrite, object Object, relation string, depth int) (*Node, error) {
+	node := &Node{Kind: kind}
+	for _, r := range rewrites {
+		child, err := x.rewrite(r, object, relation, depth)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
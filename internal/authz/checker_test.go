@@ -0,0 +1,250 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// testSchema models documents in nested folders. Owners edit, editors view, viewers of a parent
+// folder view what is inside it, and banned viewers may not comment.
+func testSchema() *Schema {
+	viewer := Union(This(), Computed("editor"), FromTupleset("parent", "viewer"))
+	return &Schema{Types: map[string]map[string]*Rewrite{
+		"group": {
+			"member": This(),
+		},
+		"folder": {
+			"parent": This(),
+			"owner":  This(),
+			"editor": Union(This(), Computed("owner")),
+			"viewer": viewer,
+		},
+		"document": {
+			"parent":    This(),
+			"owner":     This(),
+			"editor":    Union(This(), Computed("owner")),
+			"viewer":    viewer,
+			"banned":    This(),
+			"commenter": Exclude(Computed("viewer"), Computed("banned")),
+		},
+	}}
+}
+
+func mustTuples(t *testing.T, tuples ...string) []Tuple {
+	t.Helper()
+	parsed := make([]Tuple, len(tuples))
+	for i, s := range tuples {
+		tuple, err := ParseTuple(s)
+		if err != nil {
+			t.Fatalf("ParseTuple(%q): %v", s, err)
+		}
+		parsed[i] = tuple
+	}
+	return parsed
+}
+
+func newTestChecker(t *testing.T, tuples ...string) *Checker {
+	t.Helper()
+	schema := testSchema()
+	if err := schema.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return &Checker{Store: NewMemoryStore(mustTuples(t, tuples...)...), Schema: schema}
+}
+
+func user(id string) Subject {
+	return Subject{Object: Object{Type: "user", ID: id}}
+}
+
+var documentTuples = []string{
+	"document:plan#owner@user:alice",
+	"document:plan#editor@user:bob",
+	"document:plan#parent@folder:projects",
+	"folder:projects#parent@folder:root",
+	"folder:projects#viewer@user:carol",
+	"folder:root#owner@user:dave",
+	"document:plan#viewer@group:eng#member",
+	"group:eng#member@user:erin",
+	"document:plan#banned@user:erin",
+	"document:notes#owner@user:bob",
+}
+
+func TestCheck(t *testing.T) {
+	c := newTestChecker(t, documentTuples...)
+	plan := Object{Type: "document", ID: "plan"}
+
+	tests := []struct {
+		name     string
+		relation string
+		subject  Subject
+		want     bool
+	}{
+		{"stored tuple", "owner", user("alice"), true},
+		{"owner is editor", "editor", user("alice"), true},
+		{"owner is viewer through editor", "viewer", user("alice"), true},
+		{"editor is not owner", "owner", user("bob"), false},
+		{"viewer of parent folder", "viewer", user("carol"), true},
+		{"viewer of parent folder is not editor", "editor", user("carol"), false},
+		{"owner of grandparent folder", "viewer", user("dave"), true},
+		{"member of userset", "viewer", user("erin"), true},
+		{"userset subject itself", "viewer", Subject{Object: Object{Type: "group", ID: "eng"}, Relation: "member"}, true},
+		{"stranger", "viewer", user("mallory"), false},
+		{"exclusion keeps viewers", "commenter", user("carol"), true},
+		{"exclusion removes banned viewers", "commenter", user("erin"), false},
+		{"exclusion needs the base", "commenter", user("mallory"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Check(context.Background(), plan, tt.relation, tt.subject)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Check(%s#%s@%s) = %t, want %t", plan, tt.relation, tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUnknownRelation(t *testing.T) {
+	c := newTestChecker(t, documentTuples...)
+
+	_, err := c.Check(context.Background(), Object{Type: "document", ID: "plan"}, "approver", user("alice"))
+	if !errors.Is(err, ErrUnknownRelation) {
+		t.Errorf("err = %v, want ErrUnknownRelation", err)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	c := newTestChecker(t, documentTuples...)
+
+	tests := []struct {
+		relation string
+		subject  Subject
+		want     []string
+	}{
+		{"owner", user("bob"), []string{"notes"}},
+		{"editor", user("bob"), []string{"notes", "plan"}},
+		{"viewer", user("carol"), []string{"plan"}},
+		{"commenter", user("erin"), []string{}},
+		{"viewer", user("mallory"), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relation+"@"+tt.subject.String(), func(t *testing.T) {
+			got, err := c.ListObjects(context.Background(), "document", tt.relation, tt.subject)
+			if err != nil {
+				t.Fatalf("ListObjects: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ListObjects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// leaves returns the subjects of the stored tuples in a tree, in the order they appear.
+func leaves(n *Node) []string {
+	var subjects []string
+	for _, s := range n.Subjects {
+		if !s.IsUserset() {
+			subjects = append(subjects, s.String())
+		}
+	}
+	for _, child := range n.Children {
+		subjects = append(subjects, leaves(child)...)
+	}
+	return subjects
+}
+
+func TestExpand(t *testing.T) {
+	c := newTestChecker(t, documentTuples...)
+	plan := Object{Type: "document", ID: "plan"}
+
+	tests := []struct {
+		relation string
+		kind     string
+		want     []string
+	}{
+		// editors are the stored ones, then the owners
+		{"editor", NodeUnion, []string{"user:bob", "user:alice"}},
+		{"viewer", NodeUnion, []string{"user:erin", "user:bob", "user:alice", "user:carol", "user:dave"}},
+		{"commenter", NodeExclusion, []string{"user:erin", "user:bob", "user:alice", "user:carol", "user:dave", "user:erin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relation, func(t *testing.T) {
+			root, err := c.Expand(context.Background(), plan, tt.relation)
+			if err != nil {
+				t.Fatalf("Expand: %v", err)
+			}
+			if root.Kind != NodeUserset || root.Object != "document:plan" || root.Relation != tt.relation {
+				t.Fatalf("root = %+v, want the userset document:plan#%s", root, tt.relation)
+			}
+			if len(root.Children) != 1 || root.Children[0].Kind != tt.kind {
+				t.Fatalf("root children = %+v, want one %s node", root.Children, tt.kind)
+			}
+			if got := leaves(root); !slices.Equal(got, tt.want) {
+				t.Errorf("subjects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+var cycleTuples = []string{
+	"folder:a#parent@folder:b",
+	"folder:b#parent@folder:c",
+	"folder:c#parent@folder:a",
+	"folder:c#viewer@user:alice",
+}
+
+func TestCycles(t *testing.T) {
+	c := newTestChecker(t, cycleTuples...)
+	ctx := context.Background()
+	a := Object{Type: "folder", ID: "a"}
+
+	ok, err := c.Check(ctx, a, "viewer", user("alice"))
+	if err != nil || !ok {
+		t.Errorf("Check through the cycle = %t, %v, want true", ok, err)
+	}
+	ok, err = c.Check(ctx, a, "viewer", user("bob"))
+	if err != nil || ok {
+		t.Errorf("Check of a stranger = %t, %v, want false once the cycle is cut", ok, err)
+	}
+
+	root, err := c.Expand(ctx, a, "viewer")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	var cycles int
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Cycle {
+			cycles++
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	if cycles == 0 {
+		t.Errorf("Expand marked no cycle")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	c := newTestChecker(t, cycleTuples...)
+	c.MaxDepth = 1
+	ctx := context.Background()
+	a := Object{Type: "folder", ID: "a"}
+
+	if _, err := c.Check(ctx, a, "viewer", user("bob")); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Check: err = %v, want ErrMaxDepth", err)
+	}
+	if _, err := c.Expand(ctx, a, "viewer"); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expand: err = %v, want ErrMaxDepth", err)
+	}
+	if _, err := c.ListObjects(ctx, "folder", "viewer", user("bob")); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("ListObjects: err = %v, want ErrMaxDepth", err)
+	}
+}
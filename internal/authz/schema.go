@@ -0,0 +1,204 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var ErrUnknownRelation = errors.New("unknown relation")
+
+// Rewrite defines who holds a relation. Exactly one field is set:
+//
+//	This             subjects of tuples stored for the relation itself
+//	ComputedUserset  holders of another relation on the same object, e.g. editors include owners
+//	TupleToUserset   holders of a relation on objects linked through a tupleset relation, e.g.
+//	                 viewers of a desk include the members of the room stored as its "room"
+//	Union            holders of any of the rewrites
+//	Intersection     holders of every rewrite
+//	Exclusion        holders of Base that do not hold Subtract
+type Rewrite struct {
+	This            bool            `json:"this,omitempty"`
+	ComputedUserset string          `json:"computed_userset,omitempty"`
+	TupleToUserset  *TupleToUserset `json:"tuple_to_userset,omitempty"`
+	Union           []*Rewrite      `json:"union,omitempty"`
+	Intersection    []*Rewrite      `json:"intersection,omitempty"`
+	Exclusion       *Exclusion      `json:"exclusion,omitempty"`
+}
+
+type TupleToUserset struct {
+	Tupleset        string `json:"tupleset"`
+	ComputedUserset string `json:"computed_userset"`
+}
+
+type Exclusion struct {
+	Base     *Rewrite `json:"base"`
+	Subtract *Rewrite `json:"subtract"`
+}
+
+// This returns the rewrite for directly stored tuples.
+func This() *Rewrite { return &Rewrite{This: true} }
+
+// Computed returns the rewrite for holders of another relation on the same object.
+func Computed(relation string) *Rewrite { return &Rewrite{ComputedUserset: relation} }
+
+// FromTupleset returns the rewrite for holders of relation on the objects stored under tupleset.
+func FromTupleset(tupleset, relation string) *Rewrite {
+	return &Rewrite{TupleToUserset: &TupleToUserset{Tupleset: tupleset, ComputedUserset: relation}}
+}
+
+// Union returns the rewrite for holders of any of rewrites.
+func Union(rewrites ...*Rewrite) *Rewrite { return &Rewrite{Union: rewrites} }
+
+// Intersection returns the rewrite for holders of all of rewrites.
+func Intersection(rewrites ...*Rewrite) *Rewrite { return &Rewrite{Intersection: rewrites} }
+
+// Exclude returns the rewrite for holders of base that do not hold subtract.
+func Exclude(base, subtract *Rewrite) *Rewrite {
+	return &Rewrite{Exclusion: &Exclusion{Base: base, Subtract: subtract}}
+}
+
+// Schema lists the relations of every object type and how each is rewritten. A nil rewrite means This.
+type Schema struct {
+	Types map[string]map[string]*Rewrite `json:"types"`
+}
+
+// DefaultSchema describes the rooms and desks of the office:
+//
+//	room   owner, moderator (owners moderate), member (moderators are members)
+//	desk   room (the room the desk is in), owner, booker (owners and members of the desk's room
+//	       may book it), viewer (anyone who may book it, plus moderators of its room)
+//	group  member
+func DefaultSchema() *Schema {
+	return &Schema{Types: map[string]map[string]*Rewrite{
+		"group": {
+			"member": This(),
+		},
+		"room": {
+			"owner":     This(),
+			"moderator": Union(This(), Computed("owner")),
+			"member":    Union(This(), Computed("moderator")),
+		},
+		"desk": {
+			"room":   This(),
+			"owner":  This(),
+			"booker": Union(This(), Computed("owner"), FromTupleset("room", "member")),
+			"viewer": Union(This(), Computed("booker"), FromTupleset("room", "moderator")),
+		},
+	}}
+}
+
+// LoadSchema reads a schema from a JSON file, e.g.
+//
+//	{"types": {"room": {"owner": {"this": true},
+//	  "moderator": {"union": [{"this": true}, {"computed_userset": "owner"}]}}}}
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &schema, nil
+}
+
+// Rewrite returns the rewrite of a relation, or ErrUnknownRelation if the type has no such relation.
+func (s *Schema) Rewrite(objectType, relation string) (*Rewrite, error) {
+	rewrite, ok := s.Types[objectType][relation]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s#%s", ErrUnknownRelation, objectType, relation)
+	}
+	if rewrite == nil {
+		return This(), nil
+	}
+	return rewrite, nil
+}
+
+// Validate checks that every rewrite sets exactly one field and only refers to relations of its type.
+// Relations reached through a tupleset are not checked since the tupleset may hold objects of any type.
+func (s *Schema) Validate() error {
+	types := make([]string, 0, len(s.Types))
+	for typ := range s.Types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for _, typ := range types {
+		if !validName(typ) {
+			return fmt.Errorf("invalid type name %q", typ)
+		}
+		for relation, rewrite := range s.Types[typ] {
+			if !validName(relation) {
+				return fmt.Errorf("invalid relation name %s#%q", typ, relation)
+			}
+			if rewrite == nil {
+				continue
+			}
+			if err := s.validateRewrite(typ, rewrite); err != nil {
+				return fmt.Errorf("%s#%s: %w", typ, relation, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateRewrite(typ string, r *Rewrite) error {
+	set := 0
+	if r.This {
+		set++
+	}
+	if r.ComputedUserset != "" {
+		set++
+		if _, ok := s.Types[typ][r.ComputedUserset]; !ok {
+			return fmt.Errorf("%w: %s#%s", ErrUnknownRelation, typ, r.ComputedUserset)
+		}
+	}
+	if r.TupleToUserset != nil {
+		set++
+		if _, ok := s.Types[typ][r.TupleToUserset.Tupleset]; !ok {
+			return fmt.Errorf("%w: %s#%s", ErrUnknownRelation, typ, r.TupleToUserset.Tupleset)
+		}
+		if r.TupleToUserset.ComputedUserset == "" {
+			return errors.New("tuple_to_userset needs computed_userset")
+		}
+	}
+	for _, children := range [][]*Rewrite{r.Union, r.Intersection} {
+		if len(children) == 0 {
+			continue
+		}
+		set++
+		for _, child := range children {
+			if child == nil {
+				return errors.New("empty rewrite")
+			}
+			if err := s.validateRewrite(typ, child); err != nil {
+				return err
+			}
+		}
+	}
+	if r.Exclusion != nil {
+		set++
+		if r.Exclusion.Base == nil || r.Exclusion.Subtract == nil {
+			return errors.New("exclusion needs base and subtract")
+		}
+		if err := s.validateRewrite(typ, r.Exclusion.Base); err != nil {
+			return err
+		}
+		if err := s.validateRewrite(typ, r.Exclusion.Subtract); err != nil {
+			return err
+		}
+	}
+
+	if set != 1 {
+		return fmt.Errorf("rewrite must set exactly one of this, computed_userset, tuple_to_userset, union, intersection and exclusion, got %d", set)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package authz
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store persists relation tuples.
+type Store interface {
+	// Write stores tuples. Writing a tuple that already exists does nothing.
+	Write(ctx context.Context, tuples ...Tuple) error
+	// Delete removes tuples. Deleting a tuple that does not exist does nothing.
+	Delete(ctx context.Context, tuples ...Tuple) error
+	// Read returns the subjects of the tuples stored for relation on object.
+	Read(ctx context.Context, object Object, relation string) ([]Subject, error)
+	// ObjectIDs returns the IDs of the objects of a type that appear in any tuple.
+	ObjectIDs(ctx context.Context, objectType string) ([]string, error)
+}
+
+// MemoryStore keeps tuples in memory. It is meant for tests and single-process tools.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	tuples map[Tuple]struct{}
+}
+
+func NewMemoryStore(tuples ...Tuple) *MemoryStore {
+	s := &MemoryStore{tuples: make(map[Tuple]struct{})}
+	for _, t := range tuples {
+		s.tuples[t] = struct{}{}
+	}
+	return s
+}
+
+func (s *MemoryStore) Write(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tuples {
+		s.tuples[t] = struct{}{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tuples {
+		delete(s.tuples, t)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Read(ctx context.Context, object Object, relation string) ([]Subject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subjects []Subject
+	for t := range s.tuples {
+		if t.Object == object && t.Relation == relation {
+			subjects = append(subjects, t.Subject)
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].String() < subjects[j].String()
+	})
+	return subjects, nil
+}
+
+func (s *MemoryStore) ObjectIDs(ctx context.Context, objectType string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var ids []string
+	for t := range s.tuples {
+		if t.Object.Type == objectType && !seen[t.Object.ID] {
+			seen[t.Object.ID] = true
+			ids = append(ids, t.Object.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,111 @@
+// Package authz answers relationship-based authorization questions such as "can user X moderate
+// room Y". Relationships are stored as tuples, object#relation@subject, in the style of Zanzibar,
+// and a Schema of userset rewrites derives further relations from them, e.g. owners are editors.
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidTuple = errors.New("invalid tuple")
+
+// Object identifies a resource, written type:id, e.g. room:42.
+type Object struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+func (o Object) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// Subject is who a relation is granted to: a single object such as user:alice, or with Relation set
+// a userset such as group:eng#member, meaning everyone holding that relation on the object.
+type Subject struct {
+	Object
+	Relation string `json:"relation,omitempty"`
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Object.String()
+	}
+	return s.Object.String() + "#" + s.Relation
+}
+
+// IsUserset reports whether the subject stands for the holders of a relation rather than a single object.
+func (s Subject) IsUserset() bool {
+	return s.Relation != ""
+}
+
+// Tuple grants Relation on Object to Subject.
+type Tuple struct {
+	Object   Object  `json:"object"`
+	Relation string  `json:"relation"`
+	Subject  Subject `json:"subject"`
+}
+
+// String formats the tuple as object#relation@subject, e.g. room:42#moderator@user:alice.
+func (t Tuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// ParseObject parses type:id.
+func ParseObject(s string) (Object, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || !validName(typ) || id == "" || strings.ContainsAny(id, "#@") {
+		return Object{}, fmt.Errorf("%w: object %q is not type:id", ErrInvalidTuple, s)
+	}
+	return Object{Type: typ, ID: id}, nil
+}
+
+// ParseSubject parses type:id or type:id#relation.
+func ParseSubject(s string) (Subject, error) {
+	obj, relation, _ := strings.Cut(s, "#")
+	object, err := ParseObject(obj)
+	if err != nil {
+		return Subject{}, err
+	}
+	if strings.Contains(s, "#") && !validName(relation) {
+		return Subject{}, fmt.Errorf("%w: subject %q has an invalid relation", ErrInvalidTuple, s)
+	}
+	return Subject{Object: object, Relation: relation}, nil
+}
+
+// ParseTuple parses object#relation@subject.
+func ParseTuple(s string) (Tuple, error) {
+	left, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %q has no subject", ErrInvalidTuple, s)
+	}
+	obj, relation, ok := strings.Cut(left, "#")
+	if !ok || !validName(relation) {
+		return Tuple{}, fmt.Errorf("%w: %q has no relation", ErrInvalidTuple, s)
+	}
+
+	object, err := ParseObject(obj)
+	if err != nil {
+		return Tuple{}, err
+	}
+	sub, err := ParseSubject(subject)
+	if err != nil {
+		return Tuple{}, err
+	}
+
+	return Tuple{Object: object, Relation: relation, Subject: sub}, nil
+}
+
+// validName reports whether s is usable as a type or relation name: lowercase letters, digits and underscores.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -22,6 +24,105 @@ type Config struct {
 	SMTPUser        string `env:"SMTP_USER"`
 	SMTPPass        string `env:"SMTP_PASS"`
 	SMTPFrom        string `env:"SMTP_FROM"`
+	AppBaseURL      string `env:"APP_BASE_URL"`
+
+	// PasswordResetURL is the page of the links in reset emails. It defaults to the page this service
+	// serves at /reset-password.
+	PasswordResetURL string `env:"PASSWORD_RESET_URL"`
+	// InvitationURL is the page of the links in invitation emails. It defaults to the page this
+	// service serves at /accept-invitation.
+	InvitationURL     string `env:"INVITATION_URL"`
+	EmailTemplatesDir string `env:"EMAIL_TEMPLATES_DIR"`
+
+	EmailBackend           string `env:"EMAIL_BACKEND"`
+	SMTPTLS                string `env:"SMTP_TLS"`
+	SMTPInsecureSkipVerify bool   `env:"SMTP_INSECURE_SKIP_VERIFY"`
+	EmailMaildirPath       string `env:"EMAIL_MAILDIR_PATH"`
+	EmailCaptureLimit      int    `env:"EMAIL_CAPTURE_LIMIT"`
+
+	PasswordMinLength     int    `env:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength     int    `env:"PASSWORD_MAX_LENGTH"`
+	PasswordRequireUpper  bool   `env:"PASSWORD_REQUIRE_UPPER"`
+	PasswordRequireLower  bool   `env:"PASSWORD_REQUIRE_LOWER"`
+	PasswordRequireDigit  bool   `env:"PASSWORD_REQUIRE_DIGIT"`
+	PasswordRequireSymbol bool   `env:"PASSWORD_REQUIRE_SYMBOL"`
+	BreachedPasswordsDir  string `env:"BREACHED_PASSWORDS_DIR"`
+
+	PasswordHistorySize int           `env:"PASSWORD_HISTORY_SIZE"`
+	PasswordMinAge      time.Duration `env:"PASSWORD_MIN_AGE"`
+	PasswordMaxAge      time.Duration `env:"PASSWORD_MAX_AGE"`
+
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost            int    `env:"BCRYPT_COST"`
+	Argon2Memory          int    `env:"ARGON2_MEMORY"`
+	Argon2Iterations      int    `env:"ARGON2_ITERATIONS"`
+	Argon2Parallelism     int    `env:"ARGON2_PARALLELISM"`
+	ScryptLogN            int    `env:"SCRYPT_LOG_N"`
+	ScryptR               int    `env:"SCRYPT_R"`
+	ScryptP               int    `env:"SCRYPT_P"`
+
+	JobsEnabled                   bool          `env:"JOBS_ENABLED"`
+	ResetTokenCleanupInterval     time.Duration `env:"RESET_TOKEN_CLEANUP_INTERVAL"`
+	SessionCleanupInterval        time.Duration `env:"SESSION_CLEANUP_INTERVAL"`
+	AuditLogCleanupInterval       time.Duration `env:"AUDIT_LOG_CLEANUP_INTERVAL"`
+	AuditLogRetention             time.Duration `env:"AUDIT_LOG_RETENTION"`
+	UnverifiedUserCleanupInterval time.Duration `env:"UNVERIFIED_USER_CLEANUP_INTERVAL"`
+	UnverifiedUserRetention       time.Duration `env:"UNVERIFIED_USER_RETENTION"`
+
+	LoginAlertsEnabled        bool          `env:"LOGIN_ALERTS_ENABLED"`
+	LoginAlertTokenTTL        time.Duration `env:"LOGIN_ALERT_TOKEN_TTL"`
+	LoginAlertCleanupInterval time.Duration `env:"LOGIN_ALERT_CLEANUP_INTERVAL"`
+
+	RiskStepUpThreshold           int           `env:"RISK_STEP_UP_THRESHOLD"`
+	RiskBlockThreshold            int           `env:"RISK_BLOCK_THRESHOLD"`
+	RiskFailureWindow             time.Duration `env:"RISK_FAILURE_WINDOW"`
+	GeoIPDatabaseFile             string        `env:"GEOIP_DATABASE_FILE"`
+	LoginChallengeTTL             time.Duration `env:"LOGIN_CHALLENGE_TTL"`
+	LoginChallengeCleanupInterval time.Duration `env:"LOGIN_CHALLENGE_CLEANUP_INTERVAL"`
+	LoginAttemptCleanupInterval   time.Duration `env:"LOGIN_ATTEMPT_CLEANUP_INTERVAL"`
+	LoginAttemptRetention         time.Duration `env:"LOGIN_ATTEMPT_RETENTION"`
+
+	InvitationTTL             time.Duration `env:"INVITATION_TTL"`
+	InvitationCleanupInterval time.Duration `env:"INVITATION_CLEANUP_INTERVAL"`
+
+	AuthzSchemaFile string `env:"AUTHZ_SCHEMA_FILE"`
+
+	ImpersonationTTL time.Duration `env:"IMPERSONATION_TTL"`
+
+	// AuthBackend checks login passwords: local against the stored hashes, ldap against a directory.
+	AuthBackend        string        `env:"AUTH_BACKEND"`
+	LDAPURL            string        `env:"LDAP_URL"`
+	LDAPStartTLS       bool          `env:"LDAP_START_TLS"`
+	LDAPBindDN         string        `env:"LDAP_BIND_DN"`
+	LDAPBindPassword   string        `env:"LDAP_BIND_PASSWORD"`
+	LDAPUserBaseDN     string        `env:"LDAP_USER_BASE_DN"`
+	LDAPUserFilter     string        `env:"LDAP_USER_FILTER"`
+	LDAPEmailAttribute string        `env:"LDAP_EMAIL_ATTRIBUTE"`
+	LDAPNameAttribute  string        `env:"LDAP_NAME_ATTRIBUTE"`
+	LDAPGroupRoles     string        `env:"LDAP_GROUP_ROLES"`
+	LDAPTimeout        time.Duration `env:"LDAP_TIMEOUT"`
+
+	// SCIMBearerToken is the token directories provision users with. SCIM is disabled when it is empty.
+	SCIMBearerToken string `env:"SCIM_BEARER_TOKEN"`
+	SCIMBaseURL     string `env:"SCIM_BASE_URL"`
+
+	// MetricsToken is the bearer token Prometheus scrapes /metrics with. /metrics is disabled when it is empty.
+	MetricsToken string `env:"METRICS_TOKEN"`
+
+	PolicyFile           string        `env:"POLICY_FILE"`
+	PolicyDryRun         bool          `env:"POLICY_DRY_RUN"`
+	PolicyReloadInterval time.Duration `env:"POLICY_RELOAD_INTERVAL"`
+	PolicyTimezone       string        `env:"POLICY_TIMEZONE"`
+
+	// EmailOutboxKey is the secret the key sealing the tokens of queued emails is derived from. It
+	// defaults to JWT_SECRET.
+	EmailOutboxKey string `env:"EMAIL_OUTBOX_KEY"`
+
+	EmailDispatchInterval  time.Duration `env:"EMAIL_DISPATCH_INTERVAL"`
+	EmailDispatchBatchSize int           `env:"EMAIL_DISPATCH_BATCH_SIZE"`
+	EmailMaxAttempts       int           `env:"EMAIL_MAX_ATTEMPTS"`
+	EmailRetryBaseDelay    time.Duration `env:"EMAIL_RETRY_BASE_DELAY"`
+	EmailRetryMaxDelay     time.Duration `env:"EMAIL_RETRY_MAX_DELAY"`
 }
 
 func LoadConfig() *Config {
@@ -44,5 +145,130 @@ func LoadConfig() *Config {
 		SMTPUser:        os.Getenv("SMTP_USER"),
 		SMTPPass:        os.Getenv("SMTP_PASS"),
 		SMTPFrom:        os.Getenv("SMTP_FROM"),
+		AppBaseURL:      os.Getenv("APP_BASE_URL"),
+
+		PasswordResetURL:  getEnv("PASSWORD_RESET_URL", os.Getenv("APP_BASE_URL")+"/reset-password"),
+		InvitationURL:     getEnv("INVITATION_URL", os.Getenv("APP_BASE_URL")+"/accept-invitation"),
+		EmailTemplatesDir: os.Getenv("EMAIL_TEMPLATES_DIR"),
+
+		EmailBackend:           getEnv("EMAIL_BACKEND", "smtp"),
+		SMTPTLS:                getEnv("SMTP_TLS", "auto"),
+		SMTPInsecureSkipVerify: getEnvBool("SMTP_INSECURE_SKIP_VERIFY", false),
+		EmailMaildirPath:       getEnv("EMAIL_MAILDIR_PATH", "./maildir"),
+		EmailCaptureLimit:      getEnvInt("EMAIL_CAPTURE_LIMIT", 1000),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:     getEnvInt("PASSWORD_MAX_LENGTH", 72),
+		PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", false),
+		PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", false),
+		PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+		PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		BreachedPasswordsDir:  os.Getenv("BREACHED_PASSWORDS_DIR"),
+
+		PasswordHistorySize: getEnvInt("PASSWORD_HISTORY_SIZE", 5),
+		PasswordMinAge:      getEnvDuration("PASSWORD_MIN_AGE", 0),
+		PasswordMaxAge:      getEnvDuration("PASSWORD_MAX_AGE", 0),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+		BcryptCost:            getEnvInt("BCRYPT_COST", 10),
+		Argon2Memory:          getEnvInt("ARGON2_MEMORY", 64*1024),
+		Argon2Iterations:      getEnvInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:     getEnvInt("ARGON2_PARALLELISM", 2),
+		ScryptLogN:            getEnvInt("SCRYPT_LOG_N", 15),
+		ScryptR:               getEnvInt("SCRYPT_R", 8),
+		ScryptP:               getEnvInt("SCRYPT_P", 1),
+
+		JobsEnabled:                   getEnvBool("JOBS_ENABLED", true),
+		ResetTokenCleanupInterval:     getEnvDuration("RESET_TOKEN_CLEANUP_INTERVAL", time.Hour),
+		SessionCleanupInterval:        getEnvDuration("SESSION_CLEANUP_INTERVAL", time.Hour),
+		AuditLogCleanupInterval:       getEnvDuration("AUDIT_LOG_CLEANUP_INTERVAL", 24*time.Hour),
+		AuditLogRetention:             getEnvDuration("AUDIT_LOG_RETENTION", 90*24*time.Hour),
+		UnverifiedUserCleanupInterval: getEnvDuration("UNVERIFIED_USER_CLEANUP_INTERVAL", 24*time.Hour),
+		UnverifiedUserRetention:       getEnvDuration("UNVERIFIED_USER_RETENTION", 7*24*time.Hour),
+
+		LoginAlertsEnabled:        getEnvBool("LOGIN_ALERTS_ENABLED", true),
+		LoginAlertTokenTTL:        getEnvDuration("LOGIN_ALERT_TOKEN_TTL", 72*time.Hour),
+		LoginAlertCleanupInterval: getEnvDuration("LOGIN_ALERT_CLEANUP_INTERVAL", time.Hour),
+
+		RiskStepUpThreshold:           getEnvInt("RISK_STEP_UP_THRESHOLD", 50),
+		RiskBlockThreshold:            getEnvInt("RISK_BLOCK_THRESHOLD", 90),
+		RiskFailureWindow:             getEnvDuration("RISK_FAILURE_WINDOW", 15*time.Minute),
+		GeoIPDatabaseFile:             os.Getenv("GEOIP_DATABASE_FILE"),
+		LoginChallengeTTL:             getEnvDuration("LOGIN_CHALLENGE_TTL", 10*time.Minute),
+		LoginChallengeCleanupInterval: getEnvDuration("LOGIN_CHALLENGE_CLEANUP_INTERVAL", time.Hour),
+		LoginAttemptCleanupInterval:   getEnvDuration("LOGIN_ATTEMPT_CLEANUP_INTERVAL", 24*time.Hour),
+		LoginAttemptRetention:         getEnvDuration("LOGIN_ATTEMPT_RETENTION", 90*24*time.Hour),
+
+		InvitationTTL:             getEnvDuration("INVITATION_TTL", 7*24*time.Hour),
+		InvitationCleanupInterval: getEnvDuration("INVITATION_CLEANUP_INTERVAL", 24*time.Hour),
+
+		AuthzSchemaFile: os.Getenv("AUTHZ_SCHEMA_FILE"),
+
+		ImpersonationTTL: getEnvDuration("IMPERSONATION_TTL", 15*time.Minute),
+
+		AuthBackend:        getEnv("AUTH_BACKEND", "local"),
+		LDAPURL:            os.Getenv("LDAP_URL"),
+		LDAPStartTLS:       getEnvBool("LDAP_START_TLS", false),
+		LDAPBindDN:         os.Getenv("LDAP_BIND_DN"),
+		LDAPBindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		LDAPUserBaseDN:     os.Getenv("LDAP_USER_BASE_DN"),
+		LDAPUserFilter:     getEnv("LDAP_USER_FILTER", "(|(mail=%s)(userPrincipalName=%s))"),
+		LDAPEmailAttribute: getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPNameAttribute:  getEnv("LDAP_NAME_ATTRIBUTE", "displayName"),
+		LDAPGroupRoles:     os.Getenv("LDAP_GROUP_ROLES"),
+		LDAPTimeout:        getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+
+		SCIMBearerToken: os.Getenv("SCIM_BEARER_TOKEN"),
+		SCIMBaseURL:     getEnv("SCIM_BASE_URL", os.Getenv("APP_BASE_URL")+"/scim/v2"),
+
+		MetricsToken: os.Getenv("METRICS_TOKEN"),
+
+		PolicyFile:           os.Getenv("POLICY_FILE"),
+		PolicyDryRun:         getEnvBool("POLICY_DRY_RUN", false),
+		PolicyReloadInterval: getEnvDuration("POLICY_RELOAD_INTERVAL", 10*time.Second),
+		PolicyTimezone:       getEnv("POLICY_TIMEZONE", "UTC"),
+
+		EmailOutboxKey: getEnv("EMAIL_OUTBOX_KEY", os.Getenv("JWT_SECRET")),
+
+		EmailDispatchInterval:  getEnvDuration("EMAIL_DISPATCH_INTERVAL", 5*time.Second),
+		EmailDispatchBatchSize: getEnvInt("EMAIL_DISPATCH_BATCH_SIZE", 50),
+		EmailMaxAttempts:       getEnvInt("EMAIL_MAX_ATTEMPTS", 8),
+		EmailRetryBaseDelay:    getEnvDuration("EMAIL_RETRY_BASE_DELAY", 30*time.Second),
+		EmailRetryMaxDelay:     getEnvDuration("EMAIL_RETRY_MAX_DELAY", time.Hour),
+	}
+}
+
+// getEnv reads a string variable, falling back to def when it is unset.
+func getEnv(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvInt reads an integer variable, falling back to def when it is unset or malformed.
+func getEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvBool reads a boolean variable, falling back to def when it is unset or malformed.
+func getEnvBool(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvDuration reads a duration such as "24h", falling back to def when it is unset or malformed.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
 	}
+	return value
 }
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_sessions_user_id;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip_address,
+    DROP COLUMN IF EXISTS device,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN expires_at TYPE TIMESTAMP;
@@ -0,0 +1,9 @@
+ALTER TABLE sessions
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ADD COLUMN device VARCHAR(255),
+    ADD COLUMN ip_address VARCHAR(64),
+    ADD COLUMN user_agent TEXT,
+    ADD COLUMN last_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE password_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_password_history_user_id_created_at ON password_history(user_id, created_at DESC);
+
+INSERT INTO password_history (user_id, password_hash, created_at)
+SELECT id, password_hash, updated_at FROM users;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD COLUMN password_changed_at TIMESTAMPTZ,
+    ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET password_changed_at = updated_at;
+
+ALTER TABLE users
+    ALTER COLUMN password_changed_at SET NOT NULL,
+    ALTER COLUMN password_changed_at SET DEFAULT NOW();
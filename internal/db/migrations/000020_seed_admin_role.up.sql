@@ -0,0 +1,11 @@
+INSERT INTO roles (role_name) VALUES ('admin')
+ON CONFLICT (role_name) DO NOTHING;
+
+INSERT INTO permissions (permission_name, description)
+VALUES ('users:manage', 'Manage user accounts')
+ON CONFLICT (permission_name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.role_name = 'admin' AND p.permission_name = 'users:manage'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DELETE FROM password_resets;
+
+ALTER TABLE password_resets RENAME COLUMN token_hash TO token;
@@ -0,0 +1,4 @@
+-- Raw tokens cannot be converted to hashes, so outstanding reset requests are dropped.
+DELETE FROM password_resets;
+
+ALTER TABLE password_resets RENAME COLUMN token TO token_hash;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS known_login_ips;
+DROP TABLE IF EXISTS known_devices;
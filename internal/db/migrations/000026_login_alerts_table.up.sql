@@ -0,0 +1,11 @@
+CREATE TABLE login_alerts (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL,
+    device_hashes TEXT[] NOT NULL DEFAULT '{}',
+    expired_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_alerts_user_id ON login_alerts(user_id);
+CREATE INDEX idx_login_alerts_expired_at ON login_alerts(expired_at);
@@ -0,0 +1,19 @@
+CREATE TABLE login_attempts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64),
+    ip_prefix VARCHAR(64),
+    user_agent TEXT,
+    device_hash TEXT,
+    country VARCHAR(8),
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    outcome VARCHAR(16) NOT NULL,
+    risk_score INT NOT NULL DEFAULT 0,
+    risk_reasons TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_attempts_user_id_created_at ON login_attempts(user_id, created_at);
+CREATE INDEX idx_login_attempts_email_created_at ON login_attempts(email, created_at);
@@ -0,0 +1,11 @@
+CREATE TABLE login_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expired_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_challenges_user_id ON login_challenges(user_id);
+CREATE INDEX idx_login_challenges_expired_at ON login_challenges(expired_at);
@@ -0,0 +1,15 @@
+DELETE FROM permissions WHERE permission_name IN ('org:manage', 'org:members:read');
+
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS org_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS org_id;
+
+DROP TABLE IF EXISTS organization_member_roles;
+
+DELETE FROM roles WHERE org_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_roles_org_name;
+DROP INDEX IF EXISTS idx_roles_global_name;
+ALTER TABLE roles DROP COLUMN IF EXISTS org_id;
+ALTER TABLE roles ADD CONSTRAINT roles_role_name_key UNIQUE (role_name);
+
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
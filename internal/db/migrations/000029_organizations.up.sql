@@ -0,0 +1,39 @@
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE organization_members (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+
+-- Roles without an organization are global, the others only apply inside their organization
+ALTER TABLE roles ADD COLUMN org_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE roles DROP CONSTRAINT roles_role_name_key;
+CREATE UNIQUE INDEX idx_roles_global_name ON roles(role_name) WHERE org_id IS NULL;
+CREATE UNIQUE INDEX idx_roles_org_name ON roles(org_id, role_name) WHERE org_id IS NOT NULL;
+
+CREATE TABLE organization_member_roles (
+    org_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (org_id, user_id, role_id),
+    FOREIGN KEY (org_id, user_id) REFERENCES organization_members(org_id, user_id) ON DELETE CASCADE
+);
+
+ALTER TABLE sessions ADD COLUMN org_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE audit_logs ADD COLUMN org_id UUID REFERENCES organizations(id) ON DELETE CASCADE;
+
+INSERT INTO permissions (permission_name, description)
+VALUES
+    ('org:manage', 'Manage an organization, its members and their roles'),
+    ('org:members:read', 'List the members of an organization')
+ON CONFLICT (permission_name) DO NOTHING;
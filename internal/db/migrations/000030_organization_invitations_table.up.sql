@@ -0,0 +1,15 @@
+CREATE TABLE organization_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    locale VARCHAR(35) NOT NULL DEFAULT 'en',
+    token_hash TEXT UNIQUE NOT NULL,
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expired_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Inviting an address again replaces its pending invitation
+CREATE UNIQUE INDEX idx_organization_invitations_org_email ON organization_invitations(org_id, email);
+CREATE INDEX idx_organization_invitations_expired_at ON organization_invitations(expired_at);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE permission_name IN ('authz:check', 'authz:manage');
+
+DROP TABLE IF EXISTS relation_tuples;
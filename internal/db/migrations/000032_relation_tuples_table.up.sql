@@ -0,0 +1,28 @@
+-- Relationship tuples object#relation@subject, where the subject is a single object when
+-- subject_relation is empty and the holders of subject_relation on it otherwise
+CREATE TABLE relation_tuples (
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    object_type VARCHAR(64) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    relation VARCHAR(64) NOT NULL,
+    subject_type VARCHAR(64) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (org_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+);
+
+CREATE INDEX idx_relation_tuples_subject ON relation_tuples(org_id, subject_type, subject_id, subject_relation);
+
+INSERT INTO permissions (permission_name, description)
+VALUES
+    ('authz:check', 'Check, expand and list relationships'),
+    ('authz:manage', 'Write and delete relationships')
+ON CONFLICT (permission_name) DO NOTHING;
+
+-- Owners of existing organizations get the new permissions, as owners of new ones do
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.org_id IS NOT NULL AND r.role_name = 'owner'
+    AND p.permission_name IN ('authz:check', 'authz:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+ALTER TABLE roles DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE roles DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE roles DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,6 @@
+-- Identifiers the provisioning client (the customer's directory) uses for users and groups
+ALTER TABLE users ADD COLUMN external_id VARCHAR(255);
+ALTER TABLE roles ADD COLUMN external_id VARCHAR(255);
+
+ALTER TABLE roles ADD COLUMN created_at TIMESTAMPTZ DEFAULT NOW();
+ALTER TABLE roles ADD COLUMN updated_at TIMESTAMPTZ DEFAULT NOW();
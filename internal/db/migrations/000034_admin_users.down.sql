@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_created_at_id;
+DROP INDEX IF EXISTS idx_users_lower_name;
+DROP INDEX IF EXISTS idx_users_lower_email;
+
+DROP INDEX IF EXISTS idx_audit_logs_user_id_created_at;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS details;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS actor_id;
@@ -0,0 +1,9 @@
+-- Admin actions are audited with the admin who took them and what they changed
+ALTER TABLE audit_logs ADD COLUMN actor_id UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE audit_logs ADD COLUMN details JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX idx_audit_logs_user_id_created_at ON audit_logs(user_id, created_at DESC);
+
+-- Admins search users by email or name prefix and page through them newest first
+CREATE INDEX idx_users_lower_email ON users(LOWER(email) text_pattern_ops);
+CREATE INDEX idx_users_lower_name ON users(LOWER(name) text_pattern_ops);
+CREATE INDEX idx_users_created_at_id ON users(created_at DESC, id DESC);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE permission_name = 'users:impersonate';
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS actor_id;
@@ -0,0 +1,11 @@
+-- Sessions started by an admin impersonating the user record the admin
+ALTER TABLE sessions ADD COLUMN actor_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+INSERT INTO permissions (permission_name, description)
+VALUES ('users:impersonate', 'Sign in as other users')
+ON CONFLICT (permission_name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.role_name = 'admin' AND r.org_id IS NULL AND p.permission_name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE roles DROP COLUMN IF EXISTS scim_managed;
+ALTER TABLE users DROP COLUMN IF EXISTS scim_managed;
@@ -0,0 +1,9 @@
+-- SCIM only sees and changes the users and roles it provisioned itself
+ALTER TABLE users ADD COLUMN scim_managed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE roles ADD COLUMN scim_managed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Until now only SCIM set external IDs, apart from the ldap: ones of directory users
+UPDATE users SET scim_managed = TRUE WHERE external_id IS NOT NULL AND external_id NOT LIKE 'ldap:%';
+UPDATE roles SET scim_managed = TRUE
+WHERE external_id IS NOT NULL AND org_id IS NULL
+    AND NOT EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role_id = roles.id);
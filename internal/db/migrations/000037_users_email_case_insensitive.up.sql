@@ -0,0 +1,4 @@
+-- Email addresses are unique whatever their case. This fails while addresses differing only in
+-- case exist, which have to be merged or renamed first.
+CREATE UNIQUE INDEX users_email_lower_key ON users (LOWER(email));
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
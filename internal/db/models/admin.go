@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminUserQuery filters and pages the users listed to admins. Search matches the start of the
+// email or the name, Cursor is the next_cursor of the previous page.
+type AdminUserQuery struct {
+	Search   string `form:"q" binding:"omitempty,max=255"`
+	Active   *bool  `form:"active"`
+	Verified *bool  `form:"verified"`
+	Role     string `form:"role" binding:"omitempty,max=255"`
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor   string `form:"cursor"`
+}
+
+// UserSearch is an AdminUserQuery ready for the database. The page starts after the user
+// created at AfterCreatedAt with AfterID, when AfterID is set, going from newest to oldest.
+type UserSearch struct {
+	Prefix         string
+	Active         *bool
+	Verified       *bool
+	Role           string
+	AfterCreatedAt time.Time
+	AfterID        uuid.UUID
+	Limit          int
+}
+
+// AdminUserPage is a page of users. NextCursor is empty on the last page.
+type AdminUserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// AdminUserDetail is a user with their global roles, active sessions and latest audit events.
+type AdminUserDetail struct {
+	User        *User      `json:"user"`
+	Roles       []Role     `json:"roles"`
+	Sessions    []Session  `json:"sessions"`
+	AuditEvents []AuditLog `json:"audit_events"`
+}
+
+// AdminCreateUserRequest creates a user with a verified email address. Without a password the user
+// is emailed a link to set one. Roles are names of global roles.
+type AdminCreateUserRequest struct {
+	Name     string   `json:"name" binding:"required,max=255"`
+	Email    string   `json:"email" binding:"required,email"`
+	Password string   `json:"password"`
+	Locale   string   `json:"locale" binding:"omitempty,bcp47_language_tag"`
+	Roles    []string `json:"roles" binding:"omitempty,dive,required"`
+}
+
+// ImpersonationResult is a token signing an admin in as another user, until ExpiresAt.
+type ImpersonationResult struct {
+	Token     string    `json:"token"`
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
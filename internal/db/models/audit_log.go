@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditUserCreated            = "user.created"
+	AuditUserDisabled           = "user.disabled"
+	AuditUserEnabled            = "user.enabled"
+	AuditUserPasswordResetForce = "user.password_reset_forced"
+	AuditUserDeleted            = "user.deleted"
+	AuditImpersonationStarted   = "impersonation.started"
+	AuditImpersonationStopped   = "impersonation.stopped"
+	AuditUsersImported          = "users.imported"
+	AuditUsersExported          = "users.exported"
+)
+
+// AuditLog is an entry of the audit log. UserID is the user the action concerns and ActorID the
+// one who took it; either is nil when that user no longer exists or there is none.
+type AuditLog struct {
+	ID        uuid.UUID      `json:"id"`
+	UserID    *uuid.UUID     `json:"user_id"`
+	ActorID   *uuid.UUID     `json:"actor_id"`
+	OrgID     *uuid.UUID     `json:"org_id,omitempty"`
+	Action    string         `json:"action"`
+	Details   map[string]any `json:"details"`
+	CreatedAt time.Time      `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// Objects and subjects in authorization requests are written type:id, e.g. room:42 or user:<uuid>;
+// subjects may also be usersets such as group:eng#member.
+
+type AuthzCheckRequest struct {
+	Object   string `json:"object" binding:"required"`
+	Relation string `json:"relation" binding:"required"`
+	Subject  string `json:"subject" binding:"required"`
+}
+
+type AuthzExpandRequest struct {
+	Object   string `json:"object" binding:"required"`
+	Relation string `json:"relation" binding:"required"`
+}
+
+type AuthzListObjectsRequest struct {
+	Type     string `json:"type" binding:"required"`
+	Relation string `json:"relation" binding:"required"`
+	Subject  string `json:"subject" binding:"required"`
+}
+
+// RelationTuplesRequest writes or deletes tuples written object#relation@subject, e.g.
+// room:42#moderator@user:<uuid>.
+type RelationTuplesRequest struct {
+	Tuples []string `json:"tuples" binding:"required,min=1,max=100"`
+}
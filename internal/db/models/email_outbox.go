@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+// OutboxEmail is an email waiting in the outbox to be sent by the dispatcher.
+type OutboxEmail struct {
+	ID             uuid.UUID         `json:"id"`
+	IdempotencyKey string            `json:"idempotency_key"`
+	Kind           string            `json:"kind"`
+	Recipient      string            `json:"recipient"`
+	Payload        map[string]string `json:"payload"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastError      string            `json:"last_error"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Group is a set of organization members, such as a team or department, whose roles apply to every
+// member. Members of a subgroup are members of its parent groups too.
+type Group struct {
+	ID          uuid.UUID   `json:"id"`
+	OrgID       uuid.UUID   `json:"org_id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Roles       []string    `json:"roles"`
+	SubgroupIDs []uuid.UUID `json:"subgroup_ids"`
+	MemberCount int         `json:"member_count"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// GroupMember is a user directly added to a group.
+type GroupMember struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Sources of a role held by a user.
+const (
+	RoleSourceGlobal = "global"
+	RoleSourceDirect = "direct"
+	RoleSourceGroup  = "group"
+)
+
+// EffectiveRole is a role a user holds and where it comes from. Group is set for roles inherited
+// from a group, which may be a parent of a group the user was added to.
+type EffectiveRole struct {
+	Role   string     `json:"role"`
+	Source string     `json:"source"`
+	Group  *uuid.UUID `json:"group_id,omitempty"`
+}
+
+// EffectivePermissions lists everything a user may do in an organization and why.
+type EffectivePermissions struct {
+	UserID      uuid.UUID       `json:"user_id"`
+	OrgID       uuid.UUID       `json:"org_id"`
+	Roles       []EffectiveRole `json:"roles"`
+	Permissions []string        `json:"permissions"`
+}
+
+type GroupRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description"`
+}
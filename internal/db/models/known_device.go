@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginAlert is an outstanding "this wasn't me" link sent after a sign-in from a new device or IP.
+type LoginAlert struct {
+	TokenHash    string    `json:"-"`
+	UserID       uuid.UUID `json:"user_id"`
+	SessionID    uuid.UUID `json:"session_id"`
+	DeviceHashes []string  `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LoginNotice describes a sign-in for the new-login alert email.
+type LoginNotice struct {
+	Device    string    `json:"device"`
+	IPAddress string    `json:"ip_address"`
+	Time      time.Time `json:"time"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes of a login attempt.
+const (
+	LoginOutcomeSuccess    = "success"
+	LoginOutcomeFailure    = "failure"
+	LoginOutcomeChallenged = "challenged"
+	LoginOutcomeBlocked    = "blocked"
+)
+
+// LoginAttempt is a recorded login attempt. UserID is nil for unknown emails, the location
+// fields are nil when the IP address is not in the GeoIP database.
+type LoginAttempt struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      *uuid.UUID `json:"user_id"`
+	Email       string     `json:"email"`
+	IPAddress   string     `json:"ip_address"`
+	IPPrefix    string     `json:"ip_prefix"`
+	UserAgent   string     `json:"user_agent"`
+	DeviceHash  string     `json:"-"`
+	Country     *string    `json:"country"`
+	Latitude    *float64   `json:"latitude"`
+	Longitude   *float64   `json:"longitude"`
+	Outcome     string     `json:"outcome"`
+	RiskScore   int        `json:"risk_score"`
+	RiskReasons []string   `json:"risk_reasons"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// LoginChallenge is a login waiting for the code emailed to the user because it looked risky.
+type LoginChallenge struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	CodeHash  string    `json:"-"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginChallengeRequest completes a login that required a confirmation code.
+type LoginChallengeRequest struct {
+	ChallengeID uuid.UUID `json:"challenge_id" binding:"required"`
+	Code        string    `json:"code" binding:"required"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization is a tenant: a company whose members share roles and data.
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationMembership is an organization a user belongs to, with the roles they hold in it.
+type OrganizationMembership struct {
+	Organization
+	Roles    []string  `json:"roles"`
+	JoinedAt time.Time `json:"joined_at"`
+	Active   bool      `json:"active"`
+}
+
+// OrganizationMember is a user belonging to an organization, with the roles they hold in it.
+type OrganizationMember struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Roles    []string  `json:"roles"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+	Slug string `json:"slug" binding:"required,min=2,max=64"`
+}
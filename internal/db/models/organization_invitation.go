@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrganizationInvitation is a pending invitation to join an organization with a role.
+type OrganizationInvitation struct {
+	ID        uuid.UUID  `json:"id"`
+	OrgID     uuid.UUID  `json:"org_id"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Locale    string     `json:"locale"`
+	TokenHash string     `json:"-"`
+	InvitedBy *uuid.UUID `json:"invited_by,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// InvitationNotice describes an invitation for the invitation email.
+type InvitationNotice struct {
+	Organization string `json:"organization"`
+	Inviter      string `json:"inviter"`
+	Role         string `json:"role"`
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	// Role is the organization role granted on acceptance. Defaults to member.
+	Role string `json:"role"`
+	// Locale is the language of the invitation email.
+	Locale string `json:"locale" binding:"omitempty,bcp47_language_tag"`
+}
+
+// AcceptInvitationRequest accepts an invitation. Name and Password are only needed when no
+// account exists for the invited address yet, to register one.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" form:"token" binding:"required"`
+	Name     string `json:"name" form:"name"`
+	Password string `json:"password" form:"password"`
+	Locale   string `json:"locale" form:"locale" binding:"omitempty,bcp47_language_tag"`
+}
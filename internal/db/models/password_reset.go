@@ -7,17 +7,17 @@ import (
 )
 
 type PasswordReset struct {
-	Token     string    `json:"token"`
+	TokenHash string    `json:"-"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
 type PasswordResetRequest struct {
-	Email string `json:"email" binding:"required,email"`
+	Email string `json:"email" form:"email" binding:"required,email"`
 }
 
 type NewPasswordRequest struct {
-	Token       string `json:"token" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=8"`
+	Token       string `json:"token" form:"token" binding:"required"`
+	NewPassword string `json:"new_password" form:"new_password" binding:"required"`
 }
@@ -3,10 +3,17 @@ package models
 type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
+	Locale   string `json:"locale" binding:"omitempty,bcp47_language_tag"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
+	Device   string `json:"device"`
+}
+
+// TokenRequest carries the token of a link from an email, as JSON or from the form of its page.
+type TokenRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Role is a named set of permissions. Global roles created through SCIM are its groups, for as
+// long as they grant no permissions.
+type Role struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	ExternalID  *string   `json:"external_id,omitempty"`
+	SCIMManaged bool      `json:"scim_managed"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RoleMember is a user holding a global role.
+type RoleMember struct {
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	Email  string    `json:"email"`
+}
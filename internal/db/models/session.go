@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"-"`
+	// OrgID is the organization the session is signed in to, uuid.Nil when none.
+	OrgID        uuid.UUID `json:"org_id"`
+	SessionToken string    `json:"-"`
+	Device       string    `json:"device"`
+	IPAddress    string    `json:"ip_address"`
+	UserAgent    string    `json:"user_agent"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	Current      bool      `json:"current"`
+	// ActorID is the admin impersonating the user in this session, nil for the user's own sessions.
+	ActorID *uuid.UUID `json:"impersonated_by,omitempty"`
+}
+
+// ClientInfo describes the device a request was made from.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+	Device    string
+	// DeviceToken is the device cookie sent by the client, if any.
+	DeviceToken string
+}
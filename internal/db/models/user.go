@@ -12,12 +12,86 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"`
 	IsActive     bool      `json:"is_active"`
+	Locale       string    `json:"locale"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	PasswordChangedAt  time.Time  `json:"password_changed_at"`
+	MustChangePassword bool       `json:"must_change_password"`
+	EmailVerifiedAt    *time.Time `json:"email_verified_at"`
+	// ExternalID is the identifier the provisioning client uses for the user, if any. Users of the
+	// LDAP directory have "ldap:" and their DN.
+	ExternalID *string `json:"external_id,omitempty"`
+	// SCIMManaged is set on users provisioned through SCIM, the only ones SCIM may see and change.
+	SCIMManaged bool `json:"scim_managed"`
 }
 
 type CreateNewUser struct {
 	Name         string `json:"name" binding:"required"`
 	Email        string `json:"email" binding:"required,email"`
 	PasswordHash string `json:"Password_hash" binding:"required,min=8"`
+	Locale       string `json:"locale"`
+}
+
+// UpdateProfileRequest holds the profile fields a user may change. Nil fields are left untouched.
+type UpdateProfileRequest struct {
+	Name   *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Locale *string `json:"locale" binding:"omitempty,bcp47_language_tag"`
+}
+
+type EmailChangeRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword     string `json:"current_password" binding:"required"`
+	NewPassword         string `json:"new_password" binding:"required"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// EmailVerification is an outstanding email address verification for a new account.
+type EmailVerification struct {
+	TokenHash string    `json:"-"`
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EmailChange is a pending email address change waiting for confirmation from the new address.
+type EmailChange struct {
+	TokenHash string    `json:"-"`
+	UserID    uuid.UUID `json:"user_id"`
+	NewEmail  string    `json:"new_email"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginResult is returned by a successful login. When PasswordChangeRequired is set the
+// token is restricted to the change-password route.
+type LoginResult struct {
+	Token                  string `json:"token"`
+	PasswordChangeRequired bool   `json:"password_change_required"`
+	// DeviceToken is a new device cookie for clients that did not send one.
+	DeviceToken string `json:"-"`
+	// ChallengeRequired is set instead of a token when the login has to be confirmed with
+	// the code emailed to the user, quoting ChallengeID.
+	ChallengeRequired bool       `json:"challenge_required"`
+	ChallengeID       *uuid.UUID `json:"challenge_id,omitempty"`
+}
+
+type ForcePasswordChangeRequest struct {
+	UserIDs        []uuid.UUID `json:"user_ids" binding:"required,min=1"`
+	RevokeSessions bool        `json:"revoke_sessions"`
+}
+
+// EmailRecipient is the addressee of an email. Name and Locale personalize and localize the message.
+type EmailRecipient struct {
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Locale string `json:"locale"`
 }
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// ImportUser is a user read from an import file. PasswordHash is an optional bcrypt or argon2id
+// hash; users without one are invited to set a password. Roles are names of global roles.
+type ImportUser struct {
+	Email        string   `json:"email"`
+	Name         string   `json:"name"`
+	PasswordHash string   `json:"password_hash"`
+	Locale       string   `json:"locale"`
+	Roles        []string `json:"roles"`
+}
+
+// ImportOptions control an import. DryRun only validates the rows. Invite emails users imported
+// without a password hash a link to set their password; without it such rows are rejected.
+type ImportOptions struct {
+	DryRun bool
+	Invite bool
+}
+
+// ImportRowError is a rejected row of an import. Row counts the users of the file from 1.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportResult is the outcome of an import. Imports are all or nothing: when any row is rejected
+// no user is imported.
+type ImportResult struct {
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Invited  int              `json:"invited"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// ExportUser is a user as written by an export. PasswordHash is only set when asked for.
+type ExportUser struct {
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	PasswordHash  string    `json:"password_hash,omitempty"`
+	Locale        string    `json:"locale"`
+	Roles         []string  `json:"roles"`
+	Active        bool      `json:"active"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// UserImportQuery holds the query parameters of an import request. Format defaults to the content
+// type of the body.
+type UserImportQuery struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv json"`
+	DryRun bool   `form:"dry_run"`
+	Invite bool   `form:"invite"`
+}
+
+// UserExportQuery holds the query parameters of an export request. Password hashes are only
+// exported from the command line, never over HTTP.
+type UserExportQuery struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv json"`
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AccountHandler struct {
+	accountService service.AccountService
+	logger         logger.Logger
+}
+
+func NewAccountHandler(accountService service.AccountService, logger logger.Logger) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+		logger:         logger,
+	}
+}
+
+// UpdateProfile handles PATCH /api/profile.
+func (h *AccountHandler) UpdateProfile(c *gin.Context) {
+	const op = "handlers.UpdateProfile"
+	var req models.UpdateProfileRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Errorf("%s: failed to parse JSON body: %v", op, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	user, err := h.accountService.UpdateProfile(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "profile updated successfully",
+		"user":    user,
+	})
+}
+
+// RequestEmailChange handles POST /api/profile/email and sends a confirmation link to the new address.
+func (h *AccountHandler) RequestEmailChange(c *gin.Context) {
+	const op = "handlers.RequestEmailChange"
+	var req models.EmailChangeRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Errorf("%s: failed to parse JSON body: %v", op, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	if err := h.accountService.RequestEmailChange(c.Request.Context(), userID, &req); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "a confirmation link was sent to the new email address",
+	})
+}
+
+// ConfirmEmailChange handles POST /confirm-email-change with the token of the confirmation link. The
+// link itself opens a page asking to confirm.
+func (h *AccountHandler) ConfirmEmailChange(c *gin.Context) {
+	const op = "handlers.ConfirmEmailChange"
+
+	var req models.TokenRequest
+	if err := bindPageRequest(c, &req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	if err := h.accountService.ConfirmEmailChange(c.Request.Context(), req.Token); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"message": "email address changed successfully",
+	})
+}
+
+// ConfirmEmailChangePage handles GET /confirm-email-change?token=... from the confirmation link.
+func (h *AccountHandler) ConfirmEmailChangePage(c *gin.Context) {
+	showForm(c, page{
+		Title:    "Confirm your new email address",
+		Messages: []string{"Confirm to sign in with this email address from now on."},
+		Submit:   "Confirm",
+	})
+}
+
+// DeleteAccount handles DELETE /api/account. The current password must be sent again.
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	const op = "handlers.DeleteAccount"
+	var req models.DeleteAccountRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Errorf("%s: failed to parse JSON body: %v", op, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	if err := h.accountService.DeleteAccount(c.Request.Context(), userID, req.Password); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "account deleted",
+	})
+}
+
+// ChangePassword handles POST /api/change-password.
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	const op = "handlers.ChangePassword"
+	var req models.ChangePasswordRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Errorf("%s: failed to parse JSON body: %v", op, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	sessionID := c.MustGet("session_id").(uuid.UUID)
+
+	if err := h.accountService.ChangePassword(c.Request.Context(), userID, sessionID, &req); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password changed successfully",
+	})
+}
+
+// respondError maps account service errors to HTTP responses.
+func (h *AccountHandler) respondError(c *gin.Context, op string, err error) {
+	if respondPasswordPolicyError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, service.ErrInvalidPassword):
+		respond(c, http.StatusUnauthorized, gin.H{"error": "invalid password"})
+	case errors.Is(err, service.ErrEmailTaken):
+		respond(c, http.StatusConflict, gin.H{"error": "email already in use"})
+	case errors.Is(err, service.ErrInvalidToken):
+		respond(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+	default:
+		h.logger.Errorf("%s: request failed: %v", op, err)
+		respond(c, http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxImportSize is the largest import file accepted, in bytes.
+const maxImportSize = 10 << 20
+
+type AdminHandler struct {
+	adminService      service.AdminService
+	userImportService service.UserImportService
+	logger            logger.Logger
+}
+
+func NewAdminHandler(adminService service.AdminService, userImportService service.UserImportService, logger logger.Logger) *AdminHandler {
+	return &AdminHandler{
+		adminService:      adminService,
+		userImportService: userImportService,
+		logger:            logger,
+	}
+}
+
+// ForcePasswordChange handles POST /api/admin/users/force-password-change.
+func (h *AdminHandler) ForcePasswordChange(c *gin.Context) {
+	const op = "handlers.ForcePasswordChange"
+	var req models.ForcePasswordChangeRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Errorf("%s: failed to parse JSON body: %v", op, err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	flagged, err := h.adminService.ForcePasswordChange(c.Request.Context(), req.UserIDs, req.RevokeSessions)
+	if err != nil {
+		h.logger.Errorf("%s: failed to force password change: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "users must change their password on next login",
+		"data": gin.H{
+			"flagged": flagged,
+		},
+	})
+}
+
+// ListUsers handles GET /api/admin/users. The query parameters are q, active, verified, role,
+// limit and cursor.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	const op = "handlers.AdminListUsers"
+
+	var query models.AdminUserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	page, err := h.adminService.ListUsers(c.Request.Context(), &query)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUser handles GET /api/admin/users/:id.
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	const op = "handlers.AdminGetUser"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	detail, err := h.adminService.GetUser(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// CreateUser handles POST /api/admin/users.
+func (h *AdminHandler) CreateUser(c *gin.Context) {
+	const op = "handlers.AdminCreateUser"
+
+	var req models.AdminCreateUserRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := h.adminService.CreateUser(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user": user,
+	})
+}
+
+// DisableUser handles POST /api/admin/users/:id/disable.
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.setUserActive(c, "handlers.AdminDisableUser", false)
+}
+
+// EnableUser handles POST /api/admin/users/:id/enable.
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.setUserActive(c, "handlers.AdminEnableUser", true)
+}
+
+func (h *AdminHandler) setUserActive(c *gin.Context, op string, active bool) {
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.SetUserActive(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id, active); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	message := "user enabled"
+	if !active {
+		message = "user disabled"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// ForcePasswordReset handles POST /api/admin/users/:id/reset-password.
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	const op = "handlers.AdminForcePasswordReset"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.ForcePasswordReset(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset email sent"})
+}
+
+// DeleteUser handles DELETE /api/admin/users/:id.
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	const op = "handlers.AdminDeleteUser"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.DeleteUser(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
+}
+
+// ImportUsers handles POST /api/admin/users/import. The body is a CSV or JSON file of users; the
+// format query parameter picks it, otherwise the content type does. With dry_run the rows are only
+// validated. Rejected rows are reported with 422 and nothing is imported.
+func (h *AdminHandler) ImportUsers(c *gin.Context) {
+	const op = "handlers.AdminImportUsers"
+
+	var query models.UserImportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+	if query.Format == "" {
+		query.Format = service.UserFileJSON
+		if strings.Contains(c.ContentType(), "csv") {
+			query.Format = service.UserFileCSV
+		}
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	users, err := service.DecodeUsers(body, query.Format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid import file",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	opts := models.ImportOptions{DryRun: query.DryRun, Invite: query.Invite}
+	result, err := h.userImportService.Import(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), users, opts)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ExportUsers handles GET /api/admin/users/export. Users are streamed as a CSV or JSON download,
+// without their password hashes.
+func (h *AdminHandler) ExportUsers(c *gin.Context) {
+	const op = "handlers.AdminExportUsers"
+
+	var query models.UserExportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+	if query.Format == "" {
+		query.Format = service.UserFileCSV
+	}
+
+	contentType := "application/json"
+	if query.Format == service.UserFileCSV {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, query.Format))
+	c.Status(http.StatusOK)
+
+	err := h.userImportService.Export(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), c.Writer, query.Format, false)
+	if err != nil {
+		// once the download started the status can no longer change, the file is cut short
+		if c.Writer.Written() {
+			h.logger.Errorf("%s: export stopped: %v", op, err)
+			return
+		}
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		h.respondError(c, op, err)
+	}
+}
+
+func (h *AdminHandler) respondError(c *gin.Context, op string, err error) {
+	if respondPasswordPolicyError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUnsupportedFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfManagement):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Errorf("%s: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/Nucleussss/auth-service/internal/db/models"
@@ -10,6 +11,12 @@ import (
 	"github.com/google/uuid"
 )
 
+// deviceCookieName is the cookie that lets the service recognize devices a user signed in from before.
+const deviceCookieName = "device_id"
+
+// deviceCookieMaxAge is how long browsers keep the device cookie, in seconds.
+const deviceCookieMaxAge = 400 * 24 * 60 * 60
+
 type AuthHandler struct {
 	authService          *service.AuthService
 	passwordResetService service.PasswordResetService
@@ -41,6 +48,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// register the user
 	if err := h.authService.Register(c.Request.Context(), &req); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":  "registration failed",
 			"detail": err.Error(),
@@ -48,9 +58,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// send a success response
+	// send a success response. It is the same whether or not the email was already registered.
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "user registered successfully",
+		"message": "registration received, check your email to verify your address",
 		"data": gin.H{
 			"name":  req.Name,
 			"email": req.Email,
@@ -74,22 +84,197 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// validate the user credentials
-	token, err := h.authService.Login(c.Request.Context(), &req)
+	result, err := h.authService.Login(c.Request.Context(), &req, clientInfo(c, req.Device))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":  "invalid credentials",
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid credentials",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrLoginBlocked) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "login blocked",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "account disabled",
+			})
+			return
+		}
+		h.logger.Errorf("%s: login failed: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	// risky logins continue at POST /login/challenge with the code sent by email
+	if result.ChallengeRequired {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "confirmation required, check your email for a code",
+			"data": gin.H{
+				"email":              req.Email,
+				"challenge_required": true,
+				"challenge_id":       result.ChallengeID,
+			},
+		})
+		return
+	}
+
+	respondLoginSuccess(c, req.Email, result)
+}
+
+// VerifyLoginChallenge handles POST /login/challenge and finishes a login with the code sent by email.
+func (h *AuthHandler) VerifyLoginChallenge(c *gin.Context) {
+	const op = "handlers.VerifyLoginChallenge"
+	var req models.LoginChallengeRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
 			"detail": err.Error(),
 		})
 		return
 	}
 
+	result, err := h.authService.VerifyLoginChallenge(c.Request.Context(), &req, clientInfo(c, ""))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid or expired code",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "account disabled",
+			})
+			return
+		}
+		h.logger.Errorf("%s: login challenge failed: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	respondLoginSuccess(c, "", result)
+}
+
+// clientInfo describes the device the request is coming from.
+func clientInfo(c *gin.Context, device string) *models.ClientInfo {
+	deviceToken, _ := c.Cookie(deviceCookieName)
+	return &models.ClientInfo{
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		Device:      device,
+		DeviceToken: deviceToken,
+	}
+}
+
+// respondLoginSuccess sends the token of a successful login and sets the device cookie if one was issued.
+func respondLoginSuccess(c *gin.Context, email string, result *models.LoginResult) {
+	// remember the device for the next login
+	if result.DeviceToken != "" {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(deviceCookieName, result.DeviceToken, deviceCookieMaxAge, "/", "", isHTTPS(c), true)
+	}
+
 	// return a success response with the user data
+	data := gin.H{
+		"token":                    result.Token,
+		"password_change_required": result.PasswordChangeRequired,
+	}
+	if email != "" {
+		data["email"] = email
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "login successful",
-		"data": gin.H{
-			"email": req.Email,
-			"token": token,
-		},
+		"data":    data,
+	})
+}
+
+// isHTTPS reports whether the client reached the service over HTTPS, directly or through a proxy.
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// ReportLogin handles POST /report-login with the token of the "this wasn't me" link of a new-login
+// alert. The link itself opens a page asking to confirm.
+func (h *AuthHandler) ReportLogin(c *gin.Context) {
+	const op = "handlers.ReportLogin"
+
+	var req models.TokenRequest
+	if err := bindPageRequest(c, &req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.ReportLogin(c.Request.Context(), req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		h.logger.Errorf("%s: failed to report login: %v", op, err)
+		respond(c, http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"message": "the session was signed out, check your email to reset your password",
+	})
+}
+
+// VerifyEmail handles POST /verify-email with the token of the verification email. The link itself
+// opens a page asking to confirm.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	const op = "handlers.VerifyEmail"
+
+	var req models.TokenRequest
+	if err := bindPageRequest(c, &req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	if err := h.authService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		h.logger.Errorf("%s: failed to verify email: %v", op, err)
+		respond(c, http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"message": "email address verified",
+	})
+}
+
+// ReportLoginPage handles GET /report-login?token=... from the "this wasn't me" link of a new-login alert.
+func (h *AuthHandler) ReportLoginPage(c *gin.Context) {
+	showForm(c, page{
+		Title:    "Was this not you?",
+		Messages: []string{"Confirm to sign out the new session and get an email to reset your password."},
+		Submit:   "Sign it out",
+	})
+}
+
+// VerifyEmailPage handles GET /verify-email?token=... from the verification email.
+func (h *AuthHandler) VerifyEmailPage(c *gin.Context) {
+	showForm(c, page{
+		Title:    "Verify your email address",
+		Messages: []string{"Confirm that this is your email address."},
+		Submit:   "Verify",
 	})
 }
 
@@ -122,33 +307,29 @@ func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
 	var req models.PasswordResetRequest
 
 	//
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindPageRequest(c, &req); err != nil {
 		h.logger.Errorf("Invalid password reset request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
+		respond(c, http.StatusBadRequest, gin.H{
 			"error":  "invalid request",
 			"detail": err.Error(),
 		})
 		return
 	}
 
-	_, err := h.passwordResetService.RequestReset(c.Request.Context(), req.Email)
-	if err != nil {
-		h.logger.Errorf("Password reset request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send password reset email"})
-		return
-	}
+	// the reset runs after responding, so the response time does not tell whether the email is known
+	h.passwordResetService.RequestResetInBackground(c.Request.Context(), req.Email)
 
-	c.JSON(http.StatusOK, gin.H{"message": "If email is correct, you will receive a password reset"})
+	respond(c, http.StatusOK, gin.H{"message": "If email is correct, you will receive a password reset"})
 }
 
 // Reset Password
 func (h *AuthHandler) ResetPassword(c *gin.Context) {
 
-	// get the token from the request header
+	// get the token from the request body, JSON or the form of the reset page
 	var req models.NewPasswordRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := bindPageRequest(c, &req); err != nil {
 		h.logger.Errorf("Invalid new password request: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
+		respond(c, http.StatusBadRequest, gin.H{
 			"error":  "invalid request",
 			"detail": err.Error(),
 		})
@@ -159,10 +340,91 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	err := h.passwordResetService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
 	if err != nil {
 		h.logger.Errorf("Password reset failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidToken) {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		respond(c, http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "Password updated succesfully"})
+	respond(c, 200, gin.H{"message": "Password updated succesfully"})
+
+}
+
+// ResetPasswordPage handles GET /reset-password?token=..., the default link of reset and
+// set-password emails. Without a token, as linked from the emails telling users to reset their
+// password if something was not them, it asks for an email address to send a reset link to.
+func (h *AuthHandler) ResetPasswordPage(c *gin.Context) {
+	if c.Query("token") == "" {
+		renderPage(c, http.StatusOK, &page{
+			Title:    "Reset your password",
+			Messages: []string{"Enter the email address of your account to get a link to choose a new password."},
+			// relative, so it works behind a proxy serving the service under a path
+			Action: "request-password-reset",
+			Fields: []pageField{{Name: "email", Label: "Email address", Type: "email", Required: true}},
+			Submit: "Send the link",
+		})
+		return
+	}
+
+	showForm(c, page{
+		Title:  "Choose a new password",
+		Fields: []pageField{{Name: "new_password", Label: "New password", Type: "password", Required: true}},
+		Submit: "Save password",
+	})
+}
+
+// Impersonate handles POST /api/admin/users/:id/impersonate. It returns a short-lived token for the
+// user, flagged with the admin in its act claim.
+func (h *AuthHandler) Impersonate(c *gin.Context) {
+	const op = "handlers.Impersonate"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	result, err := h.authService.Impersonate(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id, clientInfo(c, ""))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, service.ErrAccountDisabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "account disabled"})
+		case errors.Is(err, service.ErrSelfImpersonation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.logger.Errorf("%s: failed to impersonate user %s: %v", op, id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// StopImpersonation handles POST /api/impersonation/stop, ending the impersonation session of the token.
+func (h *AuthHandler) StopImpersonation(c *gin.Context) {
+	const op = "handlers.StopImpersonation"
+
+	err := h.authService.StopImpersonation(c.Request.Context(),
+		c.MustGet("actor_id").(uuid.UUID),
+		c.MustGet("user_id").(uuid.UUID),
+		c.MustGet("session_id").(uuid.UUID),
+	)
+	if err != nil {
+		if errors.Is(err, service.ErrNotImpersonating) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Errorf("%s: failed to stop impersonation: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
 
+	c.JSON(http.StatusOK, gin.H{"message": "impersonation stopped"})
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/authz"
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type AuthzHandler struct {
+	authzService service.AuthzService
+	logger       logger.Logger
+}
+
+func NewAuthzHandler(authzService service.AuthzService, logger logger.Logger) *AuthzHandler {
+	return &AuthzHandler{
+		authzService: authzService,
+		logger:       logger,
+	}
+}
+
+// Check handles POST /api/authz/check and reports whether the subject holds the relation on the object.
+func (h *AuthzHandler) Check(c *gin.Context) {
+	const op = "handlers.AuthzCheck"
+
+	var req models.AuthzCheckRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	allowed, err := h.authzService.Check(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"allowed": allowed,
+	})
+}
+
+// Expand handles POST /api/authz/expand and returns the tree of everyone holding the relation on the object.
+func (h *AuthzHandler) Expand(c *gin.Context) {
+	const op = "handlers.AuthzExpand"
+
+	var req models.AuthzExpandRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tree, err := h.authzService.Expand(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tree": tree,
+	})
+}
+
+// ListObjects handles POST /api/authz/list-objects and returns the IDs of the objects of a type on
+// which the subject holds the relation.
+func (h *AuthzHandler) ListObjects(c *gin.Context) {
+	const op = "handlers.AuthzListObjects"
+
+	var req models.AuthzListObjectsRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ids, err := h.authzService.ListObjects(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"objects": ids,
+	})
+}
+
+// WriteTuples handles POST /api/authz/tuples.
+func (h *AuthzHandler) WriteTuples(c *gin.Context) {
+	const op = "handlers.WriteTuples"
+
+	var req models.RelationTuplesRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authzService.WriteTuples(c.Request.Context(), &req); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "tuples written",
+	})
+}
+
+// DeleteTuples handles DELETE /api/authz/tuples.
+func (h *AuthzHandler) DeleteTuples(c *gin.Context) {
+	const op = "handlers.DeleteTuples"
+
+	var req models.RelationTuplesRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authzService.DeleteTuples(c.Request.Context(), &req); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "tuples deleted",
+	})
+}
+
+func (h *AuthzHandler) respondError(c *gin.Context, op string, err error) {
+	switch {
+	case errors.Is(err, authz.ErrInvalidTuple), errors.Is(err, authz.ErrUnknownRelation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, authz.ErrMaxDepth):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		h.logger.Errorf("%s: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// EmailCaptureHandler exposes the emails kept by the in-memory email backend, for integration tests.
+type EmailCaptureHandler struct {
+	capture *service.CaptureTransport
+	logger  logger.Logger
+}
+
+func NewEmailCaptureHandler(capture *service.CaptureTransport, logger logger.Logger) *EmailCaptureHandler {
+	return &EmailCaptureHandler{
+		capture: capture,
+		logger:  logger,
+	}
+}
+
+// ListEmails handles GET /debug/emails and returns the captured emails, optionally filtered by ?to=.
+func (h *EmailCaptureHandler) ListEmails(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"emails": h.capture.Messages(c.Query("to")),
+	})
+}
+
+// LatestEmail handles GET /debug/emails/latest and returns the most recent captured email,
+// optionally filtered by ?to=.
+func (h *EmailCaptureHandler) LatestEmail(c *gin.Context) {
+	messages := h.capture.Messages(c.Query("to"))
+	if len(messages) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "no emails captured",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages[len(messages)-1])
+}
+
+// ClearEmails handles DELETE /debug/emails and forgets all captured emails.
+func (h *EmailCaptureHandler) ClearEmails(c *gin.Context) {
+	h.capture.Clear()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "captured emails cleared",
+	})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// respondPasswordPolicyError writes a 422 response listing the violated rules
+// and reports whether err was a password policy error.
+func respondPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	respond(c, http.StatusUnprocessableEntity, gin.H{
+		"error":  "password does not meet the password policy",
+		"fields": policyErr.Violations,
+	})
+	return true
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type GroupHandler struct {
+	groupService service.GroupService
+	logger       logger.Logger
+}
+
+func NewGroupHandler(groupService service.GroupService, logger logger.Logger) *GroupHandler {
+	return &GroupHandler{
+		groupService: groupService,
+		logger:       logger,
+	}
+}
+
+// ListGroups handles GET /api/org/groups and returns the groups of the active organization.
+func (h *GroupHandler) ListGroups(c *gin.Context) {
+	const op = "handlers.ListGroups"
+
+	groups, err := h.groupService.ListGroups(c.Request.Context())
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+	})
+}
+
+// CreateGroup handles POST /api/org/groups.
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	const op = "handlers.CreateGroup"
+
+	var req models.GroupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	group, err := h.groupService.CreateGroup(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"group": group,
+	})
+}
+
+// GetGroup handles GET /api/org/groups/:id.
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	const op = "handlers.GetGroup"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	group, err := h.groupService.GetGroup(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group": group,
+	})
+}
+
+// UpdateGroup handles PATCH /api/org/groups/:id and renames a group or changes its description.
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	const op = "handlers.UpdateGroup"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.GroupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	group, err := h.groupService.UpdateGroup(c.Request.Context(), id, &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group": group,
+	})
+}
+
+// DeleteGroup handles DELETE /api/org/groups/:id.
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	const op = "handlers.DeleteGroup"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.DeleteGroup(c.Request.Context(), id); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "group deleted",
+	})
+}
+
+// ListGroupMembers handles GET /api/org/groups/:id/members.
+func (h *GroupHandler) ListGroupMembers(c *gin.Context) {
+	const op = "handlers.ListGroupMembers"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	members, err := h.groupService.ListGroupMembers(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": members,
+	})
+}
+
+// AddGroupMember handles PUT /api/org/groups/:id/members/:user_id.
+func (h *GroupHandler) AddGroupMember(c *gin.Context) {
+	const op = "handlers.AddGroupMember"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathUUID(c, "user_id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.AddGroupMember(c.Request.Context(), id, userID); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "member added",
+	})
+}
+
+// RemoveGroupMember handles DELETE /api/org/groups/:id/members/:user_id.
+func (h *GroupHandler) RemoveGroupMember(c *gin.Context) {
+	const op = "handlers.RemoveGroupMember"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := pathUUID(c, "user_id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.RemoveGroupMember(c.Request.Context(), id, userID); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "member removed",
+	})
+}
+
+// AddSubgroup handles PUT /api/org/groups/:id/subgroups/:child_id and nests a group inside another.
+func (h *GroupHandler) AddSubgroup(c *gin.Context) {
+	const op = "handlers.AddSubgroup"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+	childID, ok := pathUUID(c, "child_id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.AddSubgroup(c.Request.Context(), id, childID); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "subgroup added",
+	})
+}
+
+// RemoveSubgroup handles DELETE /api/org/groups/:id/subgroups/:child_id.
+func (h *GroupHandler) RemoveSubgroup(c *gin.Context) {
+	const op = "handlers.RemoveSubgroup"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+	childID, ok := pathUUID(c, "child_id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.RemoveSubgroup(c.Request.Context(), id, childID); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "subgroup removed",
+	})
+}
+
+// AssignGroupRole handles PUT /api/org/groups/:id/roles/:role.
+func (h *GroupHandler) AssignGroupRole(c *gin.Context) {
+	const op = "handlers.AssignGroupRole"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.AssignGroupRole(c.Request.Context(), id, c.Param("role")); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "role assigned",
+	})
+}
+
+// UnassignGroupRole handles DELETE /api/org/groups/:id/roles/:role.
+func (h *GroupHandler) UnassignGroupRole(c *gin.Context) {
+	const op = "handlers.UnassignGroupRole"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.UnassignGroupRole(c.Request.Context(), id, c.Param("role")); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "role unassigned",
+	})
+}
+
+// EffectivePermissions handles GET /api/org/users/:id/permissions and explains what a member of the
+// active organization may do: every role they hold, where it comes from, and the resulting permissions.
+func (h *GroupHandler) EffectivePermissions(c *gin.Context) {
+	const op = "handlers.EffectivePermissions"
+
+	userID, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	permissions, err := h.groupService.EffectivePermissions(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// respondError maps group service errors to responses.
+func (h *GroupHandler) respondError(c *gin.Context, op string, err error) {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+	case errors.Is(err, service.ErrNotGroupMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "group member not found"})
+	case errors.Is(err, service.ErrNotOrganizationMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+	case errors.Is(err, service.ErrGroupNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrGroupCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Errorf("%s: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
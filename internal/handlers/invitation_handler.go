@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type InvitationHandler struct {
+	invitationService service.InvitationService
+	logger            logger.Logger
+}
+
+func NewInvitationHandler(invitationService service.InvitationService, logger logger.Logger) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+		logger:            logger,
+	}
+}
+
+// Invite handles POST /api/org/invitations and invites an email address to the active organization.
+func (h *InvitationHandler) Invite(c *gin.Context) {
+	const op = "handlers.Invite"
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	invitation, err := h.invitationService.Invite(c.Request.Context(), userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrRoleNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "invalid request",
+				"detail": "unknown role",
+			})
+			return
+		}
+		h.logger.Errorf("%s: failed to invite %s: %v", op, req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+	})
+}
+
+// ListInvitations handles GET /api/org/invitations and returns the pending invitations of the active organization.
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	const op = "handlers.ListInvitations"
+
+	invitations, err := h.invitationService.ListInvitations(c.Request.Context())
+	if err != nil {
+		h.logger.Errorf("%s: failed to list invitations: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitations": invitations,
+	})
+}
+
+// ResendInvitation handles POST /api/org/invitations/:id/resend and emails an invitation again.
+func (h *InvitationHandler) ResendInvitation(c *gin.Context) {
+	const op = "handlers.ResendInvitation"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.invitationService.ResendInvitation(c.Request.Context(), id); err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "invitation not found",
+			})
+			return
+		}
+		h.logger.Errorf("%s: failed to resend invitation %s: %v", op, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "invitation sent",
+	})
+}
+
+// RevokeInvitation handles DELETE /api/org/invitations/:id and revokes a pending invitation.
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	const op = "handlers.RevokeInvitation"
+
+	id, ok := pathUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.invitationService.RevokeInvitation(c.Request.Context(), id); err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "invitation not found",
+			})
+			return
+		}
+		h.logger.Errorf("%s: failed to revoke invitation %s: %v", op, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "invitation revoked",
+	})
+}
+
+// AcceptInvitation handles POST /accept-invitation. Invited addresses without an account get a 422
+// response naming the address, and accept again with a name and password to register.
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	const op = "handlers.AcceptInvitation"
+
+	var req models.AcceptInvitationRequest
+	if err := bindPageRequest(c, &req); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	invitation, err := h.invitationService.AcceptInvitation(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			respond(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+			return
+		}
+		if errors.Is(err, service.ErrRegistrationRequired) {
+			if isFormPost(c) {
+				renderPage(c, http.StatusUnprocessableEntity, &page{
+					Title:    "Create your account",
+					Messages: []string{"There is no account for " + invitation.Email + " yet. Enter your name and a password to create one."},
+					Action:   c.Request.URL.Path,
+					Token:    req.Token,
+					Fields:   registrationFields(true),
+					Submit:   "Accept",
+				})
+				return
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "registration required",
+				"email": invitation.Email,
+			})
+			return
+		}
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		h.logger.Errorf("%s: failed to accept invitation: %v", op, err)
+		respond(c, http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"message": "invitation accepted",
+		"data": gin.H{
+			"org_id": invitation.OrgID,
+			"role":   invitation.Role,
+		},
+	})
+}
+
+// AcceptInvitationPage handles GET /accept-invitation?token=..., the default link of invitation
+// emails. Name and password are only needed by invited addresses without an account.
+func (h *InvitationHandler) AcceptInvitationPage(c *gin.Context) {
+	showForm(c, page{
+		Title:    "Accept the invitation",
+		Messages: []string{"If you do not have an account yet, enter your name and a password to create one."},
+		Fields:   registrationFields(false),
+		Submit:   "Accept",
+	})
+}
+
+// registrationFields are the inputs invited addresses without an account register with.
+func registrationFields(required bool) []pageField {
+	return []pageField{
+		{Name: "name", Label: "Name", Type: "text", Required: required},
+		{Name: "password", Label: "Password", Type: "password", Required: required},
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/scheduler"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	scheduler *scheduler.Scheduler
+	logger    logger.Logger
+}
+
+func NewMetricsHandler(scheduler *scheduler.Scheduler, logger logger.Logger) *MetricsHandler {
+	return &MetricsHandler{
+		scheduler: scheduler,
+		logger:    logger,
+	}
+}
+
+// Metrics handles GET /metrics and returns the background job metrics for Prometheus.
+func (h *MetricsHandler) Metrics(c *gin.Context) {
+	const op = "handlers.Metrics"
+
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	if err := h.scheduler.WriteMetrics(c.Writer); err != nil {
+		h.logger.Errorf("%s: failed to write metrics: %v", op, err)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type OrganizationHandler struct {
+	orgService  service.OrganizationService
+	authService *service.AuthService
+	logger      logger.Logger
+}
+
+func NewOrganizationHandler(orgService service.OrganizationService, authService *service.AuthService, logger logger.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService:  orgService,
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// ListOrganizations handles GET /api/orgs and returns the organizations the user belongs to.
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	const op = "handlers.ListOrganizations"
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	orgs, err := h.orgService.ListOrganizations(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Errorf("%s: failed to list organizations for user %s: %v", op, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organizations": orgs,
+	})
+}
+
+// CreateOrganization handles POST /api/orgs and creates an organization owned by the user.
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	const op = "handlers.CreateOrganization"
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(c.Request.Context(), userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSlug):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "invalid request",
+				"detail": err.Error(),
+			})
+		case errors.Is(err, service.ErrSlugTaken):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			h.logger.Errorf("%s: failed to create organization for user %s: %v", op, userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "internal server error",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"organization": org,
+	})
+}
+
+// SwitchOrganization handles POST /api/orgs/:id/switch. It returns a token for the organization
+// and ends the session of the token used for the request.
+func (h *OrganizationHandler) SwitchOrganization(c *gin.Context) {
+	const op = "handlers.SwitchOrganization"
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	sessionID := c.MustGet("session_id").(uuid.UUID)
+
+	orgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": "invalid organization id",
+		})
+		return
+	}
+
+	token, err := h.authService.SwitchOrganization(c.Request.Context(), userID, sessionID, orgID, clientInfo(c, ""))
+	if err != nil {
+		if errors.Is(err, service.ErrNotOrganizationMember) {
+			// do not reveal whether the organization exists
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "organization not found",
+			})
+			return
+		}
+		h.logger.Errorf("%s: failed to switch user %s to organization %s: %v", op, userID, orgID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "organization switched",
+		"data": gin.H{
+			"token":  token,
+			"org_id": orgID,
+		},
+	})
+}
+
+// ListMembers handles GET /api/org/members and returns the members of the active organization.
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	const op = "handlers.ListMembers"
+
+	members, err := h.orgService.ListMembers(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, repositories.ErrNoOrganization) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "no active organization",
+			})
+			return
+		}
+		h.logger.Errorf("%s: failed to list members: %v", op, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": members,
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Links in emails open pages rather than act on their own: mail scanners and link prefetchers
+// follow links, so a GET only shows a form, and submitting it posts the token back to the same
+// path, which does the work and answers with another page.
+
+// pageField is an input of the form of a page, besides the token.
+type pageField struct {
+	Name     string
+	Label    string
+	Type     string
+	Required bool
+}
+
+type page struct {
+	Title    string
+	Messages []string
+	// Action is where the form posts to. Pages without one show no form.
+	Action string
+	Token  string
+	Fields []pageField
+	Submit string
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Messages}}<p>{{.}}</p>
+{{end}}{{if .Action}}<form method="post" action="{{.Action}}">
+{{if .Token}}<input type="hidden" name="token" value="{{.Token}}">
+{{end}}{{range .Fields}}<p><label>{{.Label}}<br><input name="{{.Name}}" type="{{.Type}}"{{if .Required}} required{{end}}></label></p>
+{{end}}<p><button type="submit">{{.Submit}}</button></p>
+</form>
+{{end}}</body>
+</html>
+`))
+
+func renderPage(c *gin.Context, status int, p *page) {
+	// the token is in the address of the page, so it must not be cached or sent on as a referrer
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := pageTemplate.Execute(c.Writer, p); err != nil {
+		c.Error(err)
+	}
+}
+
+// showForm answers the GET request of a link from an email with the page p, with a form posting
+// the token of the link to the same path.
+func showForm(c *gin.Context, p page) {
+	token := c.Query("token")
+	if token == "" {
+		renderPage(c, http.StatusBadRequest, &page{
+			Title:    p.Title,
+			Messages: []string{"This link is incomplete. Open the link from the email again."},
+		})
+		return
+	}
+
+	p.Action = c.Request.URL.Path
+	p.Token = token
+	renderPage(c, http.StatusOK, &p)
+}
+
+// isFormPost reports whether the request was submitted from the form of a page.
+func isFormPost(c *gin.Context) bool {
+	return c.ContentType() == binding.MIMEPOSTForm
+}
+
+// bindPageRequest binds the body of a request submitted from a page, and JSON from anything else.
+func bindPageRequest(c *gin.Context, req any) error {
+	if isFormPost(c) {
+		return c.ShouldBindWith(req, binding.Form)
+	}
+	return c.ShouldBindJSON(req)
+}
+
+// respond writes obj as JSON, or a page with its message or error when the request was submitted
+// from a page.
+func respond(c *gin.Context, status int, obj gin.H) {
+	if !isFormPost(c) {
+		c.JSON(status, obj)
+		return
+	}
+
+	p := &page{Title: "Done"}
+	if status >= http.StatusBadRequest {
+		p.Title = "That did not work"
+	}
+	for _, key := range []string{"message", "error", "detail"} {
+		if s, ok := obj[key].(string); ok {
+			p.Messages = append(p.Messages, s)
+		}
+	}
+	if fields, ok := obj["fields"].([]models.FieldError); ok {
+		for _, field := range fields {
+			p.Messages = append(p.Messages, field.Message)
+		}
+	}
+	renderPage(c, status, p)
+}
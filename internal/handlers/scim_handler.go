@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Nucleussss/auth-service/internal/scim"
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SCIMHandler serves the SCIM 2.0 endpoints under /scim/v2. Responses use the SCIM formats,
+// errors included, rather than the ones of the rest of the API.
+type SCIMHandler struct {
+	scimService service.SCIMService
+	logger      logger.Logger
+}
+
+func NewSCIMHandler(scimService service.SCIMService, logger logger.Logger) *SCIMHandler {
+	return &SCIMHandler{
+		scimService: scimService,
+		logger:      logger,
+	}
+}
+
+// ServiceProviderConfig handles GET /scim/v2/ServiceProviderConfig.
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, scim.ServiceProviderConfig(service.SCIMMaxResults))
+}
+
+// ListUsers handles GET /scim/v2/Users with the filter, startIndex and count query parameters.
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	const op = "handlers.SCIMListUsers"
+
+	startIndex, count := scimPage(c)
+	list, err := h.scimService.ListUsers(c.Request.Context(), c.Query("filter"), startIndex, count)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetUser handles GET /scim/v2/Users/:id.
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	const op = "handlers.SCIMGetUser"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.scimService.GetUser(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser handles POST /scim/v2/Users.
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	const op = "handlers.SCIMCreateUser"
+
+	var req scim.User
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.CreateUser(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.Header("Location", user.Meta.Location)
+	c.JSON(http.StatusCreated, user)
+}
+
+// ReplaceUser handles PUT /scim/v2/Users/:id.
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	const op = "handlers.SCIMReplaceUser"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+	var req scim.User
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(c.Request.Context(), id, &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// PatchUser handles PATCH /scim/v2/Users/:id.
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	const op = "handlers.SCIMPatchUser"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.PatchUser(c.Request.Context(), id, &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser handles DELETE /scim/v2/Users/:id. The user is deactivated, not deleted.
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	const op = "handlers.SCIMDeleteUser"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scimService.DeactivateUser(c.Request.Context(), id); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups handles GET /scim/v2/Groups. Members are left out when excludedAttributes names them.
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	const op = "handlers.SCIMListGroups"
+
+	startIndex, count := scimPage(c)
+	list, err := h.scimService.ListGroups(c.Request.Context(), c.Query("filter"), startIndex, count, scimWithMembers(c))
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetGroup handles GET /scim/v2/Groups/:id.
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	const op = "handlers.SCIMGetGroup"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+
+	group, err := h.scimService.GetGroup(c.Request.Context(), id, scimWithMembers(c))
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// CreateGroup handles POST /scim/v2/Groups.
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	const op = "handlers.SCIMCreateGroup"
+
+	var req scim.Group
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.CreateGroup(c.Request.Context(), &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.Header("Location", group.Meta.Location)
+	c.JSON(http.StatusCreated, group)
+}
+
+// ReplaceGroup handles PUT /scim/v2/Groups/:id.
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	const op = "handlers.SCIMReplaceGroup"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+	var req scim.Group
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.ReplaceGroup(c.Request.Context(), id, &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// PatchGroup handles PATCH /scim/v2/Groups/:id.
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	const op = "handlers.SCIMPatchGroup"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(c.Request.Context(), id, &req)
+	if err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup handles DELETE /scim/v2/Groups/:id.
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	const op = "handlers.SCIMDeleteGroup"
+
+	id, ok := h.resourceID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scimService.DeleteGroup(c.Request.Context(), id); err != nil {
+		h.respondError(c, op, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// scimPage reads the startIndex and count query parameters. Count is -1 when the request does not
+// ask for a page size; negative counts are treated as zero, which only returns the total.
+func scimPage(c *gin.Context) (int, int) {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+
+	count := -1
+	if n, err := strconv.Atoi(c.Query("count")); err == nil {
+		count = max(n, 0)
+	}
+	return startIndex, count
+}
+
+// scimWithMembers reports whether the request wants the members of groups.
+func scimWithMembers(c *gin.Context) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if scim.NormalizeAttr(strings.TrimSpace(attr)) == "members" {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceID parses the :id path parameter. Ids that are not UUIDs cannot exist, so they are not found.
+func (h *SCIMHandler) resourceID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, scim.NewError(http.StatusNotFound, "", "resource not found"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *SCIMHandler) bind(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, scim.NewError(http.StatusBadRequest, scim.ErrorInvalidSyntax, err.Error()))
+		return false
+	}
+	return true
+}
+
+func (h *SCIMHandler) respondError(c *gin.Context, op string, err error) {
+	var status int
+	var scimType string
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrRoleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrEmailTaken), errors.Is(err, service.ErrRoleNameTaken):
+		status, scimType = http.StatusConflict, scim.ErrorUniqueness
+	case errors.Is(err, scim.ErrInvalidFilter):
+		status, scimType = http.StatusBadRequest, scim.ErrorInvalidFilter
+	case errors.Is(err, scim.ErrInvalidPath):
+		status, scimType = http.StatusBadRequest, scim.ErrorInvalidPath
+	case errors.Is(err, scim.ErrNoTarget):
+		status, scimType = http.StatusBadRequest, scim.ErrorNoTarget
+	case errors.Is(err, scim.ErrInvalidSyntax):
+		status, scimType = http.StatusBadRequest, scim.ErrorInvalidSyntax
+	case errors.Is(err, scim.ErrInvalidValue):
+		status, scimType = http.StatusBadRequest, scim.ErrorInvalidValue
+	default:
+		h.logger.Errorf("%s: %v", op, err)
+		c.JSON(http.StatusInternalServerError, scim.NewError(http.StatusInternalServerError, "", "internal server error"))
+		return
+	}
+
+	c.JSON(status, scim.NewError(status, scimType, err.Error()))
+}
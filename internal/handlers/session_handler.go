@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Nucleussss/auth-service/internal/service"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SessionHandler struct {
+	sessionService service.SessionService
+	logger         logger.Logger
+}
+
+func NewSessionHandler(sessionService service.SessionService, logger logger.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		logger:         logger,
+	}
+}
+
+// ListSessions handles GET /api/sessions and returns the devices the user is signed in on.
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	const op = "handlers.ListSessions"
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	sessionID := c.MustGet("session_id").(uuid.UUID)
+
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		h.logger.Errorf("%s: failed to list sessions for user %s: %v", op, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession handles DELETE /api/sessions/:id and signs out a single device.
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	const op = "handlers.RevokeSession"
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// parse the session ID from the path
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "invalid request",
+			"detail": "invalid session id",
+		})
+		return
+	}
+
+	if err := h.sessionService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "session not found",
+			})
+			return
+		}
+		h.logger.Errorf("%s: failed to revoke session %s: %v", op, sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "internal server error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "session revoked",
+	})
+}
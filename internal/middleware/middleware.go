@@ -1,8 +1,15 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/Nucleussss/auth-service/internal/policy"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/scim"
 	"github.com/Nucleussss/auth-service/internal/utils"
 	"github.com/Nucleussss/auth-service/pkg/logger"
 	"github.com/gin-gonic/gin"
@@ -10,7 +17,8 @@ import (
 )
 
 // JWTMiddleware returns a Gin middleware that adds a `User
-func JWTMiddleware(secretKey string, log logger.Logger) gin.HandlerFunc {
+// Tokens with a restricted scope are rejected unless the scope is listed in allowedScopes.
+func JWTMiddleware(secretKey string, sessionRepo repositories.SessionRepository, log logger.Logger, allowedScopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		op := "middleware.JWTMiddleware"
 
@@ -61,7 +69,336 @@ func JWTMiddleware(secretKey string, log logger.Logger) gin.HandlerFunc {
 			return
 		}
 
+		// restricted tokens only work on the routes that allow their scope
+		scope, _ := (*claims)["scope"].(string)
+		if scope != "" && !slices.Contains(allowedScopes, scope) {
+			log.Errorf("%s: token scope %q is not allowed on %s", op, scope, c.FullPath())
+			c.JSON(403, gin.H{
+				"error": "token is restricted",
+				"scope": scope,
+			})
+			c.Abort()
+			return
+		}
+
+		// get the session_id from the claims
+		sessionIDstr, ok := (*claims)["session_id"].(string)
+		if !ok {
+			log.Errorf("%s: failed to get session_id", op)
+			c.JSON(401, gin.H{
+				"error": "failed to get session_id",
+			})
+			c.Abort()
+			return
+		}
+
+		// parse the session_id from string to UUID
+		sessionID, err := uuid.Parse(sessionIDstr)
+		if err != nil {
+			log.Errorf("%s: failed to parse session_id to uuid", op)
+			c.JSON(401, gin.H{
+				"error": "failed to parse session_id to uuid",
+			})
+			c.Abort()
+			return
+		}
+
+		// make sure the session has not been revoked
+		session, err := sessionRepo.FindActiveByID(c.Request.Context(), sessionID)
+		if err != nil {
+			log.Errorf("%s: failed to find session %s: %v", op, sessionID, err)
+			c.JSON(500, gin.H{
+				"error": "internal server error",
+			})
+			c.Abort()
+			return
+		}
+		if session == nil || session.UserID != userID {
+			log.Errorf("%s: session %s is revoked or expired", op, sessionID)
+			c.JSON(401, gin.H{
+				"error": "session revoked or expired",
+			})
+			c.Abort()
+			return
+		}
+
+		// the organization claim has to match the one the session was signed in to
+		orgID := uuid.Nil
+		if orgIDstr, ok := (*claims)["org_id"].(string); ok {
+			if orgID, err = uuid.Parse(orgIDstr); err != nil {
+				log.Errorf("%s: failed to parse org_id to uuid", op)
+				c.JSON(401, gin.H{
+					"error": "failed to parse org_id to uuid",
+				})
+				c.Abort()
+				return
+			}
+		}
+		if orgID != session.OrgID {
+			log.Errorf("%s: org_id of token does not match session %s", op, sessionID)
+			c.JSON(401, gin.H{
+				"error": "session revoked or expired",
+			})
+			c.Abort()
+			return
+		}
+
+		// impersonation tokens name the admin of their session in the act claim
+		actorID := uuid.Nil
+		if act, ok := (*claims)["act"].(map[string]any); ok {
+			actorStr, _ := act["sub"].(string)
+			if actorID, err = uuid.Parse(actorStr); err != nil {
+				log.Errorf("%s: failed to parse act claim", op)
+				c.JSON(401, gin.H{
+					"error": "invalid act claim",
+				})
+				c.Abort()
+				return
+			}
+		}
+		sessionActorID := uuid.Nil
+		if session.ActorID != nil {
+			sessionActorID = *session.ActorID
+		}
+		if actorID != sessionActorID {
+			log.Errorf("%s: act claim of token does not match session %s", op, sessionID)
+			c.JSON(401, gin.H{
+				"error": "session revoked or expired",
+			})
+			c.Abort()
+			return
+		}
+		if actorID != uuid.Nil {
+			c.Header("X-Impersonated-By", actorID.String())
+		}
+
+		// record the activity on the session
+		if err := sessionRepo.Touch(c.Request.Context(), sessionID); err != nil {
+			log.Errorf("%s: failed to update last seen for session %s: %v", op, sessionID, err)
+		}
+
 		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Set("token_scope", scope)
+		c.Set("org_id", orgID)
+		c.Set("actor_id", actorID)
+		c.Set("token_claims", map[string]any(*claims))
+
+		// scope tenant-filtered repository calls to the active organization
+		if orgID != uuid.Nil {
+			c.Request = c.Request.WithContext(repositories.WithOrganization(c.Request.Context(), orgID))
+		}
+
+		c.Next()
+	}
+}
+
+// DenyImpersonation returns a Gin middleware that refuses impersonation tokens, for routes that only
+// the user themselves may use, like changing the password. It must run after JWTMiddleware.
+func DenyImpersonation(log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := "middleware.DenyImpersonation"
+
+		if actorID := c.MustGet("actor_id").(uuid.UUID); actorID != uuid.Nil {
+			log.Errorf("%s: %s impersonating user %s tried %s", op, actorID, c.MustGet("user_id"), c.FullPath())
+			c.JSON(403, gin.H{
+				"error": "not allowed while impersonating",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission returns a Gin middleware that only lets through users holding the given permission,
+// either through a global role or a role in the token's organization. It must run after JWTMiddleware.
+func RequirePermission(roleRepo repositories.RoleRepository, permission string, log logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := "middleware.RequirePermission"
+
+		userID := c.MustGet("user_id").(uuid.UUID)
+
+		permissions, err := roleRepo.GetUserPermissions(c.Request.Context(), userID)
+		if err != nil {
+			log.Errorf("%s: failed to load permissions for user %s: %v", op, userID, err)
+			c.JSON(500, gin.H{
+				"error": "internal server error",
+			})
+			c.Abort()
+			return
+		}
+
+		if !slices.Contains(permissions, permission) {
+			log.Errorf("%s: user %s lacks permission %s", op, userID, permission)
+			c.JSON(403, gin.H{
+				"error": "forbidden",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// EnforcePolicies returns a Gin middleware that evaluates the attribute-based policies of engine and
+// rejects the requests they deny. Denials of dry-run policies are only logged. The time of day
+// policies see is in loc. It must run after JWTMiddleware.
+func EnforcePolicies(
+	engine *policy.Engine,
+	userRepo repositories.UserRepository,
+	roleRepo repositories.RoleRepository,
+	loc *time.Location,
+	log logger.Logger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := "middleware.EnforcePolicies"
+
+		if engine.Len() == 0 {
+			c.Next()
+			return
+		}
+
+		userID := c.MustGet("user_id").(uuid.UUID)
+		ctx := c.Request.Context()
+
+		user, err := userRepo.FindbyID(ctx, userID)
+		if err != nil {
+			log.Errorf("%s: failed to load user %s: %v", op, userID, err)
+			c.JSON(500, gin.H{
+				"error": "internal server error",
+			})
+			c.Abort()
+			return
+		}
+		roles, err := roleRepo.GetUserRoles(ctx, userID)
+		if err != nil {
+			log.Errorf("%s: failed to load roles for user %s: %v", op, userID, err)
+			c.JSON(500, gin.H{
+				"error": "internal server error",
+			})
+			c.Abort()
+			return
+		}
+		permissions, err := roleRepo.GetUserPermissions(ctx, userID)
+		if err != nil {
+			log.Errorf("%s: failed to load permissions for user %s: %v", op, userID, err)
+			c.JSON(500, gin.H{
+				"error": "internal server error",
+			})
+			c.Abort()
+			return
+		}
+
+		// a role held several ways is listed once
+		roleNames := []string{}
+		for _, r := range roles {
+			if !slices.Contains(roleNames, r.Role) {
+				roleNames = append(roleNames, r.Role)
+			}
+		}
+
+		orgID := c.MustGet("org_id").(uuid.UUID)
+		var org any
+		if orgID != uuid.Nil {
+			org = orgID.String()
+		}
+
+		attrs := map[string]any{
+			"user": map[string]any{
+				"id":             user.ID.String(),
+				"email":          user.Email,
+				"email_verified": user.EmailVerifiedAt != nil,
+				"active":         user.IsActive,
+				"locale":         user.Locale,
+				"roles":          roleNames,
+				"permissions":    permissions,
+			},
+			"token": c.MustGet("token_claims"),
+			"request": map[string]any{
+				"method":     c.Request.Method,
+				"path":       c.Request.URL.Path,
+				"route":      c.FullPath(),
+				"ip":         c.ClientIP(),
+				"user_agent": c.Request.UserAgent(),
+				"org_id":     org,
+			},
+			"env": policy.Environment(time.Now(), loc),
+		}
+
+		decision := engine.Evaluate(attrs)
+		var denied []string
+		for _, v := range decision.Violations {
+			reason := ""
+			if v.Error != "" {
+				reason = ": " + v.Error
+			}
+			if v.DryRun {
+				log.Infof("%s: dry run: policy %s would deny %s %s for user %s%s", op, v.Policy, c.Request.Method, c.Request.URL.Path, userID, reason)
+				continue
+			}
+			log.Errorf("%s: policy %s denies %s %s for user %s%s", op, v.Policy, c.Request.Method, c.Request.URL.Path, userID, reason)
+			denied = append(denied, v.Policy)
+		}
+
+		if !decision.Allowed {
+			c.JSON(403, gin.H{
+				"error":    "forbidden by policy",
+				"policies": denied,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// SCIMAuth returns a Gin middleware that lets through SCIM requests carrying the configured bearer
+// token and makes every response, errors included, use the SCIM media type.
+func SCIMAuth(token string, log logger.Logger) gin.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+
+	return func(c *gin.Context) {
+		op := "middleware.SCIMAuth"
+
+		c.Header("Content-Type", scim.ContentType)
+
+		if !hasBearerToken(c, want) {
+			log.Errorf("%s: invalid SCIM bearer token from %s", op, c.ClientIP())
+			c.JSON(401, scim.NewError(401, "", "invalid bearer token"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MetricsAuth returns a Gin middleware that lets through scrapes carrying the configured bearer token.
+func MetricsAuth(token string, log logger.Logger) gin.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+
+	return func(c *gin.Context) {
+		op := "middleware.MetricsAuth"
+
+		if !hasBearerToken(c, want) {
+			log.Errorf("%s: invalid metrics bearer token from %s", op, c.ClientIP())
+			c.JSON(401, gin.H{"error": "invalid bearer token"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
+
+// hasBearerToken reports whether the request carries a bearer token with the given SHA-256 hash.
+// Comparing hashes keeps the comparison constant-time whatever the length of the sent token.
+func hasBearerToken(c *gin.Context, want [sha256.Size]byte) bool {
+	authHeader := c.GetHeader("Authorization")
+	got := sha256.Sum256([]byte(strings.TrimPrefix(authHeader, "Bearer ")))
+	return strings.HasPrefix(authHeader, "Bearer ") && subtle.ConstantTimeCompare(got[:], want[:]) == 1
+}
@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Nucleussss/auth-service/pkg/logger"
+)
+
+// Engine evaluates the policies of a file and picks up changes to the file while running.
+type Engine struct {
+	path   string
+	dryRun bool
+
+	set atomic.Pointer[Set]
+
+	// mu serializes reloads, modTime and size identify the version of the file that was loaded
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewEngine loads the policies of a file. In dry-run mode every policy only reports what it would
+// have denied, whatever the file says.
+func NewEngine(path string, dryRun bool) (*Engine, error) {
+	e := &Engine{path: path, dryRun: dryRun}
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Len returns the number of policies loaded.
+func (e *Engine) Len() int {
+	return len(e.set.Load().Policies)
+}
+
+// DryRun reports whether the engine never denies requests.
+func (e *Engine) DryRun() bool {
+	return e.dryRun
+}
+
+// Reload loads the file again if it changed since the last load and reports whether it did. When the
+// new version is invalid the policies loaded before stay in effect.
+func (e *Engine) Reload() (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false, err
+	}
+	if e.set.Load() != nil && info.ModTime().Equal(e.modTime) && info.Size() == e.size {
+		return false, nil
+	}
+
+	set, err := Load(e.path)
+	if err != nil {
+		return false, err
+	}
+	e.set.Store(set)
+	e.modTime = info.ModTime()
+	e.size = info.Size()
+	return true, nil
+}
+
+// Watch checks the file for changes on every interval until ctx is cancelled.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration, log logger.Logger) {
+	const op = "policy.Watch"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := e.Reload()
+		if err != nil {
+			log.Errorf("%s: Failed to reload %s, keeping the previous policies: %v", op, e.path, err)
+			continue
+		}
+		if reloaded {
+			log.Infof("%s: Reloaded %d policies from %s", op, e.Len(), e.path)
+		}
+	}
+}
+
+// Evaluate decides a request with the given attributes.
+func (e *Engine) Evaluate(attrs map[string]any) Decision {
+	decision := e.set.Load().Evaluate(attrs)
+	if e.dryRun {
+		decision.Allowed = true
+		for i := range decision.Violations {
+			decision.Violations[i].DryRun = true
+		}
+	}
+	return decision
+}
+
+// Environment returns the env attributes for a request made at now, with the time of day in loc.
+func Environment(now time.Time, loc *time.Location) map[string]any {
+	now = now.In(loc)
+	return map[string]any{
+		"time":     now.Format(time.RFC3339),
+		"date":     now.Format(time.DateOnly),
+		"hour":     now.Hour(),
+		"minute":   now.Minute(),
+		"weekday":  int(now.Weekday()),
+		"timezone": loc.String(),
+	}
+}
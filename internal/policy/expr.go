@@ -0,0 +1,640 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var ErrSyntax = errors.New("syntax error")
+
+// Expr is a compiled expression. Evaluating it never changes it, so it is safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Compile parses an expression.
+func Compile(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q at %d", p.peek().text, p.peek().pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Eval evaluates the expression against vars. The result has to be a boolean.
+func (e *Expr) Eval(vars map[string]any) (bool, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression is %s, not bool", typeName(v))
+	}
+	return b, nil
+}
+
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+// parser is a recursive descent parser. From lowest to highest precedence: ||, &&, comparisons
+// and in, then ! and finally field access, calls and literals.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the punctuation or keyword text.
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %q at %d", text, p.peek().pos)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	n, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at %d", t.pos)
+			}
+			n = &fieldNode{operand: n, field: t.text}
+		case p.accept("["):
+			index, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{operand: n, index: index}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literalNode{value: t.num}, nil
+	case tokString:
+		return &literalNode{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.accept("(") {
+			return p.call(t)
+		}
+		return &varNode{name: t.text}, nil
+	case tokPunct:
+		switch t.text {
+		case "(":
+			n, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			list := &listNode{}
+			for !p.accept("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// call parses the arguments of a function whose name and "(" have been consumed.
+func (p *parser) call(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s at %d", name.text, name.pos)
+	}
+
+	var args []node
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name.text, fn.arity, len(args))
+	}
+
+	// patterns written as literals are compiled once, here
+	if name.text == "matches" {
+		if lit, ok := args[1].(*literalNode); ok {
+			s, ok := lit.value.(string)
+			if !ok {
+				return nil, errors.New("matches takes a string pattern")
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", s, err)
+			}
+			args[1] = &literalNode{value: re}
+		}
+	}
+
+	return &callNode{name: name.text, fn: fn.call, args: args}, nil
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(map[string]any) (any, error) {
+	return n.value, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(vars map[string]any) (any, error) {
+	list := make([]any, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+// varNode is a top level attribute such as user or request. Unknown names are errors, as they are
+// most likely typos.
+type varNode struct {
+	name string
+}
+
+func (n *varNode) eval(vars map[string]any) (any, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown attribute %s", n.name)
+	}
+	return normalize(v), nil
+}
+
+// fieldNode reads a field of an object. Missing fields, and fields of null, are null.
+type fieldNode struct {
+	operand node
+	field   string
+}
+
+func (n *fieldNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch m := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		return normalize(m[n.field]), nil
+	}
+	return nil, fmt.Errorf("cannot read field %s of %s", n.field, typeName(v))
+}
+
+// indexNode reads a field of an object by a computed name, or an element of a list.
+type indexNode struct {
+	operand node
+	index   node
+}
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot index object with %s", typeName(index))
+		}
+		return normalize(c[key]), nil
+	case []any:
+		i, ok := index.(float64)
+		if !ok || i != float64(int(i)) {
+			return nil, fmt.Errorf("cannot index list with %s", typeName(index))
+		}
+		if int(i) < 0 || int(i) >= len(c) {
+			return nil, nil
+		}
+		return normalize(c[int(i)]), nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(v))
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", typeName(v))
+	}
+	return !b, nil
+}
+
+// logicalNode is && or ||. The right operand is only evaluated when it decides the result.
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicalNode) eval(vars map[string]any) (any, error) {
+	left, err := n.operand(n.left, vars)
+	if err != nil {
+		return nil, err
+	}
+	// true || x and false && x are decided by the left operand alone
+	if left == n.or {
+		return left, nil
+	}
+	return n.operand(n.right, vars)
+}
+
+func (n *logicalNode) operand(operand node, vars map[string]any) (bool, error) {
+	v, err := operand.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		op := "&&"
+		if n.or {
+			op = "||"
+		}
+		return false, fmt.Errorf("operand of %s is %s, not bool", op, typeName(v))
+	}
+	return b, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(vars map[string]any) (any, error) {
+	a, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	case "in":
+		return contains(b, a)
+	}
+
+	// ordering is defined between numbers and between strings
+	var cmp int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %s", typeName(b))
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %s", typeName(b))
+		}
+		cmp = strings.Compare(x, y)
+	default:
+		return nil, fmt.Errorf("cannot order %s", typeName(a))
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   func(args []any) (any, error)
+	args []node
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
+
+type function struct {
+	arity int
+	call  func(args []any) (any, error)
+}
+
+// functions are the functions expressions may call.
+var functions = map[string]function{
+	"startsWith": {2, stringFunc(strings.HasPrefix)},
+	"endsWith":   {2, stringFunc(strings.HasSuffix)},
+	"matches": {2, func(args []any) (any, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot match %s", typeName(args[0]))
+		}
+		switch pattern := args[1].(type) {
+		case *regexp.Regexp:
+			return pattern.MatchString(s), nil
+		case string:
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(s), nil
+		}
+		return nil, fmt.Errorf("pattern is %s, not string", typeName(args[1]))
+	}},
+	"size": {1, func(args []any) (any, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len(v)), nil
+		case []any:
+			return float64(len(v)), nil
+		case map[string]any:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("%s has no size", typeName(args[0]))
+	}},
+}
+
+func stringFunc(f func(s, arg string) bool) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		s, ok1 := args[0].(string)
+		arg, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("takes strings, got %s and %s", typeName(args[0]), typeName(args[1]))
+		}
+		return f(s, arg), nil
+	}
+}
+
+// contains implements "item in collection": membership of a list, a key of an object or a
+// substring of a string.
+func contains(collection, item any) (bool, error) {
+	switch c := collection.(type) {
+	case []any:
+		for _, v := range c {
+			if equal(normalize(v), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		key, ok := item.(string)
+		if !ok {
+			return false, nil
+		}
+		_, ok = c[key]
+		return ok, nil
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot look for %s in a string", typeName(item))
+		}
+		return strings.Contains(c, s), nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot look into %s", typeName(collection))
+}
+
+func equal(a, b any) bool {
+	la, ok1 := a.([]any)
+	lb, ok2 := b.([]any)
+	if ok1 && ok2 {
+		if len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !equal(normalize(la[i]), normalize(lb[i])) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// normalize converts the values attributes are built from to the types expressions work with:
+// float64 for numbers, []any for lists and map[string]any for objects.
+func normalize(v any) any {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case []string:
+		list := make([]any, len(x))
+		for i, s := range x {
+			list[i] = s
+		}
+		return list
+	case fmt.Stringer:
+		return x.String()
+	}
+	return v
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
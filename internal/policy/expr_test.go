@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+var testAttrs = map[string]any{
+	"user": map[string]any{
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"roles":          []string{"admin", "contractor"},
+	},
+	"request": map[string]any{"method": "POST", "path": "/api/users"},
+	"env":     map[string]any{"hour": 10, "weekday": 6},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// && binds tighter than ||
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"false && false || true", true},
+		// ! binds tighter than && and comparisons
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"!user.email_verified == false", true},
+		// comparisons bind tighter than && and ||
+		{"1 < 2 && 2 < 1 || 3 >= 3", true},
+		{"env.hour >= 9 && env.hour < 17", true},
+		{"env.weekday >= 1 && env.weekday <= 5", false},
+		{`"contractor" in user.roles`, true},
+		{`"auditor" in user.roles`, false},
+		{`"email" in user`, true},
+		{`"example" in user.email`, true},
+		{`request.method in ["GET", "HEAD"]`, false},
+		{`user["email"] == 'alice@example.com'`, true},
+		{`user.roles[1] == "contractor"`, true},
+		{"user.roles[5] == null", true},
+		{"user.missing.field == null", true},
+		{`startsWith(request.path, "/api/") && endsWith(user.email, "@example.com")`, true},
+		{`matches(user.email, "^[a-z]+@")`, true},
+		{"size(user.roles) == 2", true},
+		// the right operand is not evaluated when the left one decides
+		{"true || nosuch", true},
+		{"false && nosuch", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Compile(tt.src)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			got, err := e.Eval(testAttrs)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		"",
+		`"unterminated`,
+		"user.email == 'unterminated",
+		"true &&",
+		"|| true",
+		"(true",
+		"true)",
+		"[1, 2",
+		"[1 2]",
+		"user.",
+		"user[0",
+		"1 < 2 == true",
+		"true false",
+		"nosuch(1)",
+		"size(1, 2)",
+		`matches(user.email, "(")`,
+		"user.email # 1",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			if _, err := Compile(src); !errors.Is(err, ErrSyntax) {
+				t.Errorf("Compile(%q): err = %v, want ErrSyntax", src, err)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []string{
+		"nosuch",
+		"user.email",
+		"!user.email",
+		"user.email && true",
+		"user.email < 1",
+		"user.roles < 1",
+		"user.email.domain == null",
+		"1 in 2",
+		"size(1) == 0",
+		`startsWith(1, "a")`,
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			e, err := Compile(src)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got, err := e.Eval(testAttrs); err == nil {
+				t.Errorf("Eval = %t, want an error", got)
+			}
+		})
+	}
+}
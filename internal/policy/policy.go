@@ -0,0 +1,154 @@
+// Package policy evaluates attribute-based access policies such as "contractors may only use the
+// API during business hours". A policy applies to the requests its target matches and denies them
+// unless its condition holds. Targets and conditions are expressions over the attributes of a
+// request:
+//
+//	user      id, email, email_verified, active, locale, roles, permissions
+//	token     the claims of the access token, e.g. org_id, scope, permissions
+//	request   method, path, route, ip, user_agent, org_id
+//	env       time, date, hour, minute, weekday (0 is Sunday), timezone
+//
+// Expressions support literals ("text", 'text', 42, true, false, null, [a, b]), field access
+// (user.email, token["org_id"]), the operators ! && || == != < <= > >= and in (membership of a
+// list, key of an object, substring of a string) and the functions startsWith, endsWith,
+// matches (regular expression) and size. For example:
+//
+//	"contractor" in user.roles
+//	env.weekday >= 1 && env.weekday <= 5 && env.hour >= 9 && env.hour < 17
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Policy denies the requests matched by Target unless Condition holds. An empty target matches
+// every request. A dry-run policy only reports what it would have denied.
+type Policy struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Target      string `json:"target,omitempty"`
+	Condition   string `json:"condition"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+
+	target    *Expr
+	condition *Expr
+}
+
+// compile parses the expressions of the policy.
+func (p *Policy) compile() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: policy without a name", ErrInvalidPolicy)
+	}
+	if p.Condition == "" {
+		return fmt.Errorf("%w: policy %s has no condition", ErrInvalidPolicy, p.Name)
+	}
+
+	var err error
+	if p.Target != "" {
+		if p.target, err = Compile(p.Target); err != nil {
+			return fmt.Errorf("%w: target of %s: %v", ErrInvalidPolicy, p.Name, err)
+		}
+	}
+	if p.condition, err = Compile(p.Condition); err != nil {
+		return fmt.Errorf("%w: condition of %s: %v", ErrInvalidPolicy, p.Name, err)
+	}
+	return nil
+}
+
+// Set is a list of policies. A request is allowed when every policy that applies to it allows it.
+type Set struct {
+	Policies []*Policy `json:"policies"`
+}
+
+// NewSet compiles policies into a set.
+func NewSet(policies ...*Policy) (*Set, error) {
+	names := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		if err := p.compile(); err != nil {
+			return nil, err
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("%w: duplicate policy %s", ErrInvalidPolicy, p.Name)
+		}
+		names[p.Name] = true
+	}
+	return &Set{Policies: policies}, nil
+}
+
+// Load reads a set of policies from a JSON file, e.g.
+//
+//	{"policies": [{"name": "contractor-business-hours",
+//	  "target": "\"contractor\" in user.roles",
+//	  "condition": "env.hour >= 9 && env.hour < 17"}]}
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file Set
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	set, err := NewSet(file.Policies...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return set, nil
+}
+
+// Violation is a policy that denies a request.
+type Violation struct {
+	Policy string `json:"policy"`
+	// Error is set when the policy could not be evaluated. Such policies deny the request.
+	Error  string `json:"error,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+// Decision is the outcome of evaluating a set of policies.
+type Decision struct {
+	// Allowed is false when an enforced policy denies the request.
+	Allowed bool
+	// Violations lists every policy denying the request, enforced or dry-run.
+	Violations []Violation
+}
+
+// Evaluate decides a request with the given attributes. Policies that cannot be evaluated, e.g.
+// because an attribute has an unexpected type, deny the request.
+func (s *Set) Evaluate(attrs map[string]any) Decision {
+	decision := Decision{Allowed: true}
+	for _, p := range s.Policies {
+		ok, err := p.allows(attrs)
+		if ok {
+			continue
+		}
+
+		v := Violation{Policy: p.Name, DryRun: p.DryRun}
+		if err != nil {
+			v.Error = err.Error()
+		}
+		decision.Violations = append(decision.Violations, v)
+		if !p.DryRun {
+			decision.Allowed = false
+		}
+	}
+	return decision
+}
+
+func (p *Policy) allows(attrs map[string]any) (bool, error) {
+	if p.target != nil {
+		applies, err := p.target.Eval(attrs)
+		if err != nil {
+			return false, err
+		}
+		if !applies {
+			return true, nil
+		}
+	}
+	return p.condition.Eval(attrs)
+}
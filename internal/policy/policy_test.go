@@ -0,0 +1,103 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func mustSet(t *testing.T, policies ...*Policy) *Set {
+	t.Helper()
+	set, err := NewSet(policies...)
+	if err != nil {
+		t.Fatalf("NewSet: %v", err)
+	}
+	return set
+}
+
+func TestEvaluate(t *testing.T) {
+	verified := &Policy{Name: "verified", Condition: "user.email_verified"}
+	businessHours := &Policy{Name: "business-hours", Target: `"contractor" in user.roles`, Condition: "env.hour >= 9 && env.hour < 17"}
+	weekdays := &Policy{Name: "weekdays", Condition: "env.weekday >= 1 && env.weekday <= 5"}
+	weekdaysDryRun := &Policy{Name: "weekdays", Condition: "env.weekday >= 1 && env.weekday <= 5", DryRun: true}
+	noAdmins := &Policy{Name: "no-admins", Target: `"admin" in user.roles`, Condition: "false", DryRun: true}
+	broken := &Policy{Name: "broken", Condition: "user.email && true"}
+	brokenTarget := &Policy{Name: "broken-target", Target: "user.email", Condition: "true"}
+	notApplying := &Policy{Name: "not-applying", Target: `request.method == "DELETE"`, Condition: "false"}
+
+	tests := []struct {
+		name        string
+		policies    []*Policy
+		wantAllowed bool
+		want        []Violation
+	}{
+		{"no policies", nil, true, nil},
+		{"every policy allows", []*Policy{verified, businessHours}, true, nil},
+		{"target does not match", []*Policy{notApplying}, true, nil},
+		{"one denial overrides the others", []*Policy{verified, weekdays, businessHours}, false, []Violation{{Policy: "weekdays"}}},
+		{"dry-run denials only report", []*Policy{verified, weekdaysDryRun, noAdmins}, true, []Violation{{Policy: "weekdays", DryRun: true}, {Policy: "no-admins", DryRun: true}}},
+		{"enforced denial with dry-run ones", []*Policy{noAdmins, weekdays}, false, []Violation{{Policy: "no-admins", DryRun: true}, {Policy: "weekdays"}}},
+		{"condition error denies", []*Policy{verified, broken}, false, []Violation{{Policy: "broken", Error: "operand of && is string, not bool"}}},
+		{"target error denies", []*Policy{brokenTarget}, false, []Violation{{Policy: "broken-target", Error: "expression is string, not bool"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustSet(t, tt.policies...).Evaluate(testAttrs)
+			if got.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %t, want %t", got.Allowed, tt.wantAllowed)
+			}
+			if !reflect.DeepEqual(got.Violations, tt.want) {
+				t.Errorf("Violations = %+v, want %+v", got.Violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSetErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []*Policy
+	}{
+		{"no name", []*Policy{{Condition: "true"}}},
+		{"no condition", []*Policy{{Name: "empty"}}},
+		{"invalid target", []*Policy{{Name: "bad", Target: "user.", Condition: "true"}}},
+		{"invalid condition", []*Policy{{Name: "bad", Condition: "true &&"}}},
+		{"duplicate name", []*Policy{{Name: "twice", Condition: "true"}, {Name: "twice", Condition: "false"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSet(tt.policies...); !errors.Is(err, ErrInvalidPolicy) {
+				t.Errorf("err = %v, want ErrInvalidPolicy", err)
+			}
+		})
+	}
+}
+
+func TestEngineDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	src := `{"policies": [{"name": "weekdays", "condition": "env.weekday >= 1 && env.weekday <= 5"}]}`
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dryRun      bool
+		wantAllowed bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tt := range tests {
+		e, err := NewEngine(path, tt.dryRun)
+		if err != nil {
+			t.Fatalf("NewEngine: %v", err)
+		}
+		got := e.Evaluate(testAttrs)
+		want := []Violation{{Policy: "weekdays", DryRun: tt.dryRun}}
+		if got.Allowed != tt.wantAllowed || !reflect.DeepEqual(got.Violations, want) {
+			t.Errorf("dry run %t: Evaluate = %+v, want allowed %t with %+v", tt.dryRun, got, tt.wantAllowed, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type AuditLogRepository interface {
+	Create(ctx context.Context, entry *models.AuditLog) error
+	ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]models.AuditLog, error)
+	DeleteOlderThan(ctx context.Context, before time.Time) (int64, error)
+}
+
+type auditLogRepository struct {
+	db *sql.DB
+}
+
+func NewAuditLogRepository(db *sql.DB) AuditLogRepository {
+	return &auditLogRepository{db: db}
+}
+
+// Create adds an entry to the audit log.
+func (r *auditLogRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_logs (user_id, actor_id, org_id, action_type, details)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, entry.UserID, entry.ActorID, entry.OrgID, entry.Action, detailsJSON)
+	return err
+}
+
+// ListByUser returns the latest audit log entries about a user, newest first.
+func (r *auditLogRepository) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]models.AuditLog, error) {
+	query := `
+		SELECT id, user_id, actor_id, org_id, action_type, details, created_at
+		FROM audit_logs
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLog{}
+	for rows.Next() {
+		var entry models.AuditLog
+		var details []byte
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.ActorID, &entry.OrgID, &entry.Action, &details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// DeleteOlderThan removes audit log entries created before the given time.
+func (r *auditLogRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM audit_logs
+		WHERE created_at < $1
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type EmailChangeRepository interface {
+	Create(ctx context.Context, change *models.EmailChange) error
+	FindValidToken(ctx context.Context, tokenHash string) (*models.EmailChange, error)
+	DeleteByUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type emailChangeRepository struct {
+	db *sql.DB
+}
+
+func NewEmailChangeRepository(db *sql.DB) EmailChangeRepository {
+	return &emailChangeRepository{db: db}
+}
+
+// Create stores a pending email change.
+func (r *emailChangeRepository) Create(ctx context.Context, change *models.EmailChange) error {
+	query := `
+		INSERT INTO email_changes (token_hash, user_id, new_email, expired_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		change.TokenHash,
+		change.UserID,
+		change.NewEmail,
+		change.ExpiresAt,
+	)
+	return err
+}
+
+// FindValidToken finds a pending email change that has not expired. It returns nil if there is none.
+func (r *emailChangeRepository) FindValidToken(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	var change models.EmailChange
+	query := `
+		SELECT token_hash, user_id, new_email, expired_at, created_at FROM email_changes
+		WHERE token_hash = $1 AND expired_at >= NOW()
+	`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash).Scan(
+		&change.TokenHash,
+		&change.UserID,
+		&change.NewEmail,
+		&change.ExpiresAt,
+		&change.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+// DeleteByUser removes every pending email change of a user.
+func (r *emailChangeRepository) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		DELETE FROM email_changes
+		WHERE user_id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type EmailOutboxRepository interface {
+	Enqueue(ctx context.Context, email *models.OutboxEmail) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error)
+	MarkSent(ctx context.Context, id uuid.UUID) error
+	MarkFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error
+	MarkDead(ctx context.Context, id uuid.UUID, lastError string) error
+}
+
+type emailOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewEmailOutboxRepository(db *sql.DB) EmailOutboxRepository {
+	return &emailOutboxRepository{db: db}
+}
+
+// Enqueue adds an email to the outbox. An email with the same idempotency key is only stored once.
+func (r *emailOutboxRepository) Enqueue(ctx context.Context, email *models.OutboxEmail) error {
+	payload, err := json.Marshal(email.Payload)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO email_outbox (idempotency_key, kind, recipient, payload)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (idempotency_key) DO NOTHING
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query,
+		email.IdempotencyKey,
+		email.Kind,
+		email.Recipient,
+		payload,
+	)
+	return err
+}
+
+// ClaimDue picks up to limit pending emails that are due and hides them from other dispatchers for
+// the lease duration, counting the attempt. Rows locked by a concurrent claim are skipped.
+func (r *emailOutboxRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, idempotency_key, kind, recipient, payload, status, attempts,
+			next_attempt_at, COALESCE(last_error, ''), created_at
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []models.OutboxEmail
+	for rows.Next() {
+		var email models.OutboxEmail
+		var payload []byte
+		if err := rows.Scan(
+			&email.ID,
+			&email.IdempotencyKey,
+			&email.Kind,
+			&email.Recipient,
+			&payload,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&email.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(payload, &email.Payload); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+// MarkSent records that an email was delivered. The payload is cleared since it may hold tokens.
+func (r *emailOutboxRepository) MarkSent(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), last_error = NULL, payload = '{}'
+		WHERE id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed records a failed attempt and when to try again.
+func (r *emailOutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE email_outbox
+		SET last_error = $2, next_attempt_at = $3
+		WHERE id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, lastError, nextAttemptAt)
+	return err
+}
+
+// MarkDead moves an email to the dead-letter state after its last attempt failed.
+// The payload is cleared since it may hold tokens.
+func (r *emailOutboxRepository) MarkDead(ctx context.Context, id uuid.UUID, lastError string) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'dead', last_error = $2, payload = '{}'
+		WHERE id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, lastError)
+	return err
+}
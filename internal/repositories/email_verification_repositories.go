@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, verification *models.EmailVerification) error
+	Consume(ctx context.Context, tokenHash string) (*models.EmailVerification, error)
+	DeleteByUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type emailVerificationRepository struct {
+	db *sql.DB
+}
+
+func NewEmailVerificationRepository(db *sql.DB) EmailVerificationRepository {
+	return &emailVerificationRepository{db: db}
+}
+
+// Create stores an outstanding email verification.
+func (r *emailVerificationRepository) Create(ctx context.Context, verification *models.EmailVerification) error {
+	query := `
+		INSERT INTO email_verifications (token_hash, user_id, expired_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		verification.TokenHash,
+		verification.UserID,
+		verification.ExpiresAt,
+	)
+	return err
+}
+
+// Consume deletes a valid verification token and returns it. It returns nil if the token does not exist or has expired.
+func (r *emailVerificationRepository) Consume(ctx context.Context, tokenHash string) (*models.EmailVerification, error) {
+	var verification models.EmailVerification
+	query := `
+		DELETE FROM email_verifications
+		WHERE token_hash = $1 AND expired_at >= NOW()
+		RETURNING token_hash, user_id, expired_at, created_at
+	`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash).Scan(
+		&verification.TokenHash,
+		&verification.UserID,
+		&verification.ExpiresAt,
+		&verification.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+// DeleteByUser removes every verification token of a user.
+func (r *emailVerificationRepository) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		DELETE FROM email_verifications
+		WHERE user_id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,344 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// GroupRepository stores the groups of an organization. Every call is tenant-scoped to the
+// organization carried by ctx and never sees the groups of another organization.
+type GroupRepository interface {
+	Create(ctx context.Context, group *models.Group) error
+	List(ctx context.Context) ([]models.Group, error)
+	FindByID(ctx context.Context, id uuid.UUID) (*models.Group, error)
+	Update(ctx context.Context, group *models.Group) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+
+	ListMembers(ctx context.Context, groupID uuid.UUID) ([]models.GroupMember, error)
+	AddMember(ctx context.Context, groupID, userID uuid.UUID) error
+	RemoveMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error)
+
+	AddSubgroup(ctx context.Context, parentID, childID uuid.UUID) error
+	RemoveSubgroup(ctx context.Context, parentID, childID uuid.UUID) (bool, error)
+	IsDescendant(ctx context.Context, groupID, ancestorID uuid.UUID) (bool, error)
+
+	AssignRole(ctx context.Context, groupID uuid.UUID, roleName string) error
+	UnassignRole(ctx context.Context, groupID uuid.UUID, roleName string) (bool, error)
+}
+
+type groupRepository struct {
+	db *sql.DB
+}
+
+func NewGroupRepository(db *sql.DB) GroupRepository {
+	return &groupRepository{db: db}
+}
+
+const groupColumns = `
+	g.id, g.org_id, g.name, g.description,
+	ARRAY(
+		SELECT ro.role_name FROM group_roles gr
+		JOIN roles ro ON ro.id = gr.role_id
+		WHERE gr.group_id = g.id
+		ORDER BY ro.role_name
+	),
+	ARRAY(SELECT child_id FROM group_subgroups WHERE parent_id = g.id ORDER BY child_id),
+	(SELECT COUNT(*) FROM group_members WHERE group_id = g.id),
+	g.created_at, g.updated_at
+`
+
+func scanGroup(row rowScanner) (*models.Group, error) {
+	var group models.Group
+	err := row.Scan(
+		&group.ID,
+		&group.OrgID,
+		&group.Name,
+		&group.Description,
+		pq.Array(&group.Roles),
+		pq.Array(&group.SubgroupIDs),
+		&group.MemberCount,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+	)
+	return &group, err
+}
+
+// Create inserts a group into the organization and fills in its ID, organization and timestamps.
+func (r *groupRepository) Create(ctx context.Context, group *models.Group) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO groups (org_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, org_id, created_at, updated_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, orgID, group.Name, group.Description).
+		Scan(&group.ID, &group.OrgID, &group.CreatedAt, &group.UpdatedAt)
+}
+
+// List lists the groups of the organization by name.
+func (r *groupRepository) List(ctx context.Context) ([]models.Group, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + groupColumns + ` FROM groups g WHERE g.org_id = $1 ORDER BY g.name`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+
+	return groups, rows.Err()
+}
+
+// FindByID finds a group of the organization. It returns nil if there is none.
+func (r *groupRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + groupColumns + ` FROM groups g WHERE g.id = $1 AND g.org_id = $2`
+
+	group, err := scanGroup(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// Update changes the name and description of a group and reports whether it existed.
+func (r *groupRepository) Update(ctx context.Context, group *models.Group) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		UPDATE groups
+		SET name = $3, description = $4, updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, group.ID, orgID, group.Name, group.Description)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Delete removes a group along with its memberships and reports whether it existed.
+func (r *groupRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `DELETE FROM groups WHERE id = $1 AND org_id = $2`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListMembers lists the users added to a group directly, oldest first.
+func (r *groupRepository) ListMembers(ctx context.Context, groupID uuid.UUID) ([]models.GroupMember, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT u.id, u.name, u.email, gm.created_at
+		FROM group_members gm
+		JOIN groups g ON g.id = gm.group_id
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = $1 AND g.org_id = $2
+		ORDER BY gm.created_at, u.id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, groupID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.GroupMember{}
+	for rows.Next() {
+		var m models.GroupMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember adds a user to a group of the organization. Adding an existing member does nothing.
+func (r *groupRepository) AddMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO group_members (group_id, user_id)
+		SELECT id, $2 FROM groups WHERE id = $1 AND org_id = $3
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, groupID, userID, orgID)
+	return err
+}
+
+// RemoveMember removes a user from a group and reports whether they were a member.
+func (r *groupRepository) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM group_members gm
+		USING groups g
+		WHERE g.id = gm.group_id AND gm.group_id = $1 AND gm.user_id = $2 AND g.org_id = $3
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, groupID, userID, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// AddSubgroup nests a group inside another group of the organization. Nesting it again does nothing.
+// Callers check with IsDescendant that this does not create a cycle.
+func (r *groupRepository) AddSubgroup(ctx context.Context, parentID, childID uuid.UUID) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO group_subgroups (parent_id, child_id)
+		SELECT p.id, c.id FROM groups p, groups c
+		WHERE p.id = $1 AND c.id = $2 AND p.org_id = $3 AND c.org_id = $3
+		ON CONFLICT (parent_id, child_id) DO NOTHING
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, parentID, childID, orgID)
+	return err
+}
+
+// RemoveSubgroup takes a group out of another and reports whether it was nested there.
+func (r *groupRepository) RemoveSubgroup(ctx context.Context, parentID, childID uuid.UUID) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM group_subgroups gs
+		USING groups g
+		WHERE g.id = gs.parent_id AND gs.parent_id = $1 AND gs.child_id = $2 AND g.org_id = $3
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, parentID, childID, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// IsDescendant reports whether groupID is nested, directly or through other groups, inside ancestorID.
+func (r *groupRepository) IsDescendant(ctx context.Context, groupID, ancestorID uuid.UUID) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// UNION rather than UNION ALL stops the walk at groups already seen
+	query := `
+		WITH RECURSIVE descendants AS (
+			SELECT gs.child_id AS id FROM group_subgroups gs
+			JOIN groups g ON g.id = gs.parent_id
+			WHERE gs.parent_id = $2 AND g.org_id = $3
+			UNION
+			SELECT gs.child_id FROM group_subgroups gs
+			JOIN descendants d ON gs.parent_id = d.id
+		)
+		SELECT EXISTS(SELECT 1 FROM descendants WHERE id = $1)
+	`
+	var exists bool
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, groupID, ancestorID, orgID).Scan(&exists)
+	return exists, err
+}
+
+// AssignRole grants a role of the organization to a group. Roles of other organizations and global
+// roles are never matched.
+func (r *groupRepository) AssignRole(ctx context.Context, groupID uuid.UUID, roleName string) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO group_roles (group_id, role_id)
+		SELECT g.id, ro.id FROM groups g
+		JOIN roles ro ON ro.org_id = g.org_id AND ro.role_name = $2
+		WHERE g.id = $1 AND g.org_id = $3
+		ON CONFLICT (group_id, role_id) DO NOTHING
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, groupID, roleName, orgID)
+	return err
+}
+
+// UnassignRole takes a role away from a group and reports whether the group had it.
+func (r *groupRepository) UnassignRole(ctx context.Context, groupID uuid.UUID, roleName string) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM group_roles gr
+		USING groups g, roles ro
+		WHERE g.id = gr.group_id AND ro.id = gr.role_id
+			AND gr.group_id = $1 AND ro.role_name = $2 AND g.org_id = $3
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, groupID, roleName, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type KnownDeviceRepository interface {
+	HasAny(ctx context.Context, userID uuid.UUID) (bool, error)
+	IsKnownDevice(ctx context.Context, userID uuid.UUID, deviceHash string) (bool, error)
+	IsKnownIP(ctx context.Context, userID uuid.UUID, ipAddress string) (bool, error)
+	Remember(ctx context.Context, userID uuid.UUID, deviceHash, userAgent, ipAddress string) error
+	Forget(ctx context.Context, userID uuid.UUID, deviceHashes []string) error
+}
+
+type knownDeviceRepository struct {
+	db *sql.DB
+}
+
+func NewKnownDeviceRepository(db *sql.DB) KnownDeviceRepository {
+	return &knownDeviceRepository{db: db}
+}
+
+// HasAny reports whether any device has been recorded for the user.
+func (r *knownDeviceRepository) HasAny(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM known_devices WHERE user_id = $1)`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(&exists)
+	return exists, err
+}
+
+// IsKnownDevice reports whether the user has signed in from the device before.
+func (r *knownDeviceRepository) IsKnownDevice(ctx context.Context, userID uuid.UUID, deviceHash string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM known_devices WHERE user_id = $1 AND device_hash = $2)`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, deviceHash).Scan(&exists)
+	return exists, err
+}
+
+// IsKnownIP reports whether the user has signed in from the IP address before.
+func (r *knownDeviceRepository) IsKnownIP(ctx context.Context, userID uuid.UUID, ipAddress string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM known_login_ips WHERE user_id = $1 AND ip_address = $2)`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, ipAddress).Scan(&exists)
+	return exists, err
+}
+
+// Remember records a sign-in from the device and IP address, updating when they were last seen.
+func (r *knownDeviceRepository) Remember(ctx context.Context, userID uuid.UUID, deviceHash, userAgent, ipAddress string) error {
+	db := conn(ctx, r.db)
+
+	query := `
+		INSERT INTO known_devices (user_id, device_hash, user_agent, last_ip)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, device_hash)
+		DO UPDATE SET user_agent = EXCLUDED.user_agent, last_ip = EXCLUDED.last_ip, last_seen_at = NOW()
+	`
+	if _, err := db.ExecContext(ctx, query, userID, deviceHash, userAgent, ipAddress); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO known_login_ips (user_id, ip_address)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, ip_address)
+		DO UPDATE SET last_seen_at = NOW()
+	`
+	_, err := db.ExecContext(ctx, query, userID, ipAddress)
+	return err
+}
+
+// Forget removes devices so the next sign-in from them is treated as new.
+func (r *knownDeviceRepository) Forget(ctx context.Context, userID uuid.UUID, deviceHashes []string) error {
+	query := `
+		DELETE FROM known_devices
+		WHERE user_id = $1 AND device_hash = ANY($2)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, pq.Array(deviceHashes))
+	return err
+}
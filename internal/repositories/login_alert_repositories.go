@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/lib/pq"
+)
+
+type LoginAlertRepository interface {
+	Create(ctx context.Context, alert *models.LoginAlert) error
+	Consume(ctx context.Context, tokenHash string) (*models.LoginAlert, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type loginAlertRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAlertRepository(db *sql.DB) LoginAlertRepository {
+	return &loginAlertRepository{db: db}
+}
+
+// Create stores the token of a new-login alert.
+func (r *loginAlertRepository) Create(ctx context.Context, alert *models.LoginAlert) error {
+	query := `
+		INSERT INTO login_alerts (token_hash, user_id, session_id, device_hashes, expired_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		alert.TokenHash,
+		alert.UserID,
+		alert.SessionID,
+		pq.Array(alert.DeviceHashes),
+		alert.ExpiresAt,
+	)
+	return err
+}
+
+// Consume deletes a valid alert token and returns it. It returns nil if the token does not exist or has expired.
+func (r *loginAlertRepository) Consume(ctx context.Context, tokenHash string) (*models.LoginAlert, error) {
+	var alert models.LoginAlert
+	query := `
+		DELETE FROM login_alerts
+		WHERE token_hash = $1 AND expired_at >= NOW()
+		RETURNING token_hash, user_id, session_id, device_hashes, expired_at, created_at
+	`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash).Scan(
+		&alert.TokenHash,
+		&alert.UserID,
+		&alert.SessionID,
+		pq.Array(&alert.DeviceHashes),
+		&alert.ExpiresAt,
+		&alert.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+// DeleteExpired removes alert tokens past their expiry and returns how many were deleted.
+func (r *loginAlertRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM login_alerts WHERE expired_at < NOW()`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
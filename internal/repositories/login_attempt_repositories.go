@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type LoginAttemptRepository interface {
+	Record(ctx context.Context, attempt *models.LoginAttempt) error
+	CountFailuresSince(ctx context.Context, email string, since time.Time) (int, error)
+	LastSuccess(ctx context.Context, userID uuid.UUID) (*models.LoginAttempt, error)
+	RecentSuccessTimes(ctx context.Context, userID uuid.UUID, limit int) ([]time.Time, error)
+	HasSuccessFromPrefix(ctx context.Context, userID uuid.UUID, ipPrefix string) (bool, error)
+	HasSuccessFromCountry(ctx context.Context, userID uuid.UUID, country string) (bool, error)
+	DeleteOlderThan(ctx context.Context, before time.Time) (int64, error)
+}
+
+type loginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) LoginAttemptRepository {
+	return &loginAttemptRepository{db: db}
+}
+
+// Record stores a login attempt.
+func (r *loginAttemptRepository) Record(ctx context.Context, attempt *models.LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (
+			user_id, email, ip_address, ip_prefix, user_agent, device_hash,
+			country, latitude, longitude, outcome, risk_score, risk_reasons
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		attempt.UserID,
+		attempt.Email,
+		attempt.IPAddress,
+		attempt.IPPrefix,
+		attempt.UserAgent,
+		attempt.DeviceHash,
+		attempt.Country,
+		attempt.Latitude,
+		attempt.Longitude,
+		attempt.Outcome,
+		attempt.RiskScore,
+		pq.Array(attempt.RiskReasons),
+	)
+	return err
+}
+
+// CountFailuresSince counts the failed attempts for an email address since the given time.
+func (r *loginAttemptRepository) CountFailuresSince(ctx context.Context, email string, since time.Time) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*) FROM login_attempts
+		WHERE email = $1 AND outcome = 'failure' AND created_at >= $2
+	`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, email, since).Scan(&count)
+	return count, err
+}
+
+// LastSuccess returns the most recent successful login of a user. It returns nil if there is none.
+func (r *loginAttemptRepository) LastSuccess(ctx context.Context, userID uuid.UUID) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	query := `
+		SELECT id, user_id, email, COALESCE(ip_address, ''), COALESCE(ip_prefix, ''), COALESCE(user_agent, ''),
+			COALESCE(device_hash, ''), country, latitude, longitude, outcome, risk_score, risk_reasons, created_at
+		FROM login_attempts
+		WHERE user_id = $1 AND outcome = 'success'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(
+		&attempt.ID,
+		&attempt.UserID,
+		&attempt.Email,
+		&attempt.IPAddress,
+		&attempt.IPPrefix,
+		&attempt.UserAgent,
+		&attempt.DeviceHash,
+		&attempt.Country,
+		&attempt.Latitude,
+		&attempt.Longitude,
+		&attempt.Outcome,
+		&attempt.RiskScore,
+		pq.Array(&attempt.RiskReasons),
+		&attempt.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// RecentSuccessTimes returns when the latest successful logins of a user happened, newest first.
+func (r *loginAttemptRepository) RecentSuccessTimes(ctx context.Context, userID uuid.UUID, limit int) ([]time.Time, error) {
+	query := `
+		SELECT created_at FROM login_attempts
+		WHERE user_id = $1 AND outcome = 'success'
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+// HasSuccessFromPrefix reports whether the user has logged in successfully from the network range before.
+func (r *loginAttemptRepository) HasSuccessFromPrefix(ctx context.Context, userID uuid.UUID, ipPrefix string) (bool, error) {
+	var exists bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM login_attempts
+			WHERE user_id = $1 AND ip_prefix = $2 AND outcome = 'success'
+		)
+	`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, ipPrefix).Scan(&exists)
+	return exists, err
+}
+
+// HasSuccessFromCountry reports whether the user has logged in successfully from the country before.
+func (r *loginAttemptRepository) HasSuccessFromCountry(ctx context.Context, userID uuid.UUID, country string) (bool, error) {
+	var exists bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM login_attempts
+			WHERE user_id = $1 AND country = $2 AND outcome = 'success'
+		)
+	`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, country).Scan(&exists)
+	return exists, err
+}
+
+// DeleteOlderThan removes attempts made before the given time and returns how many were deleted.
+func (r *loginAttemptRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM login_attempts WHERE created_at < $1`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type LoginChallengeRepository interface {
+	Create(ctx context.Context, challenge *models.LoginChallenge) error
+	FindValid(ctx context.Context, id uuid.UUID) (*models.LoginChallenge, error)
+	IncrementAttempts(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type loginChallengeRepository struct {
+	db *sql.DB
+}
+
+func NewLoginChallengeRepository(db *sql.DB) LoginChallengeRepository {
+	return &loginChallengeRepository{db: db}
+}
+
+// Create stores a new login challenge.
+func (r *loginChallengeRepository) Create(ctx context.Context, challenge *models.LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (id, user_id, code_hash, expired_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		challenge.ID,
+		challenge.UserID,
+		challenge.CodeHash,
+		challenge.ExpiresAt,
+	)
+	return err
+}
+
+// FindValid finds a challenge that has not expired. It returns nil if there is none.
+func (r *loginChallengeRepository) FindValid(ctx context.Context, id uuid.UUID) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	query := `
+		SELECT id, user_id, code_hash, attempts, expired_at, created_at
+		FROM login_challenges
+		WHERE id = $1 AND expired_at >= NOW()
+	`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.CodeHash,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&challenge.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// IncrementAttempts counts a wrong code entered for the challenge.
+func (r *loginChallengeRepository) IncrementAttempts(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete removes a challenge.
+func (r *loginChallengeRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM login_challenges WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
+
+// DeleteExpired removes challenges past their expiry and returns how many were deleted.
+func (r *loginChallengeRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM login_challenges WHERE expired_at < NOW()`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
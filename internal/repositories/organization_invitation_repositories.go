@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+// OrganizationInvitationRepository stores pending organization invitations. Everything but Consume and
+// DeleteExpired is tenant-scoped to the organization carried by ctx.
+type OrganizationInvitationRepository interface {
+	Create(ctx context.Context, invitation *models.OrganizationInvitation) error
+	ListPending(ctx context.Context) ([]models.OrganizationInvitation, error)
+	FindPending(ctx context.Context, id uuid.UUID) (*models.OrganizationInvitation, error)
+	Renew(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+
+	Consume(ctx context.Context, tokenHash string) (*models.OrganizationInvitation, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type organizationInvitationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationInvitationRepository(db *sql.DB) OrganizationInvitationRepository {
+	return &organizationInvitationRepository{db: db}
+}
+
+const invitationColumns = `
+	i.id, i.org_id, i.email, (SELECT role_name FROM roles WHERE id = i.role_id), i.locale,
+	i.token_hash, i.invited_by, i.expired_at, i.created_at
+`
+
+func scanInvitation(row rowScanner) (*models.OrganizationInvitation, error) {
+	var invitation models.OrganizationInvitation
+	var invitedBy uuid.NullUUID
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.OrgID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.Locale,
+		&invitation.TokenHash,
+		&invitedBy,
+		&invitation.ExpiresAt,
+		&invitation.CreatedAt,
+	)
+	if invitedBy.Valid {
+		invitation.InvitedBy = &invitedBy.UUID
+	}
+	return &invitation, err
+}
+
+// Create stores an invitation to the organization for one of its roles, replacing any earlier
+// invitation of the same address, and fills in its ID, organization and creation time.
+func (r *organizationInvitationRepository) Create(ctx context.Context, invitation *models.OrganizationInvitation) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO organization_invitations (org_id, email, role_id, locale, token_hash, invited_by, expired_at)
+		SELECT $1, $2, id, $4, $5, $6, $7 FROM roles
+		WHERE org_id = $1 AND role_name = $3
+		ON CONFLICT (org_id, email)
+		DO UPDATE SET role_id = EXCLUDED.role_id, locale = EXCLUDED.locale, token_hash = EXCLUDED.token_hash,
+			invited_by = EXCLUDED.invited_by, expired_at = EXCLUDED.expired_at, created_at = NOW()
+		RETURNING id, created_at
+	`
+	invitedBy := uuid.NullUUID{}
+	if invitation.InvitedBy != nil {
+		invitedBy = uuid.NullUUID{UUID: *invitation.InvitedBy, Valid: true}
+	}
+
+	err = conn(ctx, r.db).QueryRowContext(ctx, query,
+		orgID,
+		invitation.Email,
+		invitation.Role,
+		invitation.Locale,
+		invitation.TokenHash,
+		invitedBy,
+		invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	invitation.OrgID = orgID
+	return nil
+}
+
+// ListPending lists the organization's invitations that have not expired, newest first.
+func (r *organizationInvitationRepository) ListPending(ctx context.Context) ([]models.OrganizationInvitation, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + invitationColumns + ` FROM organization_invitations i
+		WHERE i.org_id = $1 AND i.expired_at >= NOW()
+		ORDER BY i.created_at DESC
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.OrganizationInvitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// FindPending finds an invitation of the organization that has not expired. It returns nil if there is none.
+func (r *organizationInvitationRepository) FindPending(ctx context.Context, id uuid.UUID) (*models.OrganizationInvitation, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + invitationColumns + ` FROM organization_invitations i
+		WHERE i.id = $1 AND i.org_id = $2 AND i.expired_at >= NOW()
+	`
+
+	invitation, err := scanInvitation(conn(ctx, r.db).QueryRowContext(ctx, query, id, orgID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// Renew replaces the token of an invitation of the organization and extends its expiry.
+// It reports whether the invitation existed.
+func (r *organizationInvitationRepository) Renew(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		UPDATE organization_invitations
+		SET token_hash = $3, expired_at = $4
+		WHERE id = $1 AND org_id = $2
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, orgID, tokenHash, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Delete revokes an invitation of the organization and reports whether it existed.
+func (r *organizationInvitationRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `DELETE FROM organization_invitations WHERE id = $1 AND org_id = $2`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, orgID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Consume deletes a valid invitation token and returns the invitation. It returns nil if the token
+// does not exist or has expired.
+func (r *organizationInvitationRepository) Consume(ctx context.Context, tokenHash string) (*models.OrganizationInvitation, error) {
+	query := `
+		DELETE FROM organization_invitations i
+		WHERE i.token_hash = $1 AND i.expired_at >= NOW()
+		RETURNING ` + invitationColumns
+
+	invitation, err := scanInvitation(conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// DeleteExpired removes invitations past their expiry and returns how many were deleted.
+func (r *organizationInvitationRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM organization_invitations WHERE expired_at < NOW()`
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
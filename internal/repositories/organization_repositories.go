@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// OrganizationRepository stores organizations and their members. Calls that read or change the
+// data of a single organization are tenant-scoped: they act on the organization carried by ctx
+// (see WithOrganization) and return ErrNoOrganization without one.
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *models.Organization) error
+	FindByID(ctx context.Context, orgID uuid.UUID) (*models.Organization, error)
+	IsMember(ctx context.Context, orgID, userID uuid.UUID) (bool, error)
+	DefaultForUser(ctx context.Context, userID uuid.UUID) (uuid.UUID, error)
+	ListForUser(ctx context.Context, userID uuid.UUID) ([]models.OrganizationMembership, error)
+
+	// tenant-scoped
+	CreateRole(ctx context.Context, roleName string, permissions []string) error
+	HasRole(ctx context.Context, roleName string) (bool, error)
+	AddMember(ctx context.Context, userID uuid.UUID) error
+	AssignRole(ctx context.Context, userID uuid.UUID, roleName string) error
+	ListMembers(ctx context.Context) ([]models.OrganizationMember, error)
+}
+
+type organizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// Create inserts an organization and fills in its ID and creation time.
+func (r *organizationRepository) Create(ctx context.Context, org *models.Organization) error {
+	query := `
+		INSERT INTO organizations (name, slug)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+	return conn(ctx, r.db).QueryRowContext(ctx, query, org.Name, org.Slug).Scan(&org.ID, &org.CreatedAt)
+}
+
+// FindByID finds an organization. It returns nil if there is none.
+func (r *organizationRepository) FindByID(ctx context.Context, orgID uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	query := `SELECT id, name, slug, created_at FROM organizations WHERE id = $1`
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, orgID).Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// IsMember reports whether the user belongs to the organization.
+func (r *organizationRepository) IsMember(ctx context.Context, orgID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM organization_members WHERE org_id = $1 AND user_id = $2)`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, orgID, userID).Scan(&exists)
+	return exists, err
+}
+
+// DefaultForUser returns the organization a user signs in to: the one they joined first.
+// It returns uuid.Nil for users without an organization.
+func (r *organizationRepository) DefaultForUser(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	query := `
+		SELECT org_id FROM organization_members
+		WHERE user_id = $1
+		ORDER BY joined_at, org_id
+		LIMIT 1
+	`
+	var orgID uuid.UUID
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	return orgID, err
+}
+
+// ListForUser lists the organizations a user belongs to with the roles they hold in each,
+// and marks the one ctx is scoped to as active.
+func (r *organizationRepository) ListForUser(ctx context.Context, userID uuid.UUID) ([]models.OrganizationMembership, error) {
+	query := `
+		SELECT o.id, o.name, o.slug, o.created_at, m.joined_at,
+			ARRAY(
+				SELECT ro.role_name FROM organization_member_roles mr
+				JOIN roles ro ON ro.id = mr.role_id
+				WHERE mr.org_id = m.org_id AND mr.user_id = m.user_id
+				ORDER BY ro.role_name
+			)
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1
+		ORDER BY m.joined_at, o.id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	active := OrganizationFrom(ctx)
+	memberships := []models.OrganizationMembership{}
+	for rows.Next() {
+		var m models.OrganizationMembership
+		if err := rows.Scan(&m.ID, &m.Name, &m.Slug, &m.CreatedAt, &m.JoinedAt, pq.Array(&m.Roles)); err != nil {
+			return nil, err
+		}
+		m.Active = m.ID == active
+		memberships = append(memberships, m)
+	}
+
+	return memberships, rows.Err()
+}
+
+// CreateRole adds a role to the organization granting the named permissions.
+func (r *organizationRepository) CreateRole(ctx context.Context, roleName string, permissions []string) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH role AS (
+			INSERT INTO roles (role_name, org_id)
+			VALUES ($1, $2)
+			RETURNING id
+		)
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT role.id, p.id FROM role, permissions p
+		WHERE p.permission_name = ANY($3)
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, roleName, orgID, pq.Array(permissions))
+	return err
+}
+
+// HasRole reports whether the organization has a role with the given name.
+func (r *organizationRepository) HasRole(ctx context.Context, roleName string) (bool, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM roles WHERE org_id = $1 AND role_name = $2)`
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, orgID, roleName).Scan(&exists)
+	return exists, err
+}
+
+// AddMember adds a user to the organization. Adding an existing member does nothing.
+func (r *organizationRepository) AddMember(ctx context.Context, userID uuid.UUID) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO organization_members (org_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, orgID, userID)
+	return err
+}
+
+// AssignRole grants a member one of the organization's roles. Roles of other organizations and
+// global roles are never matched.
+func (r *organizationRepository) AssignRole(ctx context.Context, userID uuid.UUID, roleName string) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO organization_member_roles (org_id, user_id, role_id)
+		SELECT $1, $2, id FROM roles
+		WHERE org_id = $1 AND role_name = $3
+		ON CONFLICT DO NOTHING
+	`
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, orgID, userID, roleName)
+	return err
+}
+
+// ListMembers lists the members of the organization with their roles in it, oldest first.
+func (r *organizationRepository) ListMembers(ctx context.Context) ([]models.OrganizationMember, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT u.id, u.name, u.email, m.joined_at,
+			ARRAY(
+				SELECT ro.role_name FROM organization_member_roles mr
+				JOIN roles ro ON ro.id = mr.role_id
+				WHERE mr.org_id = m.org_id AND mr.user_id = m.user_id
+				ORDER BY ro.role_name
+			)
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY m.joined_at, u.id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.OrganizationMember{}
+	for rows.Next() {
+		var m models.OrganizationMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.JoinedAt, pq.Array(&m.Roles)); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type PasswordHistoryRepository interface {
+	Add(ctx context.Context, userID uuid.UUID, passwordHash string) error
+	ListRecent(ctx context.Context, userID uuid.UUID, limit int) ([]models.PasswordHistoryEntry, error)
+	Prune(ctx context.Context, userID uuid.UUID, keep int) error
+}
+
+type passwordHistoryRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordHistoryRepository(db *sql.DB) PasswordHistoryRepository {
+	return &passwordHistoryRepository{db: db}
+}
+
+// Add records a password hash a user has set.
+func (r *passwordHistoryRepository) Add(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `
+		INSERT INTO password_history (user_id, password_hash)
+		VALUES ($1, $2)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, passwordHash)
+	return err
+}
+
+// ListRecent returns the latest password hashes of a user, newest first.
+func (r *passwordHistoryRepository) ListRecent(ctx context.Context, userID uuid.UUID, limit int) ([]models.PasswordHistoryEntry, error) {
+	query := `
+		SELECT id, user_id, password_hash, created_at FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.PasswordHistoryEntry
+	for rows.Next() {
+		var entry models.PasswordHistoryEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.PasswordHash, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Prune deletes all but the latest keep entries of a user.
+func (r *passwordHistoryRepository) Prune(ctx context.Context, userID uuid.UUID, keep int) error {
+	query := `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+		)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, keep)
+	return err
+}
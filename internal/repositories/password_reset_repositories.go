@@ -5,13 +5,16 @@ import (
 	"database/sql"
 
 	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
 )
 
 type PasswordResetRepository interface {
 	Create(ctx context.Context, reset *models.PasswordReset) error
-	FindValidToken(ctx context.Context, token string) (*models.PasswordReset, error)
-	Delete(ctx context.Context, token string) error
-	DeleteExpiresTokens(ctx context.Context) error
+	FindValidToken(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	Consume(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	Delete(ctx context.Context, tokenHash string) error
+	DeleteByUser(ctx context.Context, userID uuid.UUID) error
+	DeleteExpiresTokens(ctx context.Context) (int64, error)
 }
 
 type passwordResetRepository struct {
@@ -25,11 +28,11 @@ func NewPasswordRepository(db *sql.DB) PasswordResetRepository {
 // Create a new password reset record in the database.
 func (r *passwordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
 	query := ` 
-		INSERT INTO password_resets (token, user_id, expired_at) 
+		INSERT INTO password_resets (token_hash, user_id, expired_at) 
 		VALUES ($1, $2, $3)
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		reset.Token,
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		reset.TokenHash,
 		reset.UserID,
 		reset.ExpiresAt,
 	)
@@ -37,15 +40,32 @@ func (r *passwordResetRepository) Create(ctx context.Context, reset *models.Pass
 }
 
 // Find a valid password reset token in the database.
-func (r *passwordResetRepository) FindValidToken(ctx context.Context, token string) (*models.PasswordReset, error) {
-	var reset models.PasswordReset
+func (r *passwordResetRepository) FindValidToken(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	query := `
+		SELECT token_hash, user_id, expired_at, update_time FROM password_resets 
+		WHERE token_hash = $1 AND expired_at >= NOW()
+	`
+
+	return scanPasswordReset(conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash))
+}
+
+// Consume deletes a valid password reset token and returns it, so a token can only be used once.
+// It returns nil if the token does not exist or has expired.
+func (r *passwordResetRepository) Consume(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
 	query := `
-		SELECT * FROM password_resets 
-		WHERE token = $1 AND expired_at >= NOW()
+		DELETE FROM password_resets
+		WHERE token_hash = $1 AND expired_at >= NOW()
+		RETURNING token_hash, user_id, expired_at, update_time
 	`
 
-	err := r.db.QueryRowContext(ctx, query, token).Scan(
-		&reset.Token,
+	return scanPasswordReset(conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash))
+}
+
+func scanPasswordReset(row *sql.Row) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+
+	err := row.Scan(
+		&reset.TokenHash,
 		&reset.UserID,
 		&reset.ExpiresAt,
 		&reset.CreatedAt,
@@ -61,20 +81,34 @@ func (r *passwordResetRepository) FindValidToken(ctx context.Context, token stri
 	return &reset, nil
 }
 
-func (r *passwordResetRepository) Delete(ctx context.Context, token string) error {
+func (r *passwordResetRepository) Delete(ctx context.Context, tokenHash string) error {
 	query := `
 		DELETE FROM password_resets
-		WHERE token = $1
+		WHERE token_hash = $1
 	`
-	_, err := r.db.ExecContext(ctx, query, token)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, tokenHash)
 	return err
 }
 
-func (r *passwordResetRepository) DeleteExpiresTokens(ctx context.Context) error {
+// DeleteByUser removes every reset token of a user.
+func (r *passwordResetRepository) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
 	query := `
 		DELETE FROM password_resets
-		WHERE expired_at <= NOW()
+		WHERE user_id = $1
 	`
-	_, err := r.db.ExecContext(ctx, query)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID)
 	return err
 }
+
+// DeleteExpiresTokens removes expired reset tokens and returns how many were deleted.
+func (r *passwordResetRepository) DeleteExpiresTokens(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM password_resets
+		WHERE expired_at <= NOW()
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/authz"
+)
+
+// relationTupleRepository is the Postgres authz.Store. Tuples are tenant-scoped: every call reads and
+// writes the tuples of the organization carried by ctx only.
+type relationTupleRepository struct {
+	db *sql.DB
+}
+
+func NewRelationTupleRepository(db *sql.DB) authz.Store {
+	return &relationTupleRepository{db: db}
+}
+
+// Write stores tuples in the organization. Writing a tuple that already exists does nothing.
+func (r *relationTupleRepository) Write(ctx context.Context, tuples ...authz.Tuple) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO relation_tuples (org_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING
+	`
+	db := conn(ctx, r.db)
+	for _, t := range tuples {
+		_, err := db.ExecContext(ctx, query,
+			orgID,
+			t.Object.Type,
+			t.Object.ID,
+			t.Relation,
+			t.Subject.Type,
+			t.Subject.ID,
+			t.Subject.Relation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes tuples from the organization.
+func (r *relationTupleRepository) Delete(ctx context.Context, tuples ...authz.Tuple) error {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM relation_tuples
+		WHERE org_id = $1 AND object_type = $2 AND object_id = $3 AND relation = $4
+			AND subject_type = $5 AND subject_id = $6 AND subject_relation = $7
+	`
+	db := conn(ctx, r.db)
+	for _, t := range tuples {
+		_, err := db.ExecContext(ctx, query,
+			orgID,
+			t.Object.Type,
+			t.Object.ID,
+			t.Relation,
+			t.Subject.Type,
+			t.Subject.ID,
+			t.Subject.Relation,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read returns the subjects of the organization's tuples for relation on object.
+func (r *relationTupleRepository) Read(ctx context.Context, object authz.Object, relation string) ([]authz.Subject, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT subject_type, subject_id, subject_relation
+		FROM relation_tuples
+		WHERE org_id = $1 AND object_type = $2 AND object_id = $3 AND relation = $4
+		ORDER BY subject_type, subject_id, subject_relation
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orgID, object.Type, object.ID, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []authz.Subject
+	for rows.Next() {
+		var s authz.Subject
+		if err := rows.Scan(&s.Type, &s.ID, &s.Relation); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, s)
+	}
+
+	return subjects, rows.Err()
+}
+
+// ObjectIDs returns the IDs of the organization's objects of a type that appear in any tuple.
+func (r *relationTupleRepository) ObjectIDs(ctx context.Context, objectType string) ([]string, error) {
+	orgID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT DISTINCT object_id FROM relation_tuples
+		WHERE org_id = $1 AND object_type = $2
+		ORDER BY object_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, orgID, objectType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
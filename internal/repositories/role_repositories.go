@@ -0,0 +1,407 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/scim"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type RoleRepository interface {
+	GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]string, error)
+	GetUserRoles(ctx context.Context, userID uuid.UUID) ([]models.EffectiveRole, error)
+
+	ListSCIMRoles(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Role, int64, error)
+	FindSCIMRole(ctx context.Context, id uuid.UUID) (*models.Role, error)
+	FindGlobalRoleByName(ctx context.Context, name string) (*models.Role, error)
+	CreateSCIMRole(ctx context.Context, name string, externalID *string) (*models.Role, error)
+	UpdateSCIMRole(ctx context.Context, id uuid.UUID, name string, externalID *string) (bool, error)
+	DeleteSCIMRole(ctx context.Context, id uuid.UUID) (bool, error)
+	ListSCIMRoleMembers(ctx context.Context, roleID uuid.UUID) ([]models.RoleMember, error)
+	SetSCIMRoleMembers(ctx context.Context, roleID uuid.UUID, userIDs []uuid.UUID) error
+	ListGlobalRolesForUser(ctx context.Context, userID uuid.UUID) ([]models.Role, error)
+	SyncGlobalRoles(ctx context.Context, userID uuid.UUID, managed, granted []string) error
+	AddGlobalRoles(ctx context.Context, userIDs []uuid.UUID, roles []string) error
+}
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+// userRoleSources defines user_role_sources: the role_id, source and group_id of every role user $1
+// holds through a global role, directly in organization $2, or through a group of organization $2
+// they belong to directly or via a subgroup. $2 may be NULL, leaving only the global roles.
+const userRoleSources = `
+	WITH RECURSIVE user_groups AS (
+		SELECT gm.group_id FROM group_members gm
+		JOIN groups g ON g.id = gm.group_id
+		JOIN organization_members om ON om.org_id = g.org_id AND om.user_id = gm.user_id
+		WHERE gm.user_id = $1 AND g.org_id = $2
+		-- UNION rather than UNION ALL stops at groups already seen, so cycles end the walk
+		UNION
+		SELECT gs.parent_id FROM group_subgroups gs
+		JOIN user_groups ug ON gs.child_id = ug.group_id
+	),
+	user_role_sources AS (
+		SELECT ur.role_id, 'global' AS source, NULL::uuid AS group_id
+		FROM user_roles ur
+		JOIN roles ro ON ro.id = ur.role_id AND ro.org_id IS NULL
+		WHERE ur.user_id = $1
+		UNION
+		SELECT mr.role_id, 'direct', NULL
+		FROM organization_member_roles mr
+		JOIN roles ro ON ro.id = mr.role_id AND ro.org_id = mr.org_id
+		WHERE mr.user_id = $1 AND mr.org_id = $2
+		UNION
+		SELECT gr.role_id, 'group', gr.group_id
+		FROM group_roles gr
+		JOIN user_groups ug ON ug.group_id = gr.group_id
+		JOIN roles ro ON ro.id = gr.role_id AND ro.org_id = $2
+	)
+`
+
+// tenantArg returns the organization ctx is scoped to as a query argument, NULL when there is none.
+func tenantArg(ctx context.Context) uuid.NullUUID {
+	orgID := OrganizationFrom(ctx)
+	return uuid.NullUUID{UUID: orgID, Valid: orgID != uuid.Nil}
+}
+
+// GetUserPermissions returns the names of every permission granted to a user through their global
+// roles, plus the roles they hold in the organization ctx is scoped to, if any, directly or through groups.
+func (r *roleRepository) GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	query := userRoleSources + `
+		SELECT DISTINCT p.permission_name
+		FROM user_role_sources s
+		JOIN role_permissions rp ON rp.role_id = s.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY p.permission_name
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID, tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GetUserRoles returns the roles behind GetUserPermissions, once for every way the user holds them.
+func (r *roleRepository) GetUserRoles(ctx context.Context, userID uuid.UUID) ([]models.EffectiveRole, error) {
+	query := userRoleSources + `
+		SELECT ro.role_name, s.source, s.group_id
+		FROM user_role_sources s
+		JOIN roles ro ON ro.id = s.role_id
+		ORDER BY ro.role_name, s.source, s.group_id
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID, tenantArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.EffectiveRole{}
+	for rows.Next() {
+		var role models.EffectiveRole
+		var groupID uuid.NullUUID
+		if err := rows.Scan(&role.Role, &role.Source, &groupID); err != nil {
+			return nil, err
+		}
+		if groupID.Valid {
+			role.Group = &groupID.UUID
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+const roleColumns = `id, role_name, external_id, scim_managed, created_at, updated_at`
+
+func scanRole(row rowScanner) (*models.Role, error) {
+	var role models.Role
+	err := row.Scan(
+		&role.ID,
+		&role.Name,
+		&role.ExternalID,
+		&role.SCIMManaged,
+		&role.CreatedAt,
+		&role.UpdatedAt,
+	)
+	return &role, err
+}
+
+// scimRoleScope matches the roles SCIM may manage: global roles it created that grant no
+// permissions, so a provisioning client can never hand out admin rights.
+const scimRoleScope = `org_id IS NULL AND scim_managed
+	AND NOT EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role_id = roles.id)`
+
+const scimRoleMembers = `SELECT 1 FROM user_roles ur
+	JOIN users u ON u.id = ur.user_id AND u.scim_managed
+	WHERE ur.role_id = roles.id`
+
+// roleSCIMAttrs are the SCIM attributes global roles can be filtered by when listed as groups.
+var roleSCIMAttrs = map[string]scimAttr{
+	"id":                {column: "id::text", kind: scimExact},
+	"externalid":        {column: "external_id", kind: scimExact},
+	"displayname":       {column: "role_name", kind: scimText},
+	"meta.created":      {column: "created_at", kind: scimTime},
+	"meta.lastmodified": {column: "updated_at", kind: scimTime},
+	"members": {
+		column: "ur.user_id::text",
+		kind:   scimExact,
+		exists: scimRoleMembers,
+	},
+	"members.value": {
+		column: "ur.user_id::text",
+		kind:   scimExact,
+		exists: scimRoleMembers,
+	},
+}
+
+// ListSCIMRoles returns a page of the roles SCIM manages matching a SCIM filter, oldest first, and
+// how many match in total. A nil filter matches every one of them.
+func (r *roleRepository) ListSCIMRoles(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Role, int64, error) {
+	where := "TRUE"
+	var args []any
+	if filter != nil {
+		var err error
+		if where, err = scimWhere(filter, roleSCIMAttrs, &args); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var total int64
+	query := `SELECT COUNT(*) FROM roles WHERE ` + scimRoleScope + ` AND ` + where
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query = `SELECT ` + roleColumns + ` FROM roles WHERE ` + scimRoleScope + ` AND ` + where + `
+		ORDER BY created_at, id
+		OFFSET $` + strconv.Itoa(len(args)+1) + ` LIMIT $` + strconv.Itoa(len(args)+2)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		roles = append(roles, *role)
+	}
+
+	return roles, total, rows.Err()
+}
+
+// FindSCIMRole returns a role SCIM manages, or nil if there is none with the ID.
+func (r *roleRepository) FindSCIMRole(ctx context.Context, id uuid.UUID) (*models.Role, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE id = $1 AND ` + scimRoleScope
+
+	role, err := scanRole(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return role, err
+}
+
+// FindGlobalRoleByName returns the global role with a name, nil when there is none.
+func (r *roleRepository) FindGlobalRoleByName(ctx context.Context, name string) (*models.Role, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE role_name = $1 AND org_id IS NULL`
+
+	role, err := scanRole(conn(ctx, r.db).QueryRowContext(ctx, query, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return role, err
+}
+
+// CreateSCIMRole creates a global role without permissions, managed by SCIM.
+func (r *roleRepository) CreateSCIMRole(ctx context.Context, name string, externalID *string) (*models.Role, error) {
+	query := `
+		INSERT INTO roles (role_name, external_id, scim_managed)
+		VALUES ($1, $2, TRUE)
+		RETURNING ` + roleColumns
+
+	return scanRole(conn(ctx, r.db).QueryRowContext(ctx, query, name, externalID))
+}
+
+// UpdateSCIMRole renames a role SCIM manages and sets its external ID. It reports whether there
+// was such a role.
+func (r *roleRepository) UpdateSCIMRole(ctx context.Context, id uuid.UUID, name string, externalID *string) (bool, error) {
+	query := `
+		UPDATE roles
+		SET role_name = $1, external_id = $2, updated_at = NOW()
+		WHERE id = $3 AND ` + scimRoleScope
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, name, externalID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteSCIMRole removes a role SCIM manages. Its holders are removed by ON DELETE CASCADE.
+func (r *roleRepository) DeleteSCIMRole(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `DELETE FROM roles WHERE id = $1 AND ` + scimRoleScope
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListSCIMRoleMembers returns the users SCIM provisioned that hold a global role.
+func (r *roleRepository) ListSCIMRoleMembers(ctx context.Context, roleID uuid.UUID) ([]models.RoleMember, error) {
+	query := `
+		SELECT u.id, u.name, u.email
+		FROM user_roles ur
+		JOIN users u ON u.id = ur.user_id AND u.scim_managed
+		WHERE ur.role_id = $1
+		ORDER BY u.email
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.RoleMember{}
+	for rows.Next() {
+		var m models.RoleMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// SetSCIMRoleMembers makes exactly the given users, among those SCIM provisioned, hold a global
+// role. Other users keep or lack the role as before; IDs of unknown users are ignored.
+func (r *roleRepository) SetSCIMRoleMembers(ctx context.Context, roleID uuid.UUID, userIDs []uuid.UUID) error {
+	// a nil slice would be passed as NULL, which matches nothing, rather than an empty array
+	if userIDs == nil {
+		userIDs = []uuid.UUID{}
+	}
+	db := conn(ctx, r.db)
+
+	query := `
+		DELETE FROM user_roles
+		WHERE role_id = $1 AND NOT (user_id = ANY($2)) AND user_id IN (SELECT id FROM users WHERE scim_managed)
+	`
+	if _, err := db.ExecContext(ctx, query, roleID, pq.Array(userIDs)); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT id, $1 FROM users WHERE id = ANY($2) AND scim_managed
+		ON CONFLICT DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, roleID, pq.Array(userIDs))
+	return err
+}
+
+// ListGlobalRolesForUser returns the global roles a user holds.
+func (r *roleRepository) ListGlobalRolesForUser(ctx context.Context, userID uuid.UUID) ([]models.Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles
+		WHERE org_id IS NULL AND id IN (SELECT role_id FROM user_roles WHERE user_id = $1)
+		ORDER BY role_name
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+
+	return roles, rows.Err()
+}
+
+// SyncGlobalRoles makes the global roles of a user named in managed match granted, leaving the
+// other roles of the user alone. Names without a global role are skipped.
+func (r *roleRepository) SyncGlobalRoles(ctx context.Context, userID uuid.UUID, managed, granted []string) error {
+	// a nil slice would be passed as NULL, which matches nothing, rather than an empty array
+	if granted == nil {
+		granted = []string{}
+	}
+	db := conn(ctx, r.db)
+
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role_id IN (
+			SELECT id FROM roles
+			WHERE org_id IS NULL AND role_name = ANY($2) AND NOT (role_name = ANY($3))
+		)
+	`
+	if _, err := db.ExecContext(ctx, query, userID, pq.Array(managed), pq.Array(granted)); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM roles WHERE org_id IS NULL AND role_name = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, userID, pq.Array(granted))
+	return err
+}
+
+// AddGlobalRoles gives userIDs[i] the global role named roles[i], for every i, in a single
+// statement. Names without a global role are skipped.
+func (r *roleRepository) AddGlobalRoles(ctx context.Context, userIDs []uuid.UUID, roles []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT a.user_id, ro.id
+		FROM unnest($1::uuid[], $2::text[]) AS a(user_id, role_name)
+		JOIN roles ro ON ro.role_name = a.role_name AND ro.org_id IS NULL
+		ON CONFLICT DO NOTHING
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, pq.Array(userIDs), pq.Array(roles))
+	return err
+}
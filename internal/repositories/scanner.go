@@ -0,0 +1,16 @@
+package repositories
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWithExtra scans the columns after the ones a scan function knows about into extra.
+type scanWithExtra struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s scanWithExtra) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
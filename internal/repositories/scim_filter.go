@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/scim"
+)
+
+type scimKind int
+
+const (
+	// scimText compares case-insensitively, scimExact case-sensitively
+	scimText scimKind = iota
+	scimExact
+	scimBool
+	scimTime
+)
+
+// scimAttr maps a SCIM attribute onto the SQL expression holding it.
+type scimAttr struct {
+	column string
+	kind   scimKind
+	// exists is set for multi-valued attributes kept in another table: a subquery, ending in a
+	// WHERE clause, that the comparison is added to.
+	exists string
+}
+
+// scimWhere translates a filter into a SQL condition, appending its arguments to args. Attributes
+// missing from attrs make the filter invalid.
+func scimWhere(f scim.Filter, attrs map[string]scimAttr, args *[]any) (string, error) {
+	switch f := f.(type) {
+	case *scim.And:
+		return scimJoin(f.Left, f.Right, "AND", attrs, args)
+	case *scim.Or:
+		return scimJoin(f.Left, f.Right, "OR", attrs, args)
+	case *scim.Not:
+		cond, err := scimWhere(f.Filter, attrs, args)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + cond + ")", nil
+	case *scim.Present:
+		attr, ok := attrs[f.Attr]
+		if !ok {
+			return "", fmt.Errorf("%w: unsupported attribute %s", scim.ErrInvalidFilter, f.Attr)
+		}
+		return attr.wrap(fmt.Sprintf("(%s IS NOT NULL AND %s::text <> '')", attr.column, attr.column)), nil
+	case *scim.Compare:
+		attr, ok := attrs[f.Attr]
+		if !ok {
+			return "", fmt.Errorf("%w: unsupported attribute %s", scim.ErrInvalidFilter, f.Attr)
+		}
+		cond, err := attr.compare(f.Op, f.Value, args)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", scim.ErrInvalidFilter, f.Attr, err)
+		}
+		return attr.wrap(cond), nil
+	}
+	return "", fmt.Errorf("%w: unsupported filter", scim.ErrInvalidFilter)
+}
+
+func scimJoin(left, right scim.Filter, op string, attrs map[string]scimAttr, args *[]any) (string, error) {
+	l, err := scimWhere(left, attrs, args)
+	if err != nil {
+		return "", err
+	}
+	r, err := scimWhere(right, attrs, args)
+	if err != nil {
+		return "", err
+	}
+	return "(" + l + " " + op + " " + r + ")", nil
+}
+
+func (a scimAttr) wrap(cond string) string {
+	if a.exists == "" {
+		return cond
+	}
+	return "EXISTS (" + a.exists + " AND " + cond + ")"
+}
+
+func (a scimAttr) compare(op string, value any, args *[]any) (string, error) {
+	if value == nil {
+		switch op {
+		case "eq":
+			return a.column + " IS NULL", nil
+		case "ne":
+			return a.column + " IS NOT NULL", nil
+		}
+		return "", fmt.Errorf("%s null is not supported", op)
+	}
+
+	placeholder := func(v any) string {
+		*args = append(*args, v)
+		return "$" + strconv.Itoa(len(*args))
+	}
+	sqlOps := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+	switch a.kind {
+	case scimBool:
+		b, ok := value.(bool)
+		if !ok || (op != "eq" && op != "ne") {
+			return "", fmt.Errorf("only eq and ne with true or false are supported")
+		}
+		return a.column + " " + sqlOps[op] + " " + placeholder(b), nil
+	case scimTime:
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a date")
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q", s)
+		}
+		sqlOp, ok := sqlOps[op]
+		if !ok {
+			return "", fmt.Errorf("%s is not supported for dates", op)
+		}
+		return a.column + " " + sqlOp + " " + placeholder(t), nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string")
+	}
+	column := a.column
+	if a.kind == scimText {
+		column = "LOWER(" + column + ")"
+		s = strings.ToLower(s)
+	}
+
+	switch op {
+	case "co":
+		return column + " LIKE " + placeholder("%"+escapeLike(s)+"%"), nil
+	case "sw":
+		return column + " LIKE " + placeholder(escapeLike(s)+"%"), nil
+	case "ew":
+		return column + " LIKE " + placeholder("%"+escapeLike(s)), nil
+	}
+	return column + " " + sqlOps[op] + " " + placeholder(s), nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so s only matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
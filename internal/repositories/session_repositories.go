@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/google/uuid"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindActiveByID(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	Touch(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) (bool, error)
+	DeleteByUser(ctx context.Context, userID uuid.UUID, exceptID uuid.UUID) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+const sessionColumns = `
+	id, user_id, session_token, COALESCE(device, ''), COALESCE(ip_address, ''),
+	COALESCE(user_agent, ''), expires_at, created_at, COALESCE(last_seen_at, created_at),
+	COALESCE(org_id, '00000000-0000-0000-0000-000000000000'), actor_id
+`
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.SessionToken,
+		&session.Device,
+		&session.IPAddress,
+		&session.UserAgent,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.OrgID,
+		&session.ActorID,
+	)
+	return &session, err
+}
+
+// Create a new session record in the database.
+func (r *sessionRepository) Create(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, session_token, device, ip_address, user_agent, expires_at, org_id, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.SessionToken,
+		session.Device,
+		session.IPAddress,
+		session.UserAgent,
+		session.ExpiresAt,
+		uuid.NullUUID{UUID: session.OrgID, Valid: session.OrgID != uuid.Nil},
+		session.ActorID,
+	)
+	return err
+}
+
+// FindActiveByID finds a session that has not expired. It returns nil if there is none.
+func (r *sessionRepository) FindActiveByID(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1 AND expires_at > NOW()`
+
+	session, err := scanSession(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ListActiveByUser lists the sessions of a user that have not expired, most recently used first.
+func (r *sessionRepository) ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Touch records that a session was just used. Writes are throttled to once a minute.
+func (r *sessionRepository) Touch(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET last_seen_at = NOW()
+		WHERE id = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete removes a session owned by the given user and reports whether it existed.
+func (r *sessionRepository) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) (bool, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE id = $1 AND user_id = $2
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteByUser removes every session of a user except the one given, which may be uuid.Nil.
+func (r *sessionRepository) DeleteByUser(ctx context.Context, userID uuid.UUID, exceptID uuid.UUID) error {
+	query := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND id <> $2
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, exceptID)
+	return err
+}
+
+// DeleteExpired removes expired sessions and returns how many were deleted.
+func (r *sessionRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE expires_at <= NOW()
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
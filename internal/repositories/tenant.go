@@ -0,0 +1,34 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrNoOrganization is returned by tenant-scoped repository calls made without an organization in the context.
+var ErrNoOrganization = errors.New("no organization in context")
+
+type orgKey struct{}
+
+// WithOrganization scopes repository calls made with the returned context to an organization.
+// Tenant-scoped queries only ever see rows of that organization.
+func WithOrganization(ctx context.Context, orgID uuid.UUID) context.Context {
+	return context.WithValue(ctx, orgKey{}, orgID)
+}
+
+// OrganizationFrom returns the organization ctx is scoped to, or uuid.Nil when there is none.
+func OrganizationFrom(ctx context.Context) uuid.UUID {
+	orgID, _ := ctx.Value(orgKey{}).(uuid.UUID)
+	return orgID
+}
+
+// tenant returns the organization ctx is scoped to, or ErrNoOrganization.
+func tenant(ctx context.Context) (uuid.UUID, error) {
+	orgID := OrganizationFrom(ctx)
+	if orgID == uuid.Nil {
+		return uuid.Nil, ErrNoOrganization
+	}
+	return orgID, nil
+}
@@ -3,17 +3,37 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/scim"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type UserRepository interface {
 	ExistsbyEmail(ctx context.Context, email string) (bool, error)
-	Create(ctx context.Context, user *models.CreateNewUser) error
+	Create(ctx context.Context, user *models.CreateNewUser) (uuid.UUID, error)
 	FindbyEmail(ctx context.Context, email string) (*models.User, error)
 	FindbyID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	UpdatePassword(ctx context.Context, id uuid.UUID, password string) error
+	UpdatePasswordHash(ctx context.Context, id uuid.UUID, password string) error
+	SetMustChangePassword(ctx context.Context, ids []uuid.UUID) (int64, error)
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
+	DeleteUnverifiedBefore(ctx context.Context, before time.Time) (int64, error)
+	UpdateProfile(ctx context.Context, id uuid.UUID, profile *models.UpdateProfileRequest) error
+	UpdateEmail(ctx context.Context, id uuid.UUID, email string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	ListSCIMUsers(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.User, int64, error)
+	SetActive(ctx context.Context, id uuid.UUID, active bool) error
+	SetExternalID(ctx context.Context, id uuid.UUID, externalID *string) error
+	MarkSCIMManaged(ctx context.Context, id uuid.UUID) error
+	Search(ctx context.Context, search *models.UserSearch) ([]models.User, error)
+	CreateBatch(ctx context.Context, users []models.CreateNewUser) ([]uuid.UUID, error)
+	ExistingEmails(ctx context.Context, emails []string) ([]string, error)
+	ForEachWithRoles(ctx context.Context, fn func(user *models.User, roles []string) error) error
 }
 
 type userRepository struct {
@@ -24,74 +44,408 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-// ExistsbyEmail checks if a user exists by their email address.
+const userColumns = `
+	id, name, email, password_hash, is_active, locale, created_at, updated_at,
+	password_changed_at, must_change_password, email_verified_at, external_id, scim_managed
+`
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.PasswordHash,
+		&user.IsActive,
+		&user.Locale,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.PasswordChangedAt,
+		&user.MustChangePassword,
+		&user.EmailVerifiedAt,
+		&user.ExternalID,
+		&user.SCIMManaged,
+	)
+	return &user, err
+}
+
+// ExistsbyEmail checks if a user exists by their email address, ignoring case.
 func (ur *userRepository) ExistsbyEmail(ctx context.Context, email string) (bool, error) {
 	var exist bool
 
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
-	err := ur.db.QueryRowContext(ctx, query, email).Scan(&exist)
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`
+	err := conn(ctx, ur.db).QueryRowContext(ctx, query, email).Scan(&exist)
 
 	return exist, err
 }
 
-// Create a new user in the database.
-func (ur *userRepository) Create(ctx context.Context, user *models.CreateNewUser) error {
-	var query = `INSERT INTO users (name, email, password_hash) 
-		VALUES ($1, $2, $3)`
+// Create a new user in the database and return its ID.
+func (ur *userRepository) Create(ctx context.Context, user *models.CreateNewUser) (uuid.UUID, error) {
+	var id uuid.UUID
+	var query = `INSERT INTO users (name, email, password_hash, locale) 
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
 
-	_, err := ur.db.ExecContext(ctx,
+	err := conn(ctx, ur.db).QueryRowContext(ctx,
 		query,
 		user.Name,
 		user.Email,
 		user.PasswordHash,
-	)
+		user.Locale,
+	).Scan(&id)
 
-	return err
+	return id, err
 }
 
-// FindbyEmail finds a user by their email address.
+// FindbyEmail finds a user by their email address, ignoring case.
 func (ur *userRepository) FindbyEmail(ctx context.Context, email string) (*models.User, error) {
-	var user models.User
-	query := `SELECT * FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
 
-	err := ur.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.PasswordHash,
-		&user.IsActive,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	return &user, err
+	return scanUser(conn(ctx, ur.db).QueryRowContext(ctx, query, email))
 }
 
 // FindbyID finds a user by their ID.
 func (ur *userRepository) FindbyID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
-	var user models.User
-	query := `SELECT *  FROM users WHERE id = $1`
-
-	err := ur.db.QueryRowContext(ctx, query, userID).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.PasswordHash,
-		&user.IsActive,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
-	return &user, err
+	return scanUser(conn(ctx, ur.db).QueryRowContext(ctx, query, userID))
 }
 
-// UpdatePassword updates a user's password.
+// UpdatePassword updates a user's password and clears any pending forced password change.
 func (r *userRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
 	query := `
 		UPDATE users
-		SET password_hash = $1, updated_at = NOW()
+		SET password_hash = $1, password_changed_at = NOW(), must_change_password = FALSE, updated_at = NOW()
+		WHERE id = $2
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, passwordHash, userID)
+	return err
+}
+
+// UpdatePasswordHash replaces the stored hash of the same password, e.g. after a rehash.
+// Unlike UpdatePassword it does not count as a password change.
+func (r *userRepository) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, passwordHash, userID)
+	return err
+}
+
+// SetMustChangePassword flags users so their next login requires a password change.
+func (r *userRepository) SetMustChangePassword(ctx context.Context, userIDs []uuid.UUID) (int64, error) {
+	query := `
+		UPDATE users
+		SET must_change_password = TRUE, updated_at = NOW()
+		WHERE id = ANY($1)
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UpdateProfile updates the profile fields that are set in the request.
+func (r *userRepository) UpdateProfile(ctx context.Context, userID uuid.UUID, profile *models.UpdateProfileRequest) error {
+	query := `
+		UPDATE users
+		SET name = COALESCE($1, name), locale = COALESCE($2, locale), updated_at = NOW()
+		WHERE id = $3
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, profile.Name, profile.Locale, userID)
+	return err
+}
+
+// UpdateEmail changes a user's email address.
+func (r *userRepository) UpdateEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	query := `
+		UPDATE users
+		SET email = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, email, userID)
+	return err
+}
+
+// Delete removes a user. Rows that reference the user are removed by ON DELETE CASCADE.
+func (r *userRepository) Delete(ctx context.Context, userID uuid.UUID) error {
+	query := `DELETE FROM users WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID)
+	return err
+}
+
+// MarkEmailVerified records that the user proved they own their email address.
+func (r *userRepository) MarkEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID)
+	return err
+}
+
+// DeleteUnverifiedBefore removes accounts created before the given time that never verified their email.
+func (r *userRepository) DeleteUnverifiedBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE email_verified_at IS NULL AND created_at < $1
+	`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// userSCIMAttrs are the SCIM attributes users can be filtered by.
+var userSCIMAttrs = map[string]scimAttr{
+	"id":                {column: "id::text", kind: scimExact},
+	"externalid":        {column: "external_id", kind: scimExact},
+	"username":          {column: "email", kind: scimText},
+	"emails":            {column: "email", kind: scimText},
+	"emails.value":      {column: "email", kind: scimText},
+	"displayname":       {column: "name", kind: scimText},
+	"name.formatted":    {column: "name", kind: scimText},
+	"active":            {column: "is_active", kind: scimBool},
+	"meta.created":      {column: "created_at", kind: scimTime},
+	"meta.lastmodified": {column: "updated_at", kind: scimTime},
+}
+
+// ListSCIMUsers returns a page of the users SCIM provisioned matching a SCIM filter, oldest first,
+// and how many match in total. A nil filter matches every one of them.
+func (r *userRepository) ListSCIMUsers(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.User, int64, error) {
+	where := "TRUE"
+	var args []any
+	if filter != nil {
+		var err error
+		if where, err = scimWhere(filter, userSCIMAttrs, &args); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var total int64
+	query := `SELECT COUNT(*) FROM users WHERE scim_managed AND ` + where
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query = `SELECT ` + userColumns + ` FROM users WHERE scim_managed AND ` + where + `
+		ORDER BY created_at, id
+		OFFSET $` + strconv.Itoa(len(args)+1) + ` LIMIT $` + strconv.Itoa(len(args)+2)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// SetActive activates or deactivates a user. Deactivated users keep their data but cannot sign in.
+func (r *userRepository) SetActive(ctx context.Context, userID uuid.UUID, active bool) error {
+	query := `
+		UPDATE users
+		SET is_active = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, active, userID)
+	return err
+}
+
+// MarkSCIMManaged hands a user over to SCIM.
+func (r *userRepository) MarkSCIMManaged(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE users SET scim_managed = TRUE, updated_at = NOW() WHERE id = $1`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID)
+	return err
+}
+
+// SetExternalID records the identifier the provisioning client uses for a user.
+func (r *userRepository) SetExternalID(ctx context.Context, userID uuid.UUID, externalID *string) error {
+	query := `
+		UPDATE users
+		SET external_id = $1, updated_at = NOW()
 		WHERE id = $2
 	`
-	_, err := r.db.ExecContext(ctx, query, passwordHash, userID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, externalID, userID)
 	return err
 }
+
+// Search returns up to search.Limit users matching the search, newest first. Pages are keyed on
+// created_at and id, so users created while paging do not shift the following pages.
+func (r *userRepository) Search(ctx context.Context, search *models.UserSearch) ([]models.User, error) {
+	var conds []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if search.Prefix != "" {
+		prefix := arg(escapeLike(strings.ToLower(search.Prefix)) + "%")
+		conds = append(conds, "(LOWER(email) LIKE "+prefix+" OR LOWER(name) LIKE "+prefix+")")
+	}
+	if search.Active != nil {
+		conds = append(conds, "is_active = "+arg(*search.Active))
+	}
+	if search.Verified != nil {
+		conds = append(conds, "(email_verified_at IS NOT NULL) = "+arg(*search.Verified))
+	}
+	if search.Role != "" {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM user_roles ur
+			JOIN roles ro ON ro.id = ur.role_id AND ro.org_id IS NULL
+			WHERE ur.user_id = users.id AND ro.role_name = `+arg(search.Role)+`
+		)`)
+	}
+	if search.AfterID != uuid.Nil {
+		conds = append(conds, "(created_at, id) < ("+arg(search.AfterCreatedAt)+", "+arg(search.AfterID)+")")
+	}
+
+	where := "TRUE"
+	if len(conds) > 0 {
+		where = strings.Join(conds, " AND ")
+	}
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ` + arg(search.Limit)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// CreateBatch creates users with verified email addresses in a single statement and returns their
+// IDs in the order of users.
+func (r *userRepository) CreateBatch(ctx context.Context, users []models.CreateNewUser) ([]uuid.UUID, error) {
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, len(users))
+	emails := make([]string, len(users))
+	hashes := make([]string, len(users))
+	locales := make([]string, len(users))
+	for i, user := range users {
+		names[i], emails[i], hashes[i], locales[i] = user.Name, user.Email, user.PasswordHash, user.Locale
+	}
+
+	query := `
+		INSERT INTO users (name, email, password_hash, locale, email_verified_at)
+		SELECT name, email, password_hash, locale, NOW()
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) WITH ORDINALITY
+			AS u(name, email, password_hash, locale, n)
+		ORDER BY n
+		RETURNING id, email
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query,
+		pq.Array(names), pq.Array(emails), pq.Array(hashes), pq.Array(locales))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// RETURNING does not promise any order, so the IDs are matched up by email
+	idsByEmail := make(map[string]uuid.UUID, len(users))
+	for rows.Next() {
+		var id uuid.UUID
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, err
+		}
+		idsByEmail[email] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(users))
+	for i, email := range emails {
+		ids[i] = idsByEmail[email]
+	}
+	return ids, nil
+}
+
+// ExistingEmails returns the emails of the users whose email matches one of emails, which have to
+// be lowercase, ignoring case.
+func (r *userRepository) ExistingEmails(ctx context.Context, emails []string) ([]string, error) {
+	query := `SELECT email FROM users WHERE LOWER(email) = ANY($1)`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, pq.Array(emails))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		existing = append(existing, email)
+	}
+
+	return existing, rows.Err()
+}
+
+// ForEachWithRoles calls fn with every user, oldest first, and the names of their global roles.
+// Rows are read as fn consumes them, so the users never all sit in memory; an error from fn stops
+// the iteration and is returned.
+func (r *userRepository) ForEachWithRoles(ctx context.Context, fn func(user *models.User, roles []string) error) error {
+	query := `
+		SELECT ` + userColumns + `, ARRAY(
+			SELECT ro.role_name FROM user_roles ur
+			JOIN roles ro ON ro.id = ur.role_id AND ro.org_id IS NULL
+			WHERE ur.user_id = users.id
+			ORDER BY ro.role_name
+		)
+		FROM users
+		ORDER BY created_at, id
+	`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roles []string
+		user, err := scanUser(scanWithExtra{rows, []any{pq.Array(&roles)}})
+		if err != nil {
+			return err
+		}
+		if err := fn(user, roles); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,154 @@
+package risk
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type geoRange struct {
+	start, end netip.Addr
+	location   Location
+}
+
+// GeoIPDatabase looks up the location of IP addresses in a local range database.
+type GeoIPDatabase struct {
+	ranges []geoRange
+}
+
+// LoadGeoIPDatabase reads a CSV file of IP ranges. Each row starts with the first and last address
+// of a range, followed by the country code, and ends with the latitude and longitude, e.g.
+//
+//	1.0.0.0,1.0.0.255,AU,-33.494,143.2104
+//
+// Columns in between are ignored, so city-level exports such as DB-IP lite work as they are.
+// Lines starting with # are skipped.
+func LoadGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+
+	db := &GeoIPDatabase{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rng, err := parseGeoRange(record)
+		if err != nil {
+			// a header row is allowed
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+
+	return db, nil
+}
+
+func parseGeoRange(record []string) (geoRange, error) {
+	if len(record) < 5 {
+		return geoRange{}, fmt.Errorf("expected at least 5 columns, got %d", len(record))
+	}
+
+	start, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+	if err != nil {
+		return geoRange{}, err
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+	if err != nil {
+		return geoRange{}, err
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(record[len(record)-2]), 64)
+	if err != nil {
+		return geoRange{}, err
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(record[len(record)-1]), 64)
+	if err != nil {
+		return geoRange{}, err
+	}
+
+	return geoRange{
+		start: start.Unmap(),
+		end:   end.Unmap(),
+		location: Location{
+			Country:   strings.TrimSpace(record[2]),
+			Latitude:  lat,
+			Longitude: lon,
+		},
+	}, nil
+}
+
+// Lookup returns the location of an IP address, or nil if it is not in the database.
+func (db *GeoIPDatabase) Lookup(ip string) *Location {
+	if db == nil {
+		return nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	// the last range starting at or before the address is the only candidate
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	if i < 0 {
+		return nil
+	}
+
+	rng := db.ranges[i]
+	if addr.BitLen() != rng.start.BitLen() || rng.end.Less(addr) {
+		return nil
+	}
+	location := rng.location
+	return &location
+}
+
+// Len returns the number of ranges in the database.
+func (db *GeoIPDatabase) Len() int {
+	return len(db.ranges)
+}
+
+// NetworkPrefix returns the network range an IP address belongs to for comparing logins:
+// the /24 for IPv4 and the /48 for IPv6.
+func NetworkPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
@@ -0,0 +1,106 @@
+// Package risk scores login attempts from facts about the attempt and the account's login history.
+// Rules only look at the Signals they are given, so they can be evaluated with fixed inputs.
+package risk
+
+import (
+	"time"
+)
+
+// Location is where an IP address is, according to the GeoIP database.
+type Location struct {
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+// PastLogin is an earlier successful login of the same account.
+type PastLogin struct {
+	Time     time.Time
+	Location *Location
+}
+
+// Signals are the facts about a login attempt that rules score.
+type Signals struct {
+	// Time is when the attempt was made.
+	Time time.Time
+	// FirstLogin is set when the account has never logged in successfully before, so there
+	// is no history to compare the attempt with.
+	FirstLogin bool
+	// KnownDevice is set when the account has logged in from the device before.
+	KnownDevice bool
+	// KnownIPRange is set when the account has logged in from the same network range before.
+	KnownIPRange bool
+	// KnownCountry is set when the account has logged in from the country of Location before.
+	KnownCountry bool
+	// Location is the location of the IP address, nil if unknown.
+	Location *Location
+	// LastLogin is the previous successful login, nil if there is none.
+	LastLogin *PastLogin
+	// RecentFailures is the number of failed attempts for the account in the recent past.
+	RecentFailures int
+	// PastLoginTimes are the times of recent successful logins.
+	PastLoginTimes []time.Time
+}
+
+// Rule scores one aspect of a login attempt. A score of zero means the rule did not trigger.
+type Rule interface {
+	Name() string
+	Score(s *Signals) int
+}
+
+// Decision is what to do with a login attempt.
+type Decision int
+
+const (
+	Allow Decision = iota
+	StepUp
+	Block
+)
+
+func (d Decision) String() string {
+	switch d {
+	case StepUp:
+		return "step_up"
+	case Block:
+		return "block"
+	default:
+		return "allow"
+	}
+}
+
+// Assessment is the result of scoring a login attempt.
+type Assessment struct {
+	Score    int
+	Reasons  []string
+	Decision Decision
+}
+
+// Engine sums the scores of its rules and compares the total with the thresholds.
+// A threshold of zero or less disables the matching decision.
+type Engine struct {
+	Rules           []Rule
+	StepUpThreshold int
+	BlockThreshold  int
+}
+
+// Assess scores a login attempt.
+func (e *Engine) Assess(s *Signals) *Assessment {
+	a := &Assessment{}
+	for _, rule := range e.Rules {
+		if score := rule.Score(s); score > 0 {
+			a.Score += score
+			a.Reasons = append(a.Reasons, rule.Name())
+		}
+	}
+
+	switch {
+	case e.BlockThreshold > 0 && a.Score >= e.BlockThreshold:
+		a.Decision = Block
+	case e.StepUpThreshold > 0 && a.Score >= e.StepUpThreshold:
+		a.Decision = StepUp
+	default:
+		a.Decision = Allow
+	}
+
+	return a
+}
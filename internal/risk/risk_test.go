@@ -0,0 +1,79 @@
+package risk
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fixedRule scores every login the same.
+type fixedRule struct {
+	name  string
+	score int
+}
+
+func (r fixedRule) Name() string       { return r.name }
+func (r fixedRule) Score(*Signals) int { return r.score }
+
+func TestEngineThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		scores  []int
+		stepUp  int
+		block   int
+		want    Decision
+		reasons []string
+		wantSum int
+	}{
+		{"below step up", []int{20, 0, 29}, 50, 90, Allow, []string{"r0", "r2"}, 49},
+		{"at step up", []int{20, 30}, 50, 90, StepUp, []string{"r0", "r1"}, 50},
+		{"between thresholds", []int{60, 29}, 50, 90, StepUp, []string{"r0", "r1"}, 89},
+		{"at block", []int{60, 30}, 50, 90, Block, []string{"r0", "r1"}, 90},
+		{"no rule triggers", []int{0, 0}, 50, 90, Allow, nil, 0},
+		{"step up disabled", []int{60}, 0, 90, Allow, []string{"r0"}, 60},
+		{"block disabled", []int{200}, 50, 0, StepUp, []string{"r0"}, 200},
+		{"both disabled", []int{200}, 0, 0, Allow, []string{"r0"}, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{StepUpThreshold: tt.stepUp, BlockThreshold: tt.block}
+			for i, score := range tt.scores {
+				e.Rules = append(e.Rules, fixedRule{name: "r" + strconv.Itoa(i), score: score})
+			}
+
+			a := e.Assess(&Signals{})
+			if a.Decision != tt.want || a.Score != tt.wantSum || !slices.Equal(a.Reasons, tt.reasons) {
+				t.Errorf("Assess = %s with %d %v, want %s with %d %v", a.Decision, a.Score, a.Reasons, tt.want, tt.wantSum, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	e := &Engine{Rules: DefaultRules(), StepUpThreshold: 50, BlockThreshold: 90}
+
+	tests := []struct {
+		name    string
+		signals Signals
+		want    Decision
+	}{
+		{"first login", Signals{Time: now, FirstLogin: true, Location: berlin}, Allow},
+		{"familiar login", Signals{Time: now, KnownDevice: true, KnownIPRange: true, KnownCountry: true, Location: berlin}, Allow},
+		{"new device on a new network", Signals{Time: now, KnownCountry: true, Location: berlin}, StepUp},
+		{"new device abroad right after a login at home", Signals{
+			Time:      now,
+			Location:  sydney,
+			LastLogin: &PastLogin{Time: now.Add(-30 * time.Minute), Location: berlin},
+		}, Block},
+		{"failure burst on a known device", Signals{Time: now, KnownDevice: true, KnownIPRange: true, KnownCountry: true, RecentFailures: 9}, Allow},
+		{"failure burst from a new device", Signals{Time: now, KnownIPRange: true, KnownCountry: true, RecentFailures: 9}, StepUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Assess(&tt.signals); got.Decision != tt.want {
+				t.Errorf("Decision = %s with %d %v, want %s", got.Decision, got.Score, got.Reasons, tt.want)
+			}
+		})
+	}
+}
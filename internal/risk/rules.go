@@ -0,0 +1,151 @@
+package risk
+
+import (
+	"math"
+)
+
+// DefaultRules returns the built-in rules with their default weights.
+func DefaultRules() []Rule {
+	return []Rule{
+		NewDevice{Points: 30},
+		NewIPRange{Points: 20},
+		NewCountry{Points: 20},
+		ImpossibleTravel{Points: 60, MaxSpeedKmh: 900},
+		FailedAttemptVelocity{PointsPerFailure: 10, Allowed: 2, MaxPoints: 40},
+		UnusualTimeOfDay{Points: 10, MinHistory: 5, ToleranceHours: 2},
+	}
+}
+
+// NewDevice scores logins from a device the account has not used before.
+type NewDevice struct {
+	Points int
+}
+
+func (r NewDevice) Name() string { return "new_device" }
+
+func (r NewDevice) Score(s *Signals) int {
+	if s.FirstLogin || s.KnownDevice {
+		return 0
+	}
+	return r.Points
+}
+
+// NewIPRange scores logins from a network range the account has not used before.
+type NewIPRange struct {
+	Points int
+}
+
+func (r NewIPRange) Name() string { return "new_ip_range" }
+
+func (r NewIPRange) Score(s *Signals) int {
+	if s.FirstLogin || s.KnownIPRange {
+		return 0
+	}
+	return r.Points
+}
+
+// NewCountry scores logins from a country the account has not logged in from before. Logins from
+// addresses the GeoIP database cannot place are not scored.
+type NewCountry struct {
+	Points int
+}
+
+func (r NewCountry) Name() string { return "new_country" }
+
+func (r NewCountry) Score(s *Signals) int {
+	if s.FirstLogin || s.KnownCountry || s.Location == nil || s.Location.Country == "" {
+		return 0
+	}
+	return r.Points
+}
+
+// ImpossibleTravel scores logins from a place the user could not have reached since their
+// last login without travelling faster than MaxSpeedKmh.
+type ImpossibleTravel struct {
+	Points      int
+	MaxSpeedKmh float64
+}
+
+func (r ImpossibleTravel) Name() string { return "impossible_travel" }
+
+func (r ImpossibleTravel) Score(s *Signals) int {
+	if s.Location == nil || s.LastLogin == nil || s.LastLogin.Location == nil {
+		return 0
+	}
+
+	distance := DistanceKm(s.LastLogin.Location, s.Location)
+	// Locations from GeoIP are approximate, so short distances never count
+	if distance < 100 {
+		return 0
+	}
+
+	hours := s.Time.Sub(s.LastLogin.Time).Hours()
+	if hours <= 0 || distance/hours > r.MaxSpeedKmh {
+		return r.Points
+	}
+	return 0
+}
+
+// FailedAttemptVelocity scores recent failed attempts beyond the Allowed number, up to MaxPoints.
+type FailedAttemptVelocity struct {
+	PointsPerFailure int
+	Allowed          int
+	MaxPoints        int
+}
+
+func (r FailedAttemptVelocity) Name() string { return "failed_attempt_velocity" }
+
+func (r FailedAttemptVelocity) Score(s *Signals) int {
+	excess := s.RecentFailures - r.Allowed
+	if excess <= 0 {
+		return 0
+	}
+	return min(excess*r.PointsPerFailure, r.MaxPoints)
+}
+
+// UnusualTimeOfDay scores logins at an hour (UTC) more than ToleranceHours away from every
+// recent login. It needs at least MinHistory past logins to judge what is usual.
+type UnusualTimeOfDay struct {
+	Points         int
+	MinHistory     int
+	ToleranceHours int
+}
+
+func (r UnusualTimeOfDay) Name() string { return "unusual_time_of_day" }
+
+func (r UnusualTimeOfDay) Score(s *Signals) int {
+	if len(s.PastLoginTimes) < r.MinHistory {
+		return 0
+	}
+
+	hour := s.Time.UTC().Hour()
+	for _, t := range s.PastLoginTimes {
+		if hourDistance(hour, t.UTC().Hour()) <= r.ToleranceHours {
+			return 0
+		}
+	}
+	return r.Points
+}
+
+// hourDistance returns how many hours apart two hours of the day are, going around midnight.
+func hourDistance(a, b int) int {
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+	return min(d, 24-d)
+}
+
+// earthRadiusKm is the mean radius of the earth.
+const earthRadiusKm = 6371.0
+
+// DistanceKm returns the great-circle distance between two locations.
+func DistanceKm(a, b *Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
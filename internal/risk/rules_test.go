@@ -0,0 +1,167 @@
+package risk
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	berlin  = &Location{Country: "DE", Latitude: 52.52, Longitude: 13.405}
+	potsdam = &Location{Country: "DE", Latitude: 52.39, Longitude: 13.065}
+	paris   = &Location{Country: "FR", Latitude: 48.857, Longitude: 2.352}
+	sydney  = &Location{Country: "AU", Latitude: -33.869, Longitude: 151.209}
+)
+
+var now = time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)
+
+func TestNewDevice(t *testing.T) {
+	rule := NewDevice{Points: 30}
+	tests := []struct {
+		name    string
+		signals Signals
+		want    int
+	}{
+		{"unknown device", Signals{}, 30},
+		{"known device", Signals{KnownDevice: true}, 0},
+		{"first login has no devices to compare with", Signals{FirstLogin: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Score(&tt.signals); got != tt.want {
+				t.Errorf("Score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewIPRange(t *testing.T) {
+	rule := NewIPRange{Points: 20}
+	tests := []struct {
+		name    string
+		signals Signals
+		want    int
+	}{
+		{"unknown range", Signals{}, 20},
+		{"known range", Signals{KnownIPRange: true}, 0},
+		{"first login", Signals{FirstLogin: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Score(&tt.signals); got != tt.want {
+				t.Errorf("Score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCountry(t *testing.T) {
+	rule := NewCountry{Points: 20}
+	tests := []struct {
+		name    string
+		signals Signals
+		want    int
+	}{
+		{"unfamiliar country", Signals{Location: sydney}, 20},
+		{"familiar country", Signals{Location: sydney, KnownCountry: true}, 0},
+		{"unknown location", Signals{}, 0},
+		{"location without country", Signals{Location: &Location{Latitude: 1, Longitude: 1}}, 0},
+		{"first login", Signals{Location: sydney, FirstLogin: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Score(&tt.signals); got != tt.want {
+				t.Errorf("Score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	rule := ImpossibleTravel{Points: 60, MaxSpeedKmh: 900}
+	last := func(ago time.Duration, location *Location) *PastLogin {
+		return &PastLogin{Time: now.Add(-ago), Location: location}
+	}
+	tests := []struct {
+		name    string
+		signals Signals
+		want    int
+	}{
+		{"Berlin to Sydney in an hour", Signals{Time: now, Location: sydney, LastLogin: last(time.Hour, berlin)}, 60},
+		{"Berlin to Sydney in a day", Signals{Time: now, Location: sydney, LastLogin: last(24*time.Hour, berlin)}, 0},
+		{"Berlin to Paris in two hours", Signals{Time: now, Location: paris, LastLogin: last(2*time.Hour, berlin)}, 0},
+		{"Berlin to Paris in half an hour", Signals{Time: now, Location: paris, LastLogin: last(30*time.Minute, berlin)}, 60},
+		{"short distances never count", Signals{Time: now, Location: potsdam, LastLogin: last(time.Minute, berlin)}, 0},
+		{"same moment elsewhere", Signals{Time: now, Location: paris, LastLogin: last(0, berlin)}, 60},
+		{"unknown location", Signals{Time: now, LastLogin: last(time.Hour, berlin)}, 0},
+		{"last login not located", Signals{Time: now, Location: sydney, LastLogin: last(time.Hour, nil)}, 0},
+		{"no last login", Signals{Time: now, Location: sydney}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.Score(&tt.signals); got != tt.want {
+				t.Errorf("Score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailedAttemptVelocity(t *testing.T) {
+	rule := FailedAttemptVelocity{PointsPerFailure: 10, Allowed: 2, MaxPoints: 40}
+	tests := []struct {
+		failures int
+		want     int
+	}{
+		{0, 0},
+		{2, 0},
+		{3, 10},
+		{5, 30},
+		{6, 40},
+		{50, 40},
+	}
+	for _, tt := range tests {
+		if got := rule.Score(&Signals{RecentFailures: tt.failures}); got != tt.want {
+			t.Errorf("Score with %d failures = %d, want %d", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestUnusualTimeOfDay(t *testing.T) {
+	rule := UnusualTimeOfDay{Points: 10, MinHistory: 3, ToleranceHours: 2}
+	at := func(hours ...int) []time.Time {
+		times := make([]time.Time, len(hours))
+		for i, h := range hours {
+			times[i] = time.Date(2026, 3, 1, h, 0, 0, 0, time.UTC)
+		}
+		return times
+	}
+	tests := []struct {
+		name    string
+		hour    int
+		history []time.Time
+		want    int
+	}{
+		{"usual hour", 14, at(9, 13, 17), 0},
+		{"within tolerance", 11, at(9, 9, 9), 0},
+		{"unusual hour", 3, at(9, 13, 17), 10},
+		{"around midnight", 1, at(23, 23, 23), 0},
+		{"too little history", 3, at(9, 13), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Signals{Time: time.Date(2026, 3, 2, tt.hour, 30, 0, 0, time.UTC), PastLoginTimes: tt.history}
+			if got := rule.Score(s); got != tt.want {
+				t.Errorf("Score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	if d := DistanceKm(berlin, paris); math.Abs(d-878) > 5 {
+		t.Errorf("Berlin to Paris = %.0f km, want about 878", d)
+	}
+	if d := DistanceKm(berlin, berlin); d != 0 {
+		t.Errorf("Berlin to Berlin = %f km, want 0", d)
+	}
+}
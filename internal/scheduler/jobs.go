@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/repositories"
+)
+
+// PurgeExpiredPasswordResets deletes password reset tokens past their expiry.
+func PurgeExpiredPasswordResets(repo repositories.PasswordResetRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "purge_expired_password_resets",
+		Interval: interval,
+		Run:      repo.DeleteExpiresTokens,
+	}
+}
+
+// PurgeExpiredSessions deletes sessions past their expiry.
+func PurgeExpiredSessions(repo repositories.SessionRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "purge_expired_sessions",
+		Interval: interval,
+		Run:      repo.DeleteExpired,
+	}
+}
+
+// PurgeExpiredLoginAlerts deletes "this wasn't me" tokens of new-login alerts past their expiry.
+func PurgeExpiredLoginAlerts(repo repositories.LoginAlertRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "purge_expired_login_alerts",
+		Interval: interval,
+		Run:      repo.DeleteExpired,
+	}
+}
+
+// PurgeExpiredInvitations deletes organization invitations past their expiry.
+func PurgeExpiredInvitations(repo repositories.OrganizationInvitationRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "purge_expired_invitations",
+		Interval: interval,
+		Run:      repo.DeleteExpired,
+	}
+}
+
+// PurgeExpiredLoginChallenges deletes confirmation codes of risky logins past their expiry.
+func PurgeExpiredLoginChallenges(repo repositories.LoginChallengeRepository, interval time.Duration) Job {
+	return Job{
+		Name:     "purge_expired_login_challenges",
+		Interval: interval,
+		Run:      repo.DeleteExpired,
+	}
+}
+
+// PurgeOldLoginAttempts deletes login attempts older than the retention period.
+func PurgeOldLoginAttempts(repo repositories.LoginAttemptRepository, interval, retention time.Duration) Job {
+	return Job{
+		Name:     "purge_old_login_attempts",
+		Interval: enabledIf(retention, interval),
+		Run: func(ctx context.Context) (int64, error) {
+			return repo.DeleteOlderThan(ctx, time.Now().Add(-retention))
+		},
+	}
+}
+
+// PurgeOldAuditLogs deletes audit log entries older than the retention period.
+func PurgeOldAuditLogs(repo repositories.AuditLogRepository, interval, retention time.Duration) Job {
+	return Job{
+		Name:     "purge_old_audit_logs",
+		Interval: enabledIf(retention, interval),
+		Run: func(ctx context.Context) (int64, error) {
+			return repo.DeleteOlderThan(ctx, time.Now().Add(-retention))
+		},
+	}
+}
+
+// PurgeStaleUnverifiedUsers deletes accounts that did not verify their email within the retention period.
+func PurgeStaleUnverifiedUsers(repo repositories.UserRepository, interval, retention time.Duration) Job {
+	return Job{
+		Name:     "purge_stale_unverified_users",
+		Interval: enabledIf(retention, interval),
+		Run: func(ctx context.Context) (int64, error) {
+			return repo.DeleteUnverifiedBefore(ctx, time.Now().Add(-retention))
+		},
+	}
+}
+
+// enabledIf disables a job, by zeroing its interval, when its retention is not set.
+func enabledIf(retention, interval time.Duration) time.Duration {
+	if retention <= 0 {
+		return 0
+	}
+	return interval
+}
+
+// DispatchEmailOutbox sends the emails waiting in the outbox.
+func DispatchEmailOutbox(dispatcher interface {
+	DispatchDue(ctx context.Context) (int64, error)
+}, interval time.Duration) Job {
+	return Job{
+		Name:     "dispatch_email_outbox",
+		Interval: interval,
+		Run:      dispatcher.DispatchDue,
+	}
+}
@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Nucleussss/auth-service/pkg/logger"
+)
+
+// Job is a task run on a fixed interval. Run returns how many items it processed.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (int64, error)
+}
+
+// jobMetrics are the counters kept for a single job.
+type jobMetrics struct {
+	runs         int64
+	failures     int64
+	skipped      int64
+	items        int64
+	lastDuration time.Duration
+	lastSuccess  time.Time
+}
+
+// Scheduler runs jobs in the background. Before each run it takes a Postgres advisory
+// lock named after the job, so when several replicas share a database only one of them
+// runs a given job at a time.
+type Scheduler struct {
+	db     *sql.DB
+	logger logger.Logger
+	jobs   []Job
+
+	mu      sync.Mutex
+	metrics map[string]*jobMetrics
+}
+
+func NewScheduler(db *sql.DB, logger logger.Logger) *Scheduler {
+	return &Scheduler{
+		db:      db,
+		logger:  logger,
+		metrics: make(map[string]*jobMetrics),
+	}
+}
+
+// Register adds a job. Jobs with a zero interval are disabled and ignored.
+func (s *Scheduler) Register(job Job) {
+	if job.Interval <= 0 {
+		s.logger.Infof("scheduler.Register: job %s is disabled", job.Name)
+		return
+	}
+
+	s.jobs = append(s.jobs, job)
+	s.mu.Lock()
+	s.metrics[job.Name] = &jobMetrics{}
+	s.mu.Unlock()
+}
+
+// Start runs every registered job once right away and then on its interval until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce runs a job if no other replica holds its lock and records the outcome.
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	const op = "scheduler.runOnce"
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		s.logger.Errorf("%s: %s: failed to get a database connection: %v", op, job.Name, err)
+		s.record(job.Name, func(m *jobMetrics) { m.failures++ })
+		return
+	}
+	defer conn.Close()
+
+	// advisory locks belong to the connection, so lock and unlock must use the same one
+	key := lockKey(job.Name)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		s.logger.Errorf("%s: %s: failed to take advisory lock: %v", op, job.Name, err)
+		s.record(job.Name, func(m *jobMetrics) { m.failures++ })
+		return
+	}
+	if !locked {
+		s.logger.Debugf("%s: %s: lock held by another replica, skipping", op, job.Name)
+		s.record(job.Name, func(m *jobMetrics) { m.skipped++ })
+		return
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			s.logger.Errorf("%s: %s: failed to release advisory lock: %v", op, job.Name, err)
+		}
+	}()
+
+	start := time.Now()
+	items, err := job.Run(ctx)
+	duration := time.Since(start)
+
+	if err != nil {
+		s.logger.Errorf("%s: %s: job failed after %s: %v", op, job.Name, duration, err)
+		s.record(job.Name, func(m *jobMetrics) {
+			m.runs++
+			m.failures++
+			m.lastDuration = duration
+		})
+		return
+	}
+
+	// frequent jobs mostly find nothing to do, so only report runs that did work
+	if items > 0 {
+		s.logger.Infof("%s: %s: processed %d items in %s", op, job.Name, items, duration)
+	} else {
+		s.logger.Debugf("%s: %s: nothing to do", op, job.Name)
+	}
+	s.record(job.Name, func(m *jobMetrics) {
+		m.runs++
+		m.items += items
+		m.lastDuration = duration
+		m.lastSuccess = time.Now()
+	})
+}
+
+func (s *Scheduler) record(name string, update func(m *jobMetrics)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.metrics[name])
+}
+
+// WriteMetrics writes the job metrics in the Prometheus text exposition format.
+func (s *Scheduler) WriteMetrics(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.metrics))
+	for name := range s.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	series := []struct {
+		name, help, kind string
+		value            func(m *jobMetrics) float64
+	}{
+		{"auth_job_runs_total", "Number of completed job runs.", "counter",
+			func(m *jobMetrics) float64 { return float64(m.runs) }},
+		{"auth_job_failures_total", "Number of failed job runs.", "counter",
+			func(m *jobMetrics) float64 { return float64(m.failures) }},
+		{"auth_job_skipped_total", "Number of runs skipped because another replica held the lock.", "counter",
+			func(m *jobMetrics) float64 { return float64(m.skipped) }},
+		{"auth_job_items_total", "Number of items processed by the job.", "counter",
+			func(m *jobMetrics) float64 { return float64(m.items) }},
+		{"auth_job_last_duration_seconds", "Duration of the last job run.", "gauge",
+			func(m *jobMetrics) float64 { return m.lastDuration.Seconds() }},
+		{"auth_job_last_success_timestamp_seconds", "Unix time of the last successful job run.", "gauge",
+			func(m *jobMetrics) float64 {
+				if m.lastSuccess.IsZero() {
+					return 0
+				}
+				return float64(m.lastSuccess.Unix())
+			}},
+	}
+
+	for _, metric := range series {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s{job=%q} %g\n", metric.name, name, metric.value(s.metrics[name])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lockKey derives the advisory lock key of a job from its name.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("auth-service:job:" + name))
+	return int64(h.Sum64())
+}
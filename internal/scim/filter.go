@@ -0,0 +1,418 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a parsed SCIM filter (RFC 7644, section 3.4.2.2).
+type Filter interface {
+	// Match evaluates the filter against a resource decoded from JSON.
+	Match(resource map[string]any) bool
+}
+
+// Compare is attr op value, with Op one of eq, ne, co, sw, ew, gt, ge, lt and le. Attr is lower
+// case and dotted for sub-attributes, e.g. "username" or "emails.value". Value is a string,
+// float64, bool or nil.
+type Compare struct {
+	Attr  string
+	Op    string
+	Value any
+}
+
+// Present is attr pr: the attribute has a non-empty value.
+type Present struct {
+	Attr string
+}
+
+type And struct {
+	Left, Right Filter
+}
+
+type Or struct {
+	Left, Right Filter
+}
+
+type Not struct {
+	Filter Filter
+}
+
+// ParseFilter parses a filter such as `userName eq "alice@example.com"` or
+// `emails[type eq "work" and value co "@example.com"] or not (active eq false)`.
+// Attribute paths in brackets are flattened, so emails[value eq "x"] is emails.value eq "x".
+func ParseFilter(src string) (Filter, error) {
+	tokens, err := lexFilter(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+
+	p := &filterParser{tokens: tokens}
+	f, err := p.or("")
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return f, nil
+}
+
+// NormalizeAttr lower-cases an attribute path and strips a schema URN in front of it, so
+// "urn:ietf:params:scim:schemas:core:2.0:User:userName" becomes "username".
+func NormalizeAttr(path string) string {
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		path = path[i+1:]
+	}
+	return strings.ToLower(path)
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func lexFilter(src string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			// strings are JSON strings
+			end := i + 1
+			for ; end < len(src) && src[end] != '"'; end++ {
+				if src[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:end+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string %s", src[i:end+1])
+			}
+			tokens = append(tokens, filterToken{text: s, quoted: true})
+			i = end + 1
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune(" \t()[]\"", rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, filterToken{text: src[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// keyword consumes the next token if it is the unquoted, case-insensitive word.
+func (p *filterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, errors.New("unexpected end of filter")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+// or parses a filter. Attributes are prefixed with parent, set inside brackets.
+func (p *filterParser) or(parent string) (Filter, error) {
+	left, err := p.and(parent)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and(parent string) (Filter, error) {
+	left, err := p.unary(parent)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary(parent string) (Filter, error) {
+	if p.keyword("not") {
+		if !p.keyword("(") {
+			return nil, errors.New("expected ( after not")
+		}
+		f, err := p.or(parent)
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, errors.New("expected )")
+		}
+		return &Not{Filter: f}, nil
+	}
+	if p.keyword("(") {
+		f, err := p.or(parent)
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, errors.New("expected )")
+		}
+		return f, nil
+	}
+	return p.attrExp(parent)
+}
+
+func (p *filterParser) attrExp(parent string) (Filter, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.quoted || !validAttrPath(t.text) {
+		return nil, fmt.Errorf("expected an attribute, got %q", t.text)
+	}
+	attr := NormalizeAttr(t.text)
+	if parent != "" {
+		attr = parent + "." + attr
+	}
+
+	// valuePath: attr[filter], the filter applies to the sub-attributes of attr
+	if p.keyword("[") {
+		if parent != "" {
+			return nil, errors.New("nested brackets are not allowed")
+		}
+		f, err := p.or(attr)
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("]") {
+			return nil, errors.New("expected ]")
+		}
+		return f, nil
+	}
+
+	if p.keyword("pr") {
+		return &Present{Attr: attr}, nil
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(op.text) {
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op.text)
+	}
+
+	v, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := compValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Compare{Attr: attr, Op: strings.ToLower(op.text), Value: value}, nil
+}
+
+func compValue(t filterToken) (any, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", t.text)
+	}
+	return n, nil
+}
+
+func validAttrPath(s string) bool {
+	if s == "" || !unicode.IsLetter(rune(s[0])) && !strings.HasPrefix(s, "urn:") {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(":._-$", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *And) Match(r map[string]any) bool { return f.Left.Match(r) && f.Right.Match(r) }
+func (f *Or) Match(r map[string]any) bool  { return f.Left.Match(r) || f.Right.Match(r) }
+func (f *Not) Match(r map[string]any) bool { return !f.Filter.Match(r) }
+
+func (f *Present) Match(r map[string]any) bool {
+	for _, v := range lookup(r, f.Attr) {
+		if v != nil && v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether any value of the attribute compares true. Strings compare case-insensitively,
+// as most SCIM attributes are not case exact.
+func (f *Compare) Match(r map[string]any) bool {
+	values := lookup(r, f.Attr)
+	if f.Value == nil {
+		// eq null matches a missing attribute, ne null a present one
+		return (len(values) == 0 || values[0] == nil) == (f.Op == "eq")
+	}
+	for _, v := range values {
+		if compare(v, f.Op, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(v any, op string, want any) bool {
+	switch want := want.(type) {
+	case bool:
+		b, ok := v.(bool)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return b == want
+		case "ne":
+			return b != want
+		}
+		return false
+	case float64:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		return order(op, n < want, n == want)
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		// dates compare as times, so differently written instants are equal
+		if t1, err := time.Parse(time.RFC3339, s); err == nil {
+			if t2, err := time.Parse(time.RFC3339, want); err == nil {
+				return order(op, t1.Before(t2), t1.Equal(t2))
+			}
+		}
+		s, want = strings.ToLower(s), strings.ToLower(want)
+		switch op {
+		case "co":
+			return strings.Contains(s, want)
+		case "sw":
+			return strings.HasPrefix(s, want)
+		case "ew":
+			return strings.HasSuffix(s, want)
+		}
+		return order(op, s < want, s == want)
+	}
+	return false
+}
+
+// order evaluates the ordering operators and eq and ne, given whether a < b and a == b.
+func order(op string, less, equal bool) bool {
+	switch op {
+	case "eq":
+		return equal
+	case "ne":
+		return !equal
+	case "gt":
+		return !less && !equal
+	case "ge":
+		return !less
+	case "lt":
+		return less
+	case "le":
+		return less || equal
+	}
+	return false
+}
+
+// lookup returns the values of a dotted, lower case attribute path. Attribute names match
+// case-insensitively and multi-valued attributes contribute every element.
+func lookup(r map[string]any, attr string) []any {
+	name, rest, _ := strings.Cut(attr, ".")
+	v := field(r, name)
+	if rest == "" {
+		if list, ok := v.([]any); ok {
+			return list
+		}
+		if v == nil {
+			return nil
+		}
+		return []any{v}
+	}
+
+	var values []any
+	switch v := v.(type) {
+	case map[string]any:
+		values = lookup(v, rest)
+	case []any:
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				values = append(values, lookup(m, rest)...)
+			}
+		}
+	}
+	return values
+}
+
+// field returns the attribute of r whose name equals name, ignoring case.
+func field(r map[string]any, name string) any {
+	if v, ok := r[name]; ok {
+		return v
+	}
+	for k, v := range r {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrInvalidPath   = errors.New("invalid path")
+	ErrNoTarget      = errors.New("no target")
+	ErrInvalidValue  = errors.New("invalid value")
+	ErrInvalidSyntax = errors.New("invalid syntax")
+)
+
+// PatchRequest is the body of a PATCH request.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is one add, replace or remove operation. Op is case-insensitive, as some
+// providers send "Replace".
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchPath is a parsed operation path: attr, attr.sub, attr[filter] or attr[filter].sub.
+type patchPath struct {
+	attr   string
+	filter Filter
+	sub    string
+}
+
+func parsePath(path string) (*patchPath, error) {
+	attrPart, rest, bracket := strings.Cut(path, "[")
+	p := &patchPath{}
+
+	attr := NormalizeAttr(attrPart)
+	p.attr, p.sub, _ = strings.Cut(attr, ".")
+	if p.attr == "" || !validAttrPath(p.attr) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+	}
+
+	if bracket {
+		if p.sub != "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+		}
+		inner, after, ok := strings.Cut(rest, "]")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q has no closing bracket", ErrInvalidPath, path)
+		}
+		f, err := ParseFilter(inner)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPath, err)
+		}
+		p.filter = f
+		if after != "" {
+			if !strings.HasPrefix(after, ".") || len(after) == 1 {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+			}
+			p.sub = strings.ToLower(after[1:])
+		}
+	}
+	return p, nil
+}
+
+// ApplyPatch applies operations to a resource decoded from JSON, in order. The caller decides
+// which of the changed attributes to keep; read-only ones should simply be ignored.
+func ApplyPatch(resource map[string]any, ops []PatchOperation) error {
+	for _, o := range ops {
+		op := strings.ToLower(o.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return fmt.Errorf("%w: unknown operation %q", ErrInvalidSyntax, o.Op)
+		}
+
+		var value any
+		if len(o.Value) > 0 {
+			if err := json.Unmarshal(o.Value, &value); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidValue, err)
+			}
+		}
+
+		// without a path the value holds the attributes to add or replace
+		if o.Path == "" {
+			if op == "remove" {
+				return fmt.Errorf("%w: remove needs a path", ErrNoTarget)
+			}
+			attrs, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%w: %s without a path needs an object", ErrInvalidValue, op)
+			}
+			for name, v := range attrs {
+				path, err := parsePath(name)
+				if err != nil {
+					return err
+				}
+				if err := apply(resource, op, path, v); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		path, err := parsePath(o.Path)
+		if err != nil {
+			return err
+		}
+		if op != "remove" && value == nil {
+			return fmt.Errorf("%w: %s of %s needs a value", ErrInvalidValue, op, o.Path)
+		}
+		if err := apply(resource, op, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apply(resource map[string]any, op string, path *patchPath, value any) error {
+	key := keyOf(resource, path.attr)
+	current := resource[key]
+
+	if path.filter != nil {
+		return applyFiltered(resource, key, op, path, value)
+	}
+
+	if path.sub != "" {
+		switch c := current.(type) {
+		case nil:
+			if op != "remove" {
+				resource[key] = map[string]any{path.sub: value}
+			}
+		case map[string]any:
+			setOrRemove(c, op, path.sub, value)
+		case []any:
+			for _, item := range c {
+				if m, ok := item.(map[string]any); ok {
+					setOrRemove(m, op, path.sub, value)
+				}
+			}
+		default:
+			return fmt.Errorf("%w: %s has no sub-attributes", ErrInvalidPath, path.attr)
+		}
+		return nil
+	}
+
+	switch op {
+	case "remove":
+		list, isList := current.([]any)
+		values, hasValues := value.([]any)
+		if isList && hasValues {
+			// some providers name the members to remove in the value instead of a filter
+			resource[key] = without(list, values)
+		} else {
+			delete(resource, key)
+		}
+	case "add":
+		switch c := current.(type) {
+		case []any:
+			resource[key] = union(c, asList(value))
+		case map[string]any:
+			if m, ok := value.(map[string]any); ok {
+				merge(c, m)
+			} else {
+				resource[key] = value
+			}
+		default:
+			resource[key] = value
+		}
+	case "replace":
+		c, isMap := current.(map[string]any)
+		m, valueIsMap := value.(map[string]any)
+		if isMap && valueIsMap {
+			merge(c, m)
+		} else {
+			resource[key] = value
+		}
+	}
+	return nil
+}
+
+// applyFiltered applies an operation to the elements of a multi-valued attribute matching a filter.
+func applyFiltered(resource map[string]any, key, op string, path *patchPath, value any) error {
+	list, _ := resource[key].([]any)
+
+	var matched []map[string]any
+	var kept []any
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if ok && path.filter.Match(m) {
+			matched = append(matched, m)
+			if op == "remove" && path.sub == "" {
+				continue
+			}
+		}
+		kept = append(kept, item)
+	}
+
+	if len(matched) == 0 {
+		switch {
+		case op == "remove":
+			return nil
+		case op == "add":
+			// add creates the element the filter describes, e.g. emails[type eq "work"].value
+			if elem := elementOf(path.filter); elem != nil {
+				setOrRemove(elem, op, path.sub, value)
+				resource[key] = append(list, any(elem))
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: no %s match the filter", ErrNoTarget, path.attr)
+	}
+
+	if op == "remove" && path.sub == "" {
+		resource[key] = kept
+		return nil
+	}
+	for _, m := range matched {
+		if path.sub != "" {
+			setOrRemove(m, op, path.sub, value)
+			continue
+		}
+		v, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: elements of %s are objects", ErrInvalidValue, path.attr)
+		}
+		merge(m, v)
+	}
+	return nil
+}
+
+// elementOf builds the element a filter of the form sub eq "value" describes, nil for other filters.
+func elementOf(f Filter) map[string]any {
+	c, ok := f.(*Compare)
+	if !ok || c.Op != "eq" {
+		return nil
+	}
+	_, sub, _ := strings.Cut(c.Attr, ".")
+	if sub == "" {
+		sub = c.Attr
+	}
+	return map[string]any{sub: c.Value}
+}
+
+func setOrRemove(m map[string]any, op, name string, value any) {
+	key := keyOf(m, name)
+	if op == "remove" {
+		delete(m, key)
+		return
+	}
+	m[key] = value
+}
+
+// keyOf returns the key of m matching name case-insensitively, or name when there is none.
+func keyOf(m map[string]any, name string) string {
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		dst[keyOf(dst, k)] = v
+	}
+}
+
+func asList(v any) []any {
+	if list, ok := v.([]any); ok {
+		return list
+	}
+	return []any{v}
+}
+
+// sameElement compares elements of a multi-valued attribute by their value sub-attribute.
+func sameElement(a, b any) bool {
+	ma, ok1 := a.(map[string]any)
+	mb, ok2 := b.(map[string]any)
+	if ok1 && ok2 {
+		va, vb := field(ma, "value"), field(mb, "value")
+		if va != nil || vb != nil {
+			return reflect.DeepEqual(va, vb)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func union(list, values []any) []any {
+	for _, v := range values {
+		found := false
+		for _, item := range list {
+			if sameElement(item, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func without(list, values []any) []any {
+	kept := []any{}
+	for _, item := range list {
+		remove := false
+		for _, v := range values {
+			if sameElement(item, v) {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrEmailTaken      = errors.New("email already in use")
+	ErrInvalidToken    = errors.New("invalid or expired token")
+)
+
+type AccountService interface {
+	UpdateProfile(ctx context.Context, userID uuid.UUID, req *models.UpdateProfileRequest) (*models.User, error)
+	RequestEmailChange(ctx context.Context, userID uuid.UUID, req *models.EmailChangeRequest) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	DeleteAccount(ctx context.Context, userID uuid.UUID, password string) error
+	ChangePassword(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, req *models.ChangePasswordRequest) error
+}
+
+type accountService struct {
+	logger            logger.Logger
+	userRepo          repositories.UserRepository
+	emailChangeRepo   repositories.EmailChangeRepository
+	passwordResetRepo repositories.PasswordResetRepository
+	sessionRepo       repositories.SessionRepository
+	txManager         repositories.TxManager
+	emailService      EmailService
+	passwordPolicy    *PasswordPolicy
+	passwordHistory   *PasswordHistory
+	tokenExpiry       time.Duration
+}
+
+func NewAccountService(
+	logger logger.Logger,
+	userRepo repositories.UserRepository,
+	emailChangeRepo repositories.EmailChangeRepository,
+	passwordResetRepo repositories.PasswordResetRepository,
+	sessionRepo repositories.SessionRepository,
+	txManager repositories.TxManager,
+	emailService EmailService,
+	passwordPolicy *PasswordPolicy,
+	passwordHistory *PasswordHistory,
+	tokenExpiry time.Duration,
+) AccountService {
+	return &accountService{
+		logger:            logger,
+		userRepo:          userRepo,
+		emailChangeRepo:   emailChangeRepo,
+		passwordResetRepo: passwordResetRepo,
+		sessionRepo:       sessionRepo,
+		txManager:         txManager,
+		emailService:      emailService,
+		passwordPolicy:    passwordPolicy,
+		passwordHistory:   passwordHistory,
+		tokenExpiry:       tokenExpiry,
+	}
+}
+
+// UpdateProfile applies the fields set in the request and returns the updated user.
+func (s *accountService) UpdateProfile(ctx context.Context, userID uuid.UUID, req *models.UpdateProfileRequest) (*models.User, error) {
+	const op = "AccountService.UpdateProfile"
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		req.Name = &name
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, userID, req); err != nil {
+		s.logger.Errorf("%s: Failed to update profile for user %s: %v", op, userID, err)
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindbyID(ctx, userID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to reload user %s: %v", op, userID, err)
+		return nil, err
+	}
+
+	s.logger.Infof("%s: Updated profile for user %s", op, userID)
+	return user, nil
+}
+
+// RequestEmailChange sends a confirmation link to the new address. The email is only changed once the link is opened.
+func (s *accountService) RequestEmailChange(ctx context.Context, userID uuid.UUID, req *models.EmailChangeRequest) error {
+	const op = "AccountService.RequestEmailChange"
+
+	user, err := s.verifyPassword(ctx, userID, req.Password)
+	if err != nil {
+		return err
+	}
+
+	// Make sure nobody else already uses the new address
+	exists, err := s.userRepo.ExistsbyEmail(ctx, req.NewEmail)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to check if email exists: %v", op, err)
+		return err
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+
+	// Only the latest request can be confirmed
+	if err := s.emailChangeRepo.DeleteByUser(ctx, user.ID); err != nil {
+		s.logger.Errorf("%s: Failed to delete previous email changes: %v", op, err)
+		return err
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return err
+	}
+
+	change := &models.EmailChange{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		NewEmail:  req.NewEmail,
+		ExpiresAt: time.Now().Add(s.tokenExpiry),
+	}
+	if err := s.emailChangeRepo.Create(ctx, change); err != nil {
+		s.logger.Errorf("%s: Failed to save email change: %v", op, err)
+		return err
+	}
+
+	return s.emailService.SendEmailChangeConfirmation(ctx, models.EmailRecipient{
+		Email:  req.NewEmail,
+		Name:   user.Name,
+		Locale: user.Locale,
+	}, token)
+}
+
+// ConfirmEmailChange switches the user to the new address of a pending email change.
+func (s *accountService) ConfirmEmailChange(ctx context.Context, token string) error {
+	const op = "AccountService.ConfirmEmailChange"
+
+	change, err := s.emailChangeRepo.FindValidToken(ctx, utils.HashToken(token))
+	if err != nil {
+		s.logger.Errorf("%s: Failed to find email change: %v", op, err)
+		return err
+	}
+	if change == nil {
+		return ErrInvalidToken
+	}
+
+	user, err := s.userRepo.FindbyID(ctx, change.UserID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to find user %s: %v", op, change.UserID, err)
+		return err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// The address may have been taken since the change was requested
+		exists, err := s.userRepo.ExistsbyEmail(ctx, change.NewEmail)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrEmailTaken
+		}
+
+		if err := s.userRepo.UpdateEmail(ctx, user.ID, change.NewEmail); err != nil {
+			return err
+		}
+		return s.emailChangeRepo.DeleteByUser(ctx, user.ID)
+	})
+	if err != nil {
+		// the unique index catches an address taken by a concurrent change or registration
+		if errors.Is(err, ErrEmailTaken) || isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		s.logger.Errorf("%s: Failed to update email for user %s: %v", op, user.ID, err)
+		return err
+	}
+
+	// Let the previous address know in case the change was not made by the owner
+	if err := s.emailService.SendEmailChangedNotice(ctx, recipientOf(user), change.NewEmail); err != nil {
+		s.logger.Errorf("%s: Failed to notify previous address: %v", op, err)
+	}
+
+	s.logger.Infof("%s: Changed email for user %s", op, user.ID)
+	return nil
+}
+
+// DeleteAccount removes the user after checking their password again.
+func (s *accountService) DeleteAccount(ctx context.Context, userID uuid.UUID, password string) error {
+	const op = "AccountService.DeleteAccount"
+
+	if _, err := s.verifyPassword(ctx, userID, password); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		s.logger.Errorf("%s: Failed to delete user %s: %v", op, userID, err)
+		return err
+	}
+
+	s.logger.Infof("%s: Deleted account %s", op, userID)
+	return nil
+}
+
+// ChangePassword replaces the password of a signed in user after checking the current one.
+func (s *accountService) ChangePassword(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, req *models.ChangePasswordRequest) error {
+	const op = "AccountService.ChangePassword"
+
+	user, err := s.verifyPassword(ctx, userID, req.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	// Passwords cannot be changed again right away, unless a change is being forced
+	if !user.MustChangePassword {
+		if err := s.passwordHistory.CheckMinAge(ctx, user.ID, "new_password"); err != nil {
+			s.logger.Errorf("%s: Password minimum age check failed for user %s: %v", op, user.ID, err)
+			return err
+		}
+	}
+
+	// Check the new password against the password policy
+	if err := s.passwordPolicy.Validate("new_password", req.NewPassword, user.Email, user.Name); err != nil {
+		s.logger.Errorf("%s: Password rejected by policy for user %s", op, user.ID)
+		return err
+	}
+
+	// Do not allow going back to a recently used password
+	if err := s.passwordHistory.CheckReuse(ctx, user, "new_password", req.NewPassword); err != nil {
+		s.logger.Errorf("%s: Password reuse check failed for user %s: %v", op, user.ID, err)
+		return err
+	}
+
+	// Hash the new password before updating it in the database
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to hash password: %v", op, err)
+		return err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			s.logger.Errorf("%s: Failed to update password for user %s: %v", op, user.ID, err)
+			return err
+		}
+
+		if err := s.passwordHistory.Record(ctx, user.ID, hashedPassword); err != nil {
+			s.logger.Errorf("%s: Failed to record password history for user %s: %v", op, user.ID, err)
+			return err
+		}
+
+		// Sign out every other device if asked to
+		if req.RevokeOtherSessions {
+			if err := s.sessionRepo.DeleteByUser(ctx, user.ID, sessionID); err != nil {
+				s.logger.Errorf("%s: Failed to revoke other sessions for user %s: %v", op, user.ID, err)
+				return err
+			}
+		}
+
+		// A reset link sent before the change must not set the password back
+		if err := s.passwordResetRepo.DeleteByUser(ctx, user.ID); err != nil {
+			s.logger.Errorf("%s: Failed to delete reset tokens of user %s: %v", op, user.ID, err)
+			return err
+		}
+
+		return s.emailService.SendPasswordChangedEmail(ctx, recipientOf(user))
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infof("%s: Changed password for user %s", op, user.ID)
+	return nil
+}
+
+// verifyPassword loads the user and checks the given password against the stored hash.
+func (s *accountService) verifyPassword(ctx context.Context, userID uuid.UUID, password string) (*models.User, error) {
+	const op = "AccountService.verifyPassword"
+
+	user, err := s.userRepo.FindbyID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidPassword
+		}
+		s.logger.Errorf("%s: Failed to find user %s: %v", op, userID, err)
+		return nil, err
+	}
+
+	if err := utils.VerifyPassword(user.PasswordHash, password); err != nil {
+		s.logger.Errorf("%s: Password verification failed for user %s", op, userID)
+		return nil, ErrInvalidPassword
+	}
+
+	return user, nil
+}
@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// adminUserPageSize is the number of users listed when the request does not ask for a limit.
+	adminUserPageSize = 50
+	// adminAuditEventCount is the number of audit events shown with a user.
+	adminAuditEventCount = 20
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrSelfManagement is returned when admins disable or delete their own account.
+	ErrSelfManagement = errors.New("admins cannot disable or delete their own account")
+)
+
+type AdminService interface {
+	ForcePasswordChange(ctx context.Context, userIDs []uuid.UUID, revokeSessions bool) (int64, error)
+	ListUsers(ctx context.Context, query *models.AdminUserQuery) (*models.AdminUserPage, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*models.AdminUserDetail, error)
+	CreateUser(ctx context.Context, actorID uuid.UUID, req *models.AdminCreateUserRequest) (*models.User, error)
+	SetUserActive(ctx context.Context, actorID, id uuid.UUID, active bool) error
+	ForcePasswordReset(ctx context.Context, actorID, id uuid.UUID) error
+	DeleteUser(ctx context.Context, actorID, id uuid.UUID) error
+}
+
+type adminService struct {
+	logger               logger.Logger
+	userRepo             repositories.UserRepository
+	sessionRepo          repositories.SessionRepository
+	roleRepo             repositories.RoleRepository
+	auditRepo            repositories.AuditLogRepository
+	txManager            repositories.TxManager
+	passwordResetService PasswordResetService
+	passwordPolicy       *PasswordPolicy
+}
+
+func NewAdminService(
+	logger logger.Logger,
+	userRepo repositories.UserRepository,
+	sessionRepo repositories.SessionRepository,
+	roleRepo repositories.RoleRepository,
+	auditRepo repositories.AuditLogRepository,
+	txManager repositories.TxManager,
+	passwordResetService PasswordResetService,
+	passwordPolicy *PasswordPolicy,
+) AdminService {
+	return &adminService{
+		logger:               logger,
+		userRepo:             userRepo,
+		sessionRepo:          sessionRepo,
+		roleRepo:             roleRepo,
+		auditRepo:            auditRepo,
+		txManager:            txManager,
+		passwordResetService: passwordResetService,
+		passwordPolicy:       passwordPolicy,
+	}
+}
+
+// ForcePasswordChange flags users so they must change their password on their next login,
+// optionally signing them out everywhere. It returns how many users were flagged.
+func (s *adminService) ForcePasswordChange(ctx context.Context, userIDs []uuid.UUID, revokeSessions bool) (int64, error) {
+	const op = "AdminService.ForcePasswordChange"
+
+	flagged, err := s.userRepo.SetMustChangePassword(ctx, userIDs)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to flag users: %v", op, err)
+		return 0, err
+	}
+
+	if revokeSessions {
+		for _, userID := range userIDs {
+			if err := s.sessionRepo.DeleteByUser(ctx, userID, uuid.Nil); err != nil {
+				s.logger.Errorf("%s: Failed to revoke sessions for user %s: %v", op, userID, err)
+				return flagged, err
+			}
+		}
+	}
+
+	s.logger.Infof("%s: Flagged %d users for a password change", op, flagged)
+	return flagged, nil
+}
+
+// ListUsers returns a page of the users matching the query, newest first.
+func (s *adminService) ListUsers(ctx context.Context, query *models.AdminUserQuery) (*models.AdminUserPage, error) {
+	const op = "AdminService.ListUsers"
+
+	search := &models.UserSearch{
+		Prefix:   strings.TrimSpace(query.Search),
+		Active:   query.Active,
+		Verified: query.Verified,
+		Role:     query.Role,
+		Limit:    query.Limit,
+	}
+	if search.Limit == 0 {
+		search.Limit = adminUserPageSize
+	}
+	if query.Cursor != "" {
+		var err error
+		if search.AfterCreatedAt, search.AfterID, err = decodeUserCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// one user more than asked for tells whether there is a next page
+	limit := search.Limit
+	search.Limit++
+	users, err := s.userRepo.Search(ctx, search)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to search users: %v", op, err)
+		return nil, err
+	}
+
+	page := &models.AdminUserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		last := page.Users[limit-1]
+		page.NextCursor = encodeUserCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// GetUser returns a user with their global roles, active sessions and latest audit events.
+func (s *adminService) GetUser(ctx context.Context, id uuid.UUID) (*models.AdminUserDetail, error) {
+	const op = "AdminService.GetUser"
+
+	user, err := s.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.AdminUserDetail{User: user}
+	if detail.Roles, err = s.roleRepo.ListGlobalRolesForUser(ctx, id); err != nil {
+		s.logger.Errorf("%s: Failed to list roles of user %s: %v", op, id, err)
+		return nil, err
+	}
+	if detail.Sessions, err = s.sessionRepo.ListActiveByUser(ctx, id); err != nil {
+		s.logger.Errorf("%s: Failed to list sessions of user %s: %v", op, id, err)
+		return nil, err
+	}
+	if detail.AuditEvents, err = s.auditRepo.ListByUser(ctx, id, adminAuditEventCount); err != nil {
+		s.logger.Errorf("%s: Failed to list audit events of user %s: %v", op, id, err)
+		return nil, err
+	}
+
+	return detail, nil
+}
+
+// CreateUser creates a user with a verified email address and the given global roles. Users
+// created without a password are emailed a link to set one.
+func (s *adminService) CreateUser(ctx context.Context, actorID uuid.UUID, req *models.AdminCreateUserRequest) (*models.User, error) {
+	const op = "AdminService.CreateUser"
+
+	password := req.Password
+	if password != "" {
+		if err := s.passwordPolicy.Validate("password", password, req.Email, req.Name); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if password, err = utils.GenerateSecureToken(32); err != nil {
+			return nil, err
+		}
+	}
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to hash password: %v", op, err)
+		return nil, err
+	}
+
+	locale := req.Locale
+	if locale == "" {
+		locale = defaultEmailLocale
+	}
+
+	var userID uuid.UUID
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		for _, name := range req.Roles {
+			role, err := s.roleRepo.FindGlobalRoleByName(ctx, name)
+			if err != nil {
+				return err
+			}
+			if role == nil {
+				return fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+			}
+		}
+
+		userID, err = s.userRepo.Create(ctx, &models.CreateNewUser{
+			Name:         req.Name,
+			Email:        req.Email,
+			PasswordHash: passwordHash,
+			Locale:       locale,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.userRepo.MarkEmailVerified(ctx, userID); err != nil {
+			return err
+		}
+		if err := s.roleRepo.SyncGlobalRoles(ctx, userID, nil, req.Roles); err != nil {
+			return err
+		}
+		if req.Password == "" {
+			if err := s.passwordResetService.Invite(ctx, req.Email); err != nil {
+				return err
+			}
+		}
+		return s.audit(ctx, actorID, &userID, models.AuditUserCreated, map[string]any{
+			"email": req.Email,
+			"roles": req.Roles,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			return nil, err
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrEmailTaken
+		}
+		s.logger.Errorf("%s: Failed to create user %s: %v", op, req.Email, err)
+		return nil, err
+	}
+
+	s.logger.Infof("%s: Admin %s created user %s", op, actorID, userID)
+	return s.userRepo.FindbyID(ctx, userID)
+}
+
+// SetUserActive enables or disables a user. Disabled users are signed out everywhere and cannot
+// sign in until they are enabled again.
+func (s *adminService) SetUserActive(ctx context.Context, actorID, id uuid.UUID, active bool) error {
+	const op = "AdminService.SetUserActive"
+
+	if !active && id == actorID {
+		return ErrSelfManagement
+	}
+	if _, err := s.findUser(ctx, id); err != nil {
+		return err
+	}
+
+	action := models.AuditUserEnabled
+	if !active {
+		action = models.AuditUserDisabled
+	}
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.SetActive(ctx, id, active); err != nil {
+			return err
+		}
+		if !active {
+			if err := s.sessionRepo.DeleteByUser(ctx, id, uuid.Nil); err != nil {
+				return err
+			}
+		}
+		return s.audit(ctx, actorID, &id, action, nil)
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to update user %s: %v", op, id, err)
+		return err
+	}
+
+	s.logger.Infof("%s: Admin %s set user %s active=%t", op, actorID, id, active)
+	return nil
+}
+
+// ForcePasswordReset signs a user out everywhere, makes them change their password on their next
+// login and emails them a password reset link.
+func (s *adminService) ForcePasswordReset(ctx context.Context, actorID, id uuid.UUID) error {
+	const op = "AdminService.ForcePasswordReset"
+
+	user, err := s.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.userRepo.SetMustChangePassword(ctx, []uuid.UUID{id}); err != nil {
+			return err
+		}
+		if err := s.sessionRepo.DeleteByUser(ctx, id, uuid.Nil); err != nil {
+			return err
+		}
+		if _, err := s.passwordResetService.RequestReset(ctx, user.Email); err != nil {
+			return err
+		}
+		return s.audit(ctx, actorID, &id, models.AuditUserPasswordResetForce, nil)
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to force a password reset for user %s: %v", op, id, err)
+		return err
+	}
+
+	s.logger.Infof("%s: Admin %s forced a password reset for user %s", op, actorID, id)
+	return nil
+}
+
+// DeleteUser deletes a user and everything that belongs to them. The audit entry of the deletion
+// keeps the id and email of the user, as entries about them are deleted along with them.
+func (s *adminService) DeleteUser(ctx context.Context, actorID, id uuid.UUID) error {
+	const op = "AdminService.DeleteUser"
+
+	if id == actorID {
+		return ErrSelfManagement
+	}
+	user, err := s.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.audit(ctx, actorID, nil, models.AuditUserDeleted, map[string]any{
+			"user_id": id,
+			"email":   user.Email,
+		})
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to delete user %s: %v", op, id, err)
+		return err
+	}
+
+	s.logger.Infof("%s: Admin %s deleted user %s", op, actorID, id)
+	return nil
+}
+
+func (s *adminService) findUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.FindbyID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.Errorf("AdminService.findUser: Failed to find user %s: %v", id, err)
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *adminService) audit(ctx context.Context, actorID uuid.UUID, userID *uuid.UUID, action string, details map[string]any) error {
+	return s.auditRepo.Create(ctx, &models.AuditLog{
+		UserID:  userID,
+		ActorID: &actorID,
+		Action:  action,
+		Details: details,
+	})
+}
+
+// encodeUserCursor returns the cursor of the page following the user created at createdAt with id.
+func encodeUserCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := strconv.FormatInt(createdAt.UnixMicro(), 10) + ":" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeUserCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	micros, idPart, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil || id == uuid.Nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return time.UnixMicro(usec), id, nil
+}
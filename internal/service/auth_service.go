@@ -2,34 +2,113 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/Nucleussss/auth-service/internal/db/models"
 	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/risk"
 	"github.com/Nucleussss/auth-service/internal/utils"
 	"github.com/Nucleussss/auth-service/pkg/logger"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// passwordChangeTokenTTL is the lifetime of tokens restricted to changing the password.
+const passwordChangeTokenTTL = 15 * time.Minute
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+var (
+	ErrSelfImpersonation = errors.New("admins cannot impersonate themselves")
+	ErrNotImpersonating  = errors.New("token is not an impersonation token")
+)
+
+// ErrAccountDisabled is returned when a deactivated user, e.g. one deprovisioned through SCIM, logs in.
+var ErrAccountDisabled = errors.New("account disabled")
+
 type AuthService struct {
-	repo   repositories.UserRepository
-	logger logger.Logger
+	repo             repositories.UserRepository
+	sessionRepo      repositories.SessionRepository
+	verificationRepo repositories.EmailVerificationRepository
+	orgRepo          repositories.OrganizationRepository
+	roleRepo         repositories.RoleRepository
+	auditRepo        repositories.AuditLogRepository
+	txManager        repositories.TxManager
+	emailService     EmailService
+	passwordPolicy   *PasswordPolicy
+	loginNotifier    *LoginNotifier
+	loginRisk        *LoginRisk
+	passwordMaxAge   time.Duration
+	tokenExpiry      time.Duration
+	impersonationTTL time.Duration
+	authenticator    Authenticator
+	logger           logger.Logger
 }
 
-func NewAuthService(repo repositories.UserRepository, logger logger.Logger) *AuthService {
+func NewAuthService(
+	repo repositories.UserRepository,
+	sessionRepo repositories.SessionRepository,
+	verificationRepo repositories.EmailVerificationRepository,
+	orgRepo repositories.OrganizationRepository,
+	roleRepo repositories.RoleRepository,
+	auditRepo repositories.AuditLogRepository,
+	txManager repositories.TxManager,
+	emailService EmailService,
+	passwordPolicy *PasswordPolicy,
+	loginNotifier *LoginNotifier,
+	loginRisk *LoginRisk,
+	passwordMaxAge time.Duration,
+	tokenExpiry time.Duration,
+	impersonationTTL time.Duration,
+	authenticator Authenticator,
+	logger logger.Logger,
+) *AuthService {
 	return &AuthService{
-		repo:   repo,
-		logger: logger,
+		repo:             repo,
+		sessionRepo:      sessionRepo,
+		verificationRepo: verificationRepo,
+		orgRepo:          orgRepo,
+		roleRepo:         roleRepo,
+		auditRepo:        auditRepo,
+		txManager:        txManager,
+		emailService:     emailService,
+		passwordPolicy:   passwordPolicy,
+		loginNotifier:    loginNotifier,
+		loginRisk:        loginRisk,
+		passwordMaxAge:   passwordMaxAge,
+		tokenExpiry:      tokenExpiry,
+		impersonationTTL: impersonationTTL,
+		authenticator:    authenticator,
+		logger:           logger,
 	}
 
 }
 
+// Register creates a new account and sends a verification email. To avoid revealing which
+// addresses have accounts, registering an existing address succeeds the same way and only
+// notifies the owner of that address.
 func (s *AuthService) Register(ctx context.Context, user *models.RegisterRequest) error {
 	const op = "AuthService.Register"
 
 	s.logger.Infof("%s: Attemp to registration for %s", op, user.Email)
 
+	// Check the password against the password policy
+	if err := s.passwordPolicy.Validate("password", user.Password, user.Email, user.Name); err != nil {
+		s.logger.Errorf("%s: Password rejected by policy for %s", op, user.Email)
+		return err
+	}
+
+	// Hash the password before anything else so both outcomes below take the same time
+	hashPassword, err := utils.HashPassword(user.Password)
+	if err != nil {
+		s.logger.Errorf("%s: Error hashing password: %v", op, err)
+		return fmt.Errorf("Password hashing failed")
+	}
+
 	// Check if Email already exists
 	exists, err := s.repo.ExistsbyEmail(ctx, user.Email)
 	if err != nil {
@@ -38,26 +117,54 @@ func (s *AuthService) Register(ctx context.Context, user *models.RegisterRequest
 	}
 
 	if exists {
-		s.logger.Errorf("%s: Duplicate Email found for: %s", op, user.Email)
-		return fmt.Errorf("Email already registered")
-	}
-
-	// Hash the password before storing it in the database
-	hashPassword, err := utils.HashPassword(user.Password)
-	if err != nil {
-		s.logger.Errorf("%s: Error hashing password: %v", op, err)
-		return fmt.Errorf("Password hashing failed")
+		s.logger.Infof("%s: Duplicate Email found for: %s", op, user.Email)
+		return s.notifyAccountExists(ctx, user.Email)
 	}
 
 	userToCreateNewUser := &models.CreateNewUser{
 		Name:         user.Name,
 		Email:        user.Email,
 		PasswordHash: hashPassword,
+		Locale:       user.Locale,
+	}
+	if userToCreateNewUser.Locale == "" {
+		userToCreateNewUser.Locale = defaultEmailLocale
+	}
+
+	// Create the new user and its verification token in the database
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return fmt.Errorf("Registration failed")
 	}
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		userID, err := s.repo.Create(ctx, userToCreateNewUser)
+		if err != nil {
+			return err
+		}
+
+		err = s.verificationRepo.Create(ctx, &models.EmailVerification{
+			TokenHash: utils.HashToken(token),
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(s.tokenExpiry),
+		})
+		if err != nil {
+			return err
+		}
 
-	// Create the new user in the database
-	err = s.repo.Create(ctx, userToCreateNewUser)
+		return s.emailService.SendVerificationEmail(ctx, models.EmailRecipient{
+			Email:  user.Email,
+			Name:   user.Name,
+			Locale: userToCreateNewUser.Locale,
+		}, token)
+	})
 	if err != nil {
+		// another registration for the same address won the race
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			s.logger.Infof("%s: Duplicate Email found for: %s", op, user.Email)
+			return s.notifyAccountExists(ctx, user.Email)
+		}
+
 		s.logger.Errorf("%s: Error creating user: %s %v", op, user.Email, err)
 		return fmt.Errorf("Registration failed")
 	}
@@ -66,45 +173,395 @@ func (s *AuthService) Register(ctx context.Context, user *models.RegisterRequest
 	return nil
 }
 
-func (s *AuthService) Login(ctx context.Context, userLoginRequest *models.LoginRequest) (string, error) {
+// notifyAccountExists tells the owner of an address that someone tried to register it again.
+func (s *AuthService) notifyAccountExists(ctx context.Context, email string) error {
+	const op = "AuthService.notifyAccountExists"
+
+	user, err := s.repo.FindbyEmail(ctx, email)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to find user by email: %v", op, err)
+		return fmt.Errorf("Registration failed")
+	}
+
+	if err := s.emailService.SendAccountExistsEmail(ctx, recipientOf(user)); err != nil {
+		s.logger.Errorf("%s: Failed to queue email: %v", op, err)
+		return fmt.Errorf("Registration failed")
+	}
+	return nil
+}
+
+// VerifyEmail confirms the email address of a new account using the token from the verification email.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	const op = "AuthService.VerifyEmail"
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		verification, err := s.verificationRepo.Consume(ctx, utils.HashToken(token))
+		if err != nil {
+			return err
+		}
+		if verification == nil {
+			return ErrInvalidToken
+		}
+
+		return s.repo.MarkEmailVerified(ctx, verification.UserID)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			s.logger.Errorf("%s: Failed to verify email: %v", op, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Login checks the credentials with the configured authenticator and starts a new session.
+// Unknown emails and wrong passwords both return ErrInvalidCredentials. Logins that look
+// risky either need a code sent by email, see VerifyLoginChallenge, or return ErrLoginBlocked.
+func (s *AuthService) Login(ctx context.Context, userLoginRequest *models.LoginRequest, client *models.ClientInfo) (*models.LoginResult, error) {
 	const op = "handlers.LoginHandler"
 	s.logger.Infof("%s: Attempting to login with email: %s", op, userLoginRequest.Email)
 
-	// Find by Email
-	user, err := s.repo.FindbyEmail(ctx, userLoginRequest.Email)
+	user, err := s.authenticator.Authenticate(ctx, userLoginRequest.Email, userLoginRequest.Password)
 	if err != nil {
-		s.logger.Errorf("%s: Failed to find user by email: %v", op, err)
-		return "", fmt.Errorf("Failed to find user by email")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			s.logger.Errorf("%s: Failed to authenticate %s: %v", op, userLoginRequest.Email, err)
+			return nil, fmt.Errorf("Failed to authenticate")
+		}
+		s.recordAttempt(ctx, user, userLoginRequest.Email, client, models.LoginOutcomeFailure, nil)
+		return nil, ErrInvalidCredentials
 	}
 
-	// Verify the password hash
-	if err := utils.VerifyPassword(user.PasswordHash, userLoginRequest.Password); err != nil {
-		s.logger.Errorf("%s: Failed to verify password: %v", op, err)
-		return "", fmt.Errorf("Failed to verify password")
+	// Deactivated accounts keep their data but may not sign in
+	if !user.IsActive {
+		s.logger.Infof("%s: Refused login for deactivated user %s", op, user.ID)
+		s.recordAttempt(ctx, user, userLoginRequest.Email, client, models.LoginOutcomeFailure, nil)
+		return nil, ErrAccountDisabled
 	}
 
+	// Score the login and confirm or refuse it when it looks risky
+	var assessment *risk.Assessment
+	if s.loginRisk != nil {
+		assessment, err = s.loginRisk.Assess(ctx, user, client)
+		if err != nil {
+			// A broken risk check should not lock everybody out
+			s.logger.Errorf("%s: Failed to assess login risk: %v", op, err)
+		}
+	}
+	if assessment != nil {
+		switch assessment.Decision {
+		case risk.Block:
+			s.logger.Infof("%s: Blocked login for %s with risk score %d %v", op, userLoginRequest.Email, assessment.Score, assessment.Reasons)
+			s.recordAttempt(ctx, user, userLoginRequest.Email, client, models.LoginOutcomeBlocked, assessment)
+			return nil, ErrLoginBlocked
+		case risk.StepUp:
+			challengeID, err := s.loginRisk.StartChallenge(ctx, user)
+			if err != nil {
+				s.logger.Errorf("%s: Failed to start login challenge: %v", op, err)
+				return nil, fmt.Errorf("Failed to start login challenge")
+			}
+			s.logger.Infof("%s: Login for %s needs confirmation, risk score %d %v", op, userLoginRequest.Email, assessment.Score, assessment.Reasons)
+			s.recordAttempt(ctx, user, userLoginRequest.Email, client, models.LoginOutcomeChallenged, assessment)
+			return &models.LoginResult{ChallengeRequired: true, ChallengeID: &challengeID}, nil
+		}
+	}
+
+	s.recordAttempt(ctx, user, userLoginRequest.Email, client, models.LoginOutcomeSuccess, assessment)
+	return s.completeLogin(ctx, user, client)
+}
+
+// VerifyLoginChallenge finishes a login that needed the code sent by email.
+func (s *AuthService) VerifyLoginChallenge(ctx context.Context, req *models.LoginChallengeRequest, client *models.ClientInfo) (*models.LoginResult, error) {
+	const op = "AuthService.VerifyLoginChallenge"
+
+	if s.loginRisk == nil {
+		return nil, ErrInvalidToken
+	}
+
+	userID, err := s.loginRisk.VerifyChallenge(ctx, req.ChallengeID, req.Code)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			s.logger.Errorf("%s: Failed to verify login challenge: %v", op, err)
+		}
+		return nil, err
+	}
+
+	user, err := s.repo.FindbyID(ctx, userID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to find user %s: %v", op, userID, err)
+		return nil, err
+	}
+
+	// the account may have been deactivated while the challenge was pending
+	if !user.IsActive {
+		s.logger.Infof("%s: Refused login for deactivated user %s", op, user.ID)
+		return nil, ErrAccountDisabled
+	}
+
+	s.recordAttempt(ctx, user, user.Email, client, models.LoginOutcomeSuccess, nil)
+	return s.completeLogin(ctx, user, client)
+}
+
+// recordAttempt stores a login attempt for the risk checks of later logins.
+func (s *AuthService) recordAttempt(ctx context.Context, user *models.User, email string, client *models.ClientInfo, outcome string, assessment *risk.Assessment) {
+	if s.loginRisk != nil {
+		s.loginRisk.Record(ctx, user, email, client, outcome, assessment)
+	}
+}
+
+// completeLogin starts a session for a user whose login succeeded.
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User, client *models.ClientInfo) (*models.LoginResult, error) {
+	const op = "AuthService.completeLogin"
+
+	var err error
+	result := &models.LoginResult{}
+
+	// Users with an expired or administratively reset password may only change it
+	var sessionID uuid.UUID
+	if s.passwordChangeRequired(user) {
+		result.Token, sessionID, err = s.issueToken(ctx, user, client, uuid.Nil, utils.ScopePasswordChange, passwordChangeTokenTTL, uuid.Nil)
+		if err != nil {
+			s.logger.Errorf("%s: Failed to issue password change token: %v", op, err)
+			return nil, fmt.Errorf("Failed to generate JWT token")
+		}
+
+		s.logger.Infof("%s: Password change required for user: %s", op, user.Email)
+		result.PasswordChangeRequired = true
+	} else {
+		// Users belonging to organizations are signed in to the one they joined first
+		var orgID uuid.UUID
+		orgID, err = s.orgRepo.DefaultForUser(ctx, user.ID)
+		if err != nil {
+			s.logger.Errorf("%s: Failed to find organization of user %s: %v", op, user.ID, err)
+			return nil, err
+		}
+
+		result.Token, sessionID, err = s.issueToken(ctx, user, client, orgID, "", 0, uuid.Nil)
+		if err != nil {
+			s.logger.Errorf("%s: Failed to issue token: %v", op, err)
+			return nil, fmt.Errorf("Failed to generate JWT token")
+		}
+
+		s.logger.Infof("%s: Successfully logged in user: %s", op, user.Email)
+	}
+
+	// Give clients without a device cookie one, so the device is recognized next time
+	deviceToken := client.DeviceToken
+	if deviceToken == "" {
+		deviceToken, err = utils.GenerateSecureToken(32)
+		if err != nil {
+			s.logger.Errorf("%s: Failed to generate device token: %v", op, err)
+			return nil, fmt.Errorf("Failed to generate device token")
+		}
+		result.DeviceToken = deviceToken
+	}
+
+	// Let the user know about sign-ins from devices or places they have not used before
+	if s.loginNotifier != nil {
+		s.loginNotifier.CheckLogin(ctx, user, client, sessionID, deviceToken)
+	}
+
+	return result, nil
+}
+
+// ReportLogin revokes the session reported through the link of a new-login alert and starts a password reset.
+func (s *AuthService) ReportLogin(ctx context.Context, token string) error {
+	if s.loginNotifier == nil {
+		return ErrInvalidToken
+	}
+	return s.loginNotifier.ReportLogin(ctx, token)
+}
+
+// passwordChangeRequired reports whether the user must change their password before doing anything else.
+// Passwords kept in a directory are not ours to expire.
+func (s *AuthService) passwordChangeRequired(user *models.User) bool {
+	if !s.authenticator.LocalPasswords() {
+		return false
+	}
+	if user.MustChangePassword {
+		return true
+	}
+	return s.passwordMaxAge > 0 && time.Since(user.PasswordChangedAt) > s.passwordMaxAge
+}
+
+// SwitchOrganization signs the user in to another organization they belong to. It starts a new
+// session for orgID and ends the current one, so the token for the previous organization stops working.
+func (s *AuthService) SwitchOrganization(ctx context.Context, userID, sessionID, orgID uuid.UUID, client *models.ClientInfo) (string, error) {
+	const op = "AuthService.SwitchOrganization"
+
+	isMember, err := s.orgRepo.IsMember(ctx, orgID, userID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to look up membership of user %s in %s: %v", op, userID, orgID, err)
+		return "", err
+	}
+	if !isMember {
+		return "", ErrNotOrganizationMember
+	}
+
+	var token string
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if token, _, err = s.issueToken(ctx, &models.User{ID: userID}, client, orgID, "", 0, uuid.Nil); err != nil {
+			return err
+		}
+		_, err = s.sessionRepo.Delete(ctx, sessionID, userID)
+		return err
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to switch user %s to organization %s: %v", op, userID, orgID, err)
+		return "", err
+	}
+
+	s.logger.Infof("%s: User %s switched to organization %s", op, userID, orgID)
+	return token, nil
+}
+
+// Impersonate signs an admin in as another user for a short time, to see what the user sees. The
+// token names the admin in its act claim and its session records them, so the user can see it among
+// their sessions. Starting an impersonation is audited.
+func (s *AuthService) Impersonate(ctx context.Context, actorID, userID uuid.UUID, client *models.ClientInfo) (*models.ImpersonationResult, error) {
+	const op = "AuthService.Impersonate"
+
+	if actorID == userID {
+		return nil, ErrSelfImpersonation
+	}
+
+	user, err := s.repo.FindbyID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.Errorf("%s: Failed to find user %s: %v", op, userID, err)
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+
+	orgID, err := s.orgRepo.DefaultForUser(ctx, user.ID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to find organization of user %s: %v", op, user.ID, err)
+		return nil, err
+	}
+
+	result := &models.ImpersonationResult{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.impersonationTTL),
+	}
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		result.Token, result.SessionID, err = s.issueToken(ctx, user, client, orgID, "", s.impersonationTTL, actorID)
+		if err != nil {
+			return err
+		}
+		return s.auditRepo.Create(ctx, &models.AuditLog{
+			UserID:  &user.ID,
+			ActorID: &actorID,
+			Action:  models.AuditImpersonationStarted,
+			Details: map[string]any{
+				"session_id": result.SessionID,
+				"ip_address": client.IPAddress,
+				"expires_at": result.ExpiresAt,
+			},
+		})
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to start impersonation of user %s by %s: %v", op, user.ID, actorID, err)
+		return nil, err
+	}
+
+	s.logger.Infof("%s: Admin %s is impersonating user %s in session %s", op, actorID, user.ID, result.SessionID)
+	return result, nil
+}
+
+// StopImpersonation ends the impersonation session a token belongs to. Stopping is audited;
+// impersonations that run out simply expire with their session.
+func (s *AuthService) StopImpersonation(ctx context.Context, actorID, userID, sessionID uuid.UUID) error {
+	const op = "AuthService.StopImpersonation"
+
+	if actorID == uuid.Nil {
+		return ErrNotImpersonating
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.sessionRepo.Delete(ctx, sessionID, userID); err != nil {
+			return err
+		}
+		return s.auditRepo.Create(ctx, &models.AuditLog{
+			UserID:  &userID,
+			ActorID: &actorID,
+			Action:  models.AuditImpersonationStopped,
+			Details: map[string]any{"session_id": sessionID},
+		})
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to stop impersonation session %s: %v", op, sessionID, err)
+		return err
+	}
+
+	s.logger.Infof("%s: Admin %s stopped impersonating user %s", op, actorID, userID)
+	return nil
+}
+
+// issueToken starts a new session for the user in orgID, which may be uuid.Nil, and returns a JWT
+// bound to it along with the session ID. A zero ttl uses the default token lifetime. actorID is the
+// admin impersonating the user, uuid.Nil for the user's own sessions.
+func (s *AuthService) issueToken(ctx context.Context, user *models.User, client *models.ClientInfo, orgID uuid.UUID, scope string, ttl time.Duration, actorID uuid.UUID) (string, uuid.UUID, error) {
 	// load the JWT secret from environment variables
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
-		return "", fmt.Errorf("JWT_SECRET environment variable is not set")
+		return "", uuid.Nil, fmt.Errorf("JWT_SECRET environment variable is not set")
 	}
 
-	// Parse the string ID into UUID
-	// userUUID, err := uuid.Parse(user.ID)
-	// if err != nil {
-	// 	return "", fmt.Errorf("Failed to parse UUID from token")
-	// }
+	// Full access tokens tell clients what the user may do in the organization. The permission
+	// middleware still checks the current permissions on every request.
+	var permissions []string
+	if scope == "" {
+		var err error
+		permissions, err = s.roleRepo.GetUserPermissions(repositories.WithOrganization(ctx, orgID), user.ID)
+		if err != nil {
+			return "", uuid.Nil, err
+		}
+	}
 
-	// Generate a JWT token for the user
-	token, err := utils.GenerateJWTToken(user.ID, jwtSecret)
+	// Generate a JWT token bound to a new session
+	sessionID := uuid.New()
+	token, expiresAt, err := utils.GenerateSessionJWTToken(utils.SessionClaims{
+		UserID:      user.ID,
+		SessionID:   sessionID,
+		OrgID:       orgID,
+		Permissions: permissions,
+		Scope:       scope,
+		TTL:         ttl,
+		ActorID:     actorID,
+	}, jwtSecret)
 	if err != nil {
-		s.logger.Errorf("%s: Failed to generate JWT token: %v", op, err)
-		return "", fmt.Errorf("Failed to generate JWT token")
+		return "", uuid.Nil, err
 	}
 
-	s.logger.Infof("%s: Successfully logged in user: %s", op, userLoginRequest.Email)
+	// Record the session so the user can see and revoke it later
+	device := client.Device
+	if device == "" {
+		device = describeDevice(client.UserAgent)
+	}
+	session := &models.Session{
+		ID:           sessionID,
+		UserID:       user.ID,
+		OrgID:        orgID,
+		SessionToken: utils.HashToken(token),
+		Device:       device,
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+		ExpiresAt:    expiresAt,
+	}
+	if actorID != uuid.Nil {
+		session.ActorID = &actorID
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return "", uuid.Nil, err
+	}
 
-	return token, nil
+	return token, sessionID, nil
 }
 
 func (s *AuthService) GetProfile(ctx context.Context, userID uuid.UUID) (*models.User, error) {
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+)
+
+// Authenticator checks the credentials of a login and returns the local user they belong to.
+// Wrong credentials return ErrInvalidCredentials, along with the user when the account is known
+// so the failed attempt can be counted against it.
+type Authenticator interface {
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+	// LocalPasswords reports whether logins use the password hashes of the users table, so the
+	// local password expiry applies.
+	LocalPasswords() bool
+}
+
+// localAuthenticator checks passwords against the hashes stored in the users table.
+type localAuthenticator struct {
+	repo   repositories.UserRepository
+	logger logger.Logger
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// NewLocalAuthenticator returns the default authenticator, which verifies the password hash of the
+// user. Unknown emails and wrong passwords take the same amount of hashing work.
+func NewLocalAuthenticator(repo repositories.UserRepository, logger logger.Logger) Authenticator {
+	return &localAuthenticator{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (a *localAuthenticator) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	const op = "localAuthenticator.Authenticate"
+
+	user, err := a.repo.FindbyEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			a.logger.Errorf("%s: Failed to find user by email: %v", op, err)
+			return nil, fmt.Errorf("Failed to find user by email")
+		}
+
+		// Compare against a dummy hash so unknown emails take as long as known ones
+		_ = utils.VerifyPassword(a.dummyPasswordHash(), password)
+		a.logger.Errorf("%s: No user with email: %s", op, email)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := utils.VerifyPassword(user.PasswordHash, password); err != nil {
+		a.logger.Errorf("%s: Failed to verify password: %v", op, err)
+		return user, ErrInvalidCredentials
+	}
+
+	// Upgrade hashes made with an outdated algorithm or parameters while the plain password is at hand
+	if utils.PasswordNeedsRehash(user.PasswordHash) {
+		a.rehashPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+func (a *localAuthenticator) LocalPasswords() bool {
+	return true
+}
+
+// rehashPassword replaces the stored hash of a user with one made by the current hasher.
+// Failures are only logged since the login itself already succeeded.
+func (a *localAuthenticator) rehashPassword(ctx context.Context, user *models.User, password string) {
+	const op = "localAuthenticator.rehashPassword"
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		a.logger.Errorf("%s: Failed to rehash password for user %s: %v", op, user.ID, err)
+		return
+	}
+
+	if err := a.repo.UpdatePasswordHash(ctx, user.ID, hashedPassword); err != nil {
+		a.logger.Errorf("%s: Failed to save rehashed password for user %s: %v", op, user.ID, err)
+		return
+	}
+
+	a.logger.Infof("%s: Rehashed password for user %s", op, user.ID)
+}
+
+// dummyPasswordHash returns a hash of a random password made with the current hasher,
+// used to spend the same time on unknown emails as on real accounts.
+func (a *localAuthenticator) dummyPasswordHash() string {
+	a.dummyHashOnce.Do(func() {
+		password, err := utils.GenerateSecureToken(16)
+		if err == nil {
+			a.dummyHash, err = utils.HashPassword(password)
+		}
+		if err != nil {
+			a.logger.Errorf("localAuthenticator.dummyPasswordHash: Failed to create dummy hash: %v", err)
+		}
+	})
+	return a.dummyHash
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Nucleussss/auth-service/internal/authz"
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+)
+
+// AuthzService answers relationship-based authorization questions about the resources of the active
+// organization, such as whether a user may moderate a room.
+type AuthzService interface {
+	Check(ctx context.Context, req *models.AuthzCheckRequest) (bool, error)
+	Expand(ctx context.Context, req *models.AuthzExpandRequest) (*authz.Node, error)
+	ListObjects(ctx context.Context, req *models.AuthzListObjectsRequest) ([]string, error)
+	WriteTuples(ctx context.Context, req *models.RelationTuplesRequest) error
+	DeleteTuples(ctx context.Context, req *models.RelationTuplesRequest) error
+}
+
+type authzService struct {
+	logger  logger.Logger
+	store   authz.Store
+	checker *authz.Checker
+}
+
+func NewAuthzService(logger logger.Logger, store authz.Store, schema *authz.Schema) AuthzService {
+	return &authzService{
+		logger:  logger,
+		store:   store,
+		checker: &authz.Checker{Store: store, Schema: schema},
+	}
+}
+
+// isAuthzRequestError reports whether err is caused by the request rather than by the store.
+func isAuthzRequestError(err error) bool {
+	return errors.Is(err, authz.ErrInvalidTuple) || errors.Is(err, authz.ErrUnknownRelation)
+}
+
+// Check reports whether the subject holds the relation on the object.
+func (s *authzService) Check(ctx context.Context, req *models.AuthzCheckRequest) (bool, error) {
+	const op = "AuthzService.Check"
+
+	object, err := authz.ParseObject(req.Object)
+	if err != nil {
+		return false, err
+	}
+	subject, err := authz.ParseSubject(req.Subject)
+	if err != nil {
+		return false, err
+	}
+
+	allowed, err := s.checker.Check(ctx, object, req.Relation, subject)
+	if err != nil {
+		if !isAuthzRequestError(err) {
+			s.logger.Errorf("%s: Failed to check %s#%s@%s: %v", op, object, req.Relation, subject, err)
+		}
+		return false, err
+	}
+
+	return allowed, nil
+}
+
+// Expand returns the tree of everyone holding the relation on the object.
+func (s *authzService) Expand(ctx context.Context, req *models.AuthzExpandRequest) (*authz.Node, error) {
+	const op = "AuthzService.Expand"
+
+	object, err := authz.ParseObject(req.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := s.checker.Expand(ctx, object, req.Relation)
+	if err != nil {
+		if !isAuthzRequestError(err) {
+			s.logger.Errorf("%s: Failed to expand %s#%s: %v", op, object, req.Relation, err)
+		}
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// ListObjects returns the IDs of the objects of a type on which the subject holds the relation.
+func (s *authzService) ListObjects(ctx context.Context, req *models.AuthzListObjectsRequest) ([]string, error) {
+	const op = "AuthzService.ListObjects"
+
+	subject, err := authz.ParseSubject(req.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := s.checker.ListObjects(ctx, req.Type, req.Relation, subject)
+	if err != nil {
+		if !isAuthzRequestError(err) {
+			s.logger.Errorf("%s: Failed to list %s objects with %s for %s: %v", op, req.Type, req.Relation, subject, err)
+		}
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// WriteTuples stores relationships. Every tuple must name a relation of the schema.
+func (s *authzService) WriteTuples(ctx context.Context, req *models.RelationTuplesRequest) error {
+	const op = "AuthzService.WriteTuples"
+
+	tuples, err := s.parseTuples(req.Tuples)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Write(ctx, tuples...); err != nil {
+		s.logger.Errorf("%s: Failed to write %d tuples: %v", op, len(tuples), err)
+		return err
+	}
+
+	s.logger.Infof("%s: Wrote %d tuples", op, len(tuples))
+	return nil
+}
+
+// DeleteTuples removes relationships. Tuples that do not exist are ignored.
+func (s *authzService) DeleteTuples(ctx context.Context, req *models.RelationTuplesRequest) error {
+	const op = "AuthzService.DeleteTuples"
+
+	tuples, err := s.parseTuples(req.Tuples)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(ctx, tuples...); err != nil {
+		s.logger.Errorf("%s: Failed to delete %d tuples: %v", op, len(tuples), err)
+		return err
+	}
+
+	s.logger.Infof("%s: Deleted %d tuples", op, len(tuples))
+	return nil
+}
+
+// parseTuples parses tuples and rejects those whose relation the schema does not define, as no check
+// would ever read them.
+func (s *authzService) parseTuples(raw []string) ([]authz.Tuple, error) {
+	tuples := make([]authz.Tuple, 0, len(raw))
+	for _, r := range raw {
+		t, err := authz.ParseTuple(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.checker.Schema.Rewrite(t.Object.Type, t.Relation); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, t)
+	}
+	return tuples, nil
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Kinds of emails stored in the outbox.
+const (
+	emailKindPasswordReset      = "password_reset"
+	emailKindEmailChangeConfirm = "email_change_confirmation"
+	emailKindEmailChangedNotice = "email_changed_notice"
+	emailKindPasswordChanged    = "password_changed"
+	emailKindVerification       = "verification"
+	emailKindAccountExists      = "account_exists"
+	emailKindNewLoginAlert      = "new_login_alert"
+	emailKindLoginChallenge     = "login_challenge"
+	emailKindOrgInvitation      = "organization_invitation"
+	emailKindAccountInvitation  = "account_invitation"
+)
+
+// secretPayloadFields are the payload fields that would let whoever reads them act as the
+// recipient. They are sealed in the outbox, which keeps emails until they are sent.
+var secretPayloadFields = []string{"token", "code"}
+
+// outboxEmailService implements EmailService by writing to the email outbox. When called with a
+// context inside a transaction the email is only queued if that transaction commits.
+type outboxEmailService struct {
+	repo   repositories.EmailOutboxRepository
+	sealer *utils.Sealer
+}
+
+func NewOutboxEmailService(repo repositories.EmailOutboxRepository, sealer *utils.Sealer) EmailService {
+	return &outboxEmailService{repo: repo, sealer: sealer}
+}
+
+func (s *outboxEmailService) SendPasswordResetEmail(ctx context.Context, to models.EmailRecipient, resetToken string) error {
+	return s.enqueue(ctx, emailKindPasswordReset, to, map[string]string{"token": resetToken})
+}
+
+func (s *outboxEmailService) SendEmailChangeConfirmation(ctx context.Context, to models.EmailRecipient, confirmToken string) error {
+	return s.enqueue(ctx, emailKindEmailChangeConfirm, to, map[string]string{"token": confirmToken})
+}
+
+func (s *outboxEmailService) SendEmailChangedNotice(ctx context.Context, to models.EmailRecipient, newEmail string) error {
+	return s.enqueue(ctx, emailKindEmailChangedNotice, to, map[string]string{"new_email": newEmail})
+}
+
+func (s *outboxEmailService) SendPasswordChangedEmail(ctx context.Context, to models.EmailRecipient) error {
+	return s.enqueue(ctx, emailKindPasswordChanged, to, nil)
+}
+
+func (s *outboxEmailService) SendVerificationEmail(ctx context.Context, to models.EmailRecipient, verifyToken string) error {
+	return s.enqueue(ctx, emailKindVerification, to, map[string]string{"token": verifyToken})
+}
+
+func (s *outboxEmailService) SendAccountExistsEmail(ctx context.Context, to models.EmailRecipient) error {
+	return s.enqueue(ctx, emailKindAccountExists, to, nil)
+}
+
+func (s *outboxEmailService) SendNewLoginAlert(ctx context.Context, to models.EmailRecipient, login *models.LoginNotice, reportToken string) error {
+	return s.enqueue(ctx, emailKindNewLoginAlert, to, map[string]string{
+		"token":      reportToken,
+		"device":     login.Device,
+		"ip_address": login.IPAddress,
+		"time":       login.Time.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *outboxEmailService) SendLoginChallengeEmail(ctx context.Context, to models.EmailRecipient, code string) error {
+	return s.enqueue(ctx, emailKindLoginChallenge, to, map[string]string{"code": code})
+}
+
+func (s *outboxEmailService) SendOrganizationInvitation(ctx context.Context, to models.EmailRecipient, invitation *models.InvitationNotice, inviteToken string) error {
+	return s.enqueue(ctx, emailKindOrgInvitation, to, map[string]string{
+		"token":        inviteToken,
+		"organization": invitation.Organization,
+		"inviter":      invitation.Inviter,
+		"role":         invitation.Role,
+	})
+}
+
+func (s *outboxEmailService) SendAccountInvitation(ctx context.Context, to models.EmailRecipient, setPasswordToken string) error {
+	return s.enqueue(ctx, emailKindAccountInvitation, to, map[string]string{"token": setPasswordToken})
+}
+
+// enqueue stores the email along with the recipient's name and locale. Emails carrying a token are
+// keyed by the token's hash, so queuing the same token twice sends one email; everything else gets
+// a fresh key. Tokens and codes are stored sealed, for the recipient and kind of the email.
+func (s *outboxEmailService) enqueue(ctx context.Context, kind string, to models.EmailRecipient, payload map[string]string) error {
+	key := kind + ":" + uuid.NewString()
+	if token, ok := payload["token"]; ok {
+		key = kind + ":" + utils.HashToken(token)
+	}
+
+	for _, field := range secretPayloadFields {
+		value, ok := payload[field]
+		if !ok {
+			continue
+		}
+		sealed, err := s.sealer.Seal(value, sealContext(kind, to.Email, field))
+		if err != nil {
+			return err
+		}
+		payload[field] = sealed
+	}
+
+	if payload == nil {
+		payload = make(map[string]string)
+	}
+	payload["name"] = to.Name
+	payload["locale"] = to.Locale
+
+	return s.repo.Enqueue(ctx, &models.OutboxEmail{
+		IdempotencyKey: key,
+		Kind:           kind,
+		Recipient:      to.Email,
+		Payload:        payload,
+	})
+}
+
+// EmailDispatcher sends the emails waiting in the outbox through another EmailService,
+// retrying failures with exponential backoff until they are moved to the dead-letter state.
+type EmailDispatcher struct {
+	Repo        repositories.EmailOutboxRepository
+	Sender      EmailService
+	Sealer      *utils.Sealer
+	Logger      logger.Logger
+	BatchSize   int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// sendLease is how long a claimed email stays hidden from other dispatchers while it is being sent.
+const sendLease = 5 * time.Minute
+
+// DispatchDue sends one batch of due emails and returns how many were delivered.
+func (d *EmailDispatcher) DispatchDue(ctx context.Context) (int64, error) {
+	const op = "EmailDispatcher.DispatchDue"
+
+	emails, err := d.Repo.ClaimDue(ctx, d.BatchSize, sendLease)
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int64
+	for _, email := range emails {
+		err := d.deliver(WithMessageID(ctx, email.IdempotencyKey), &email)
+		if err == nil {
+			if err := d.Repo.MarkSent(ctx, email.ID); err != nil {
+				d.Logger.Errorf("%s: Failed to mark email %s as sent: %v", op, email.ID, err)
+			}
+			sent++
+			continue
+		}
+
+		if email.Attempts >= d.MaxAttempts {
+			d.Logger.Errorf("%s: Giving up on %s email %s after %d attempts: %v", op, email.Kind, email.ID, email.Attempts, err)
+			if err := d.Repo.MarkDead(ctx, email.ID, err.Error()); err != nil {
+				d.Logger.Errorf("%s: Failed to mark email %s as dead: %v", op, email.ID, err)
+			}
+			continue
+		}
+
+		next := time.Now().Add(d.backoff(email.Attempts))
+		d.Logger.Errorf("%s: Failed to send %s email %s, retrying at %s: %v", op, email.Kind, email.ID, next.Format(time.RFC3339), err)
+		if err := d.Repo.MarkFailed(ctx, email.ID, err.Error(), next); err != nil {
+			d.Logger.Errorf("%s: Failed to record failure of email %s: %v", op, email.ID, err)
+		}
+	}
+
+	return sent, nil
+}
+
+// backoff returns the delay before the next attempt: BaseBackoff doubled for every failed
+// attempt, capped at MaxBackoff, with up to 20% random jitter.
+func (d *EmailDispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseBackoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+}
+
+// sealContext binds a sealed payload field to the email it was queued for.
+func sealContext(kind, recipient, field string) string {
+	return kind + "\x00" + recipient + "\x00" + field
+}
+
+// unseal decrypts the sealed fields of the payload in place. Emails queued before fields were
+// sealed still hold them in the clear and are sent as they are.
+func (d *EmailDispatcher) unseal(email *models.OutboxEmail) error {
+	for _, field := range secretPayloadFields {
+		value, ok := email.Payload[field]
+		if !ok || !utils.IsSealed(value) {
+			continue
+		}
+		plaintext, err := d.Sealer.Open(value, sealContext(email.Kind, email.Recipient, field))
+		if err != nil {
+			return fmt.Errorf("%s of email %s: %w", field, email.ID, err)
+		}
+		email.Payload[field] = plaintext
+	}
+	return nil
+}
+
+// deliver calls the sender method matching the kind of the email.
+func (d *EmailDispatcher) deliver(ctx context.Context, email *models.OutboxEmail) error {
+	if err := d.unseal(email); err != nil {
+		return err
+	}
+
+	to := models.EmailRecipient{
+		Email:  email.Recipient,
+		Name:   email.Payload["name"],
+		Locale: email.Payload["locale"],
+	}
+
+	switch email.Kind {
+	case emailKindPasswordReset:
+		return d.Sender.SendPasswordResetEmail(ctx, to, email.Payload["token"])
+	case emailKindEmailChangeConfirm:
+		return d.Sender.SendEmailChangeConfirmation(ctx, to, email.Payload["token"])
+	case emailKindEmailChangedNotice:
+		return d.Sender.SendEmailChangedNotice(ctx, to, email.Payload["new_email"])
+	case emailKindPasswordChanged:
+		return d.Sender.SendPasswordChangedEmail(ctx, to)
+	case emailKindVerification:
+		return d.Sender.SendVerificationEmail(ctx, to, email.Payload["token"])
+	case emailKindAccountExists:
+		return d.Sender.SendAccountExistsEmail(ctx, to)
+	case emailKindNewLoginAlert:
+		at, _ := time.Parse(time.RFC3339, email.Payload["time"])
+		return d.Sender.SendNewLoginAlert(ctx, to, &models.LoginNotice{
+			Device:    email.Payload["device"],
+			IPAddress: email.Payload["ip_address"],
+			Time:      at,
+		}, email.Payload["token"])
+	case emailKindLoginChallenge:
+		return d.Sender.SendLoginChallengeEmail(ctx, to, email.Payload["code"])
+	case emailKindOrgInvitation:
+		return d.Sender.SendOrganizationInvitation(ctx, to, &models.InvitationNotice{
+			Organization: email.Payload["organization"],
+			Inviter:      email.Payload["inviter"],
+			Role:         email.Payload["role"],
+		}, email.Payload["token"])
+	case emailKindAccountInvitation:
+		return d.Sender.SendAccountInvitation(ctx, to, email.Payload["token"])
+	default:
+		return fmt.Errorf("unknown email kind %q", email.Kind)
+	}
+}
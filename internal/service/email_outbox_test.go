@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/google/uuid"
+)
+
+// memoryOutbox keeps queued emails and hands all of them out as due.
+type memoryOutbox struct {
+	repositories.EmailOutboxRepository
+	emails []models.OutboxEmail
+	sent   []uuid.UUID
+}
+
+func (r *memoryOutbox) Enqueue(ctx context.Context, email *models.OutboxEmail) error {
+	email.ID = uuid.New()
+	email.Attempts = 1
+	r.emails = append(r.emails, *email)
+	return nil
+}
+
+func (r *memoryOutbox) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	return r.emails, nil
+}
+
+func (r *memoryOutbox) MarkSent(ctx context.Context, id uuid.UUID) error {
+	r.sent = append(r.sent, id)
+	return nil
+}
+
+func (r *memoryOutbox) MarkFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	return nil
+}
+
+// recordingSender remembers the secrets it was asked to send.
+type recordingSender struct {
+	EmailService
+	resetTokens []string
+	codes       []string
+}
+
+func (s *recordingSender) SendPasswordResetEmail(ctx context.Context, to models.EmailRecipient, resetToken string) error {
+	s.resetTokens = append(s.resetTokens, resetToken)
+	return nil
+}
+
+func (s *recordingSender) SendLoginChallengeEmail(ctx context.Context, to models.EmailRecipient, code string) error {
+	s.codes = append(s.codes, code)
+	return nil
+}
+
+func newTestSealer(t *testing.T, secret string) *utils.Sealer {
+	t.Helper()
+	sealer, err := utils.NewSealer(utils.DeriveKey(secret, "email-outbox"))
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+	return sealer
+}
+
+func TestOutboxSealsSecrets(t *testing.T) {
+	ctx := context.Background()
+	outbox := &memoryOutbox{}
+	sealer := newTestSealer(t, "secret")
+	emails := NewOutboxEmailService(outbox, sealer)
+	to := models.EmailRecipient{Email: "alice@example.com", Name: "Alice", Locale: "en"}
+
+	if err := emails.SendPasswordResetEmail(ctx, to, "reset-token"); err != nil {
+		t.Fatalf("SendPasswordResetEmail: %v", err)
+	}
+	if err := emails.SendLoginChallengeEmail(ctx, to, "123456"); err != nil {
+		t.Fatalf("SendLoginChallengeEmail: %v", err)
+	}
+
+	for _, email := range outbox.emails {
+		for field, value := range email.Payload {
+			if strings.Contains(value, "reset-token") || strings.Contains(value, "123456") {
+				t.Errorf("%s email stores %s in the clear: %q", email.Kind, field, value)
+			}
+		}
+	}
+	if want := emailKindPasswordReset + ":" + utils.HashToken("reset-token"); outbox.emails[0].IdempotencyKey != want {
+		t.Errorf("IdempotencyKey = %q, want %q", outbox.emails[0].IdempotencyKey, want)
+	}
+
+	sender := &recordingSender{}
+	dispatcher := &EmailDispatcher{Repo: outbox, Sender: sender, Sealer: sealer, Logger: discardLogger{}, MaxAttempts: 3}
+	sent, err := dispatcher.DispatchDue(ctx)
+	if err != nil || sent != 2 {
+		t.Fatalf("DispatchDue = %d, %v, want 2 sent", sent, err)
+	}
+	if len(sender.resetTokens) != 1 || sender.resetTokens[0] != "reset-token" {
+		t.Errorf("reset tokens sent = %q, want [reset-token]", sender.resetTokens)
+	}
+	if len(sender.codes) != 1 || sender.codes[0] != "123456" {
+		t.Errorf("codes sent = %q, want [123456]", sender.codes)
+	}
+}
+
+func TestOutboxRejectsMovedOrForeignSecrets(t *testing.T) {
+	ctx := context.Background()
+	outbox := &memoryOutbox{}
+	emails := NewOutboxEmailService(outbox, newTestSealer(t, "secret"))
+	to := models.EmailRecipient{Email: "alice@example.com"}
+	if err := emails.SendPasswordResetEmail(ctx, to, "reset-token"); err != nil {
+		t.Fatalf("SendPasswordResetEmail: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		sealer *utils.Sealer
+		modify func(email *models.OutboxEmail)
+	}{
+		{"other key", newTestSealer(t, "other secret"), func(*models.OutboxEmail) {}},
+		{"other recipient", newTestSealer(t, "secret"), func(email *models.OutboxEmail) { email.Recipient = "mallory@example.com" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := outbox.emails[0]
+			email.Payload = map[string]string{"token": outbox.emails[0].Payload["token"]}
+			tt.modify(&email)
+
+			sender := &recordingSender{}
+			dispatcher := &EmailDispatcher{Sender: sender, Sealer: tt.sealer}
+			if err := dispatcher.deliver(ctx, &email); err == nil {
+				t.Error("deliver succeeded")
+			}
+			if len(sender.resetTokens) != 0 {
+				t.Errorf("sent tokens %q", sender.resetTokens)
+			}
+		})
+	}
+}
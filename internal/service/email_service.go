@@ -1,56 +1,268 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"net/smtp"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/Nucleussss/auth-service/internal/db/models"
 	"github.com/Nucleussss/auth-service/pkg/logger"
 )
 
 type EmailService interface {
-	SendPasswordResetEmail(email, resetToken string) error
+	SendPasswordResetEmail(ctx context.Context, to models.EmailRecipient, resetToken string) error
+	SendEmailChangeConfirmation(ctx context.Context, to models.EmailRecipient, confirmToken string) error
+	SendEmailChangedNotice(ctx context.Context, to models.EmailRecipient, newEmail string) error
+	SendPasswordChangedEmail(ctx context.Context, to models.EmailRecipient) error
+	SendVerificationEmail(ctx context.Context, to models.EmailRecipient, verifyToken string) error
+	SendAccountExistsEmail(ctx context.Context, to models.EmailRecipient) error
+	SendNewLoginAlert(ctx context.Context, to models.EmailRecipient, login *models.LoginNotice, reportToken string) error
+	SendLoginChallengeEmail(ctx context.Context, to models.EmailRecipient, code string) error
+	SendOrganizationInvitation(ctx context.Context, to models.EmailRecipient, invitation *models.InvitationNotice, inviteToken string) error
+	// SendAccountInvitation asks users whose account was created for them to choose a password.
+	SendAccountInvitation(ctx context.Context, to models.EmailRecipient, setPasswordToken string) error
 	// Other email methods can be added here
 }
 
-type smtpEmailService struct {
-	smtpHost     string
-	smtpPort     string
-	smtpUsername string
-	smtpPassword string
-	fromEmail    string
-	logger       logger.Logger
+// recipientOf returns the recipient for emails to the current address of a user.
+func recipientOf(user *models.User) models.EmailRecipient {
+	return models.EmailRecipient{Email: user.Email, Name: user.Name, Locale: user.Locale}
 }
 
-func NewSmtpEmailService(host, port, username, password, from string, logger logger.Logger) EmailService {
-	return &smtpEmailService{
-		smtpHost:     host,
-		smtpPort:     port,
-		smtpUsername: username,
-		smtpPassword: password,
-		fromEmail:    from,
-		logger:       logger,
+type messageIDKey struct{}
+
+// WithMessageID attaches a stable message ID to ctx. Email services that support it send it as the
+// Message-ID header, so a message retried after an ambiguous failure can be deduplicated downstream.
+func WithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey{}, id)
+}
+
+func messageIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// EmailMessage is a rendered email to a single recipient, ready to be handed to a transport.
+type EmailMessage struct {
+	MessageID string    `json:"message_id"`
+	Template  string    `json:"template"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ToName    string    `json:"to_name"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html"`
+	Date      time.Time `json:"date"`
+}
+
+// MIME encodes the email as a MIME message, using multipart/alternative when it has an HTML part.
+func (m *EmailMessage) MIME() ([]byte, error) {
+	var buf bytes.Buffer
+
+	// Email headers
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", (&mail.Address{Name: m.ToName, Address: m.To}).String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", m.Date.Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		fmt.Fprintf(&buf, "Message-ID: %s\r\n", m.MessageID)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	// Clients show the last part they understand, so the HTML part goes after the text part
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// templateEmailService renders emails from templates and hands them to a transport.
+type templateEmailService struct {
+	transport EmailTransport
+	fromEmail string
+	baseURL   string
+	resetURL  string
+	// invitationURL is the page where invited users accept an invitation
+	invitationURL string
+	templates     *EmailTemplates
+	logger        logger.Logger
+}
+
+// NewTemplateEmailService returns an EmailService that renders emails from templates and delivers them
+// through transport. baseURL is the public address of this service, resetURL the page where users
+// choose a new password and invitationURL the page where they accept organization invitations.
+func NewTemplateEmailService(transport EmailTransport, from, baseURL, resetURL, invitationURL string, templates *EmailTemplates, logger logger.Logger) EmailService {
+	return &templateEmailService{
+		transport:     transport,
+		fromEmail:     from,
+		baseURL:       baseURL,
+		resetURL:      resetURL,
+		invitationURL: invitationURL,
+		templates:     templates,
+		logger:        logger,
 	}
 }
 
-func (s *smtpEmailService) SendPasswordResetEmail(email, resetToken string) error {
+func (s *templateEmailService) SendPasswordResetEmail(ctx context.Context, to models.EmailRecipient, resetToken string) error {
 	const op = "emailService.SendPasswordResetEmail"
+	return s.send(ctx, op, emailKindPasswordReset, to, &EmailTemplateData{
+		Link: withToken(s.resetURL, resetToken),
+	})
+}
+
+func (s *templateEmailService) SendEmailChangeConfirmation(ctx context.Context, to models.EmailRecipient, confirmToken string) error {
+	const op = "emailService.SendEmailChangeConfirmation"
+	return s.send(ctx, op, emailKindEmailChangeConfirm, to, &EmailTemplateData{
+		Link: withToken(s.baseURL+"/confirm-email-change", confirmToken),
+	})
+}
+
+func (s *templateEmailService) SendEmailChangedNotice(ctx context.Context, to models.EmailRecipient, newEmail string) error {
+	const op = "emailService.SendEmailChangedNotice"
+	return s.send(ctx, op, emailKindEmailChangedNotice, to, &EmailTemplateData{NewEmail: newEmail})
+}
+
+func (s *templateEmailService) SendPasswordChangedEmail(ctx context.Context, to models.EmailRecipient) error {
+	const op = "emailService.SendPasswordChangedEmail"
+	return s.send(ctx, op, emailKindPasswordChanged, to, &EmailTemplateData{Link: s.resetURL})
+}
+
+func (s *templateEmailService) SendVerificationEmail(ctx context.Context, to models.EmailRecipient, verifyToken string) error {
+	const op = "emailService.SendVerificationEmail"
+	return s.send(ctx, op, emailKindVerification, to, &EmailTemplateData{
+		Link: withToken(s.baseURL+"/verify-email", verifyToken),
+	})
+}
+
+func (s *templateEmailService) SendAccountExistsEmail(ctx context.Context, to models.EmailRecipient) error {
+	const op = "emailService.SendAccountExistsEmail"
+	return s.send(ctx, op, emailKindAccountExists, to, &EmailTemplateData{Link: s.resetURL})
+}
+
+func (s *templateEmailService) SendNewLoginAlert(ctx context.Context, to models.EmailRecipient, login *models.LoginNotice, reportToken string) error {
+	const op = "emailService.SendNewLoginAlert"
+	return s.send(ctx, op, emailKindNewLoginAlert, to, &EmailTemplateData{
+		Link:      withToken(s.baseURL+"/report-login", reportToken),
+		Device:    login.Device,
+		IPAddress: login.IPAddress,
+		Time:      login.Time.UTC().Format("2 Jan 2006 15:04 MST"),
+	})
+}
 
-	// Create the full address with host and port
-	smtpAddress := s.smtpHost + ":" + s.smtpPort
+func (s *templateEmailService) SendLoginChallengeEmail(ctx context.Context, to models.EmailRecipient, code string) error {
+	const op = "emailService.SendLoginChallengeEmail"
+	return s.send(ctx, op, emailKindLoginChallenge, to, &EmailTemplateData{Code: code, Link: s.resetURL})
+}
+
+func (s *templateEmailService) SendOrganizationInvitation(ctx context.Context, to models.EmailRecipient, invitation *models.InvitationNotice, inviteToken string) error {
+	const op = "emailService.SendOrganizationInvitation"
+	return s.send(ctx, op, emailKindOrgInvitation, to, &EmailTemplateData{
+		Link:         withToken(s.invitationURL, inviteToken),
+		Organization: invitation.Organization,
+		Inviter:      invitation.Inviter,
+		Role:         invitation.Role,
+	})
+}
 
-	// Authenticate
-	auth := smtp.PlainAuth("", s.smtpUsername, s.smtpPassword, s.smtpHost)
+func (s *templateEmailService) SendAccountInvitation(ctx context.Context, to models.EmailRecipient, setPasswordToken string) error {
+	const op = "emailService.SendAccountInvitation"
+	return s.send(ctx, op, emailKindAccountInvitation, to, &EmailTemplateData{
+		Link: withToken(s.resetURL, setPasswordToken),
+	})
+}
 
-	// Email content
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Password Reset\r\n\r\nReset token: %s",
-		s.fromEmail, email, resetToken)
+// send renders the named template for the recipient and delivers it.
+func (s *templateEmailService) send(ctx context.Context, op, template string, to models.EmailRecipient, data *EmailTemplateData) error {
+	data.Name = to.Name
+	data.Email = to.Email
 
-	//	Send the message
-	err := smtp.SendMail(smtpAddress, auth, s.fromEmail, []string{email}, []byte(msg))
+	email, err := s.templates.Render(template, to.Locale, data)
 	if err != nil {
-		s.logger.Errorf("Invalid password reset request: %v ", op, err)
+		s.logger.Errorf("%s: failed to render email: %v", op, err)
+		return err
+	}
+
+	msg := &EmailMessage{
+		Template: template,
+		From:     s.fromEmail,
+		To:       to.Email,
+		ToName:   to.Name,
+		Subject:  email.Subject,
+		Text:     email.Text,
+		HTML:     email.HTML,
+		Date:     time.Now(),
+	}
+	if id := messageIDFrom(ctx); id != "" {
+		msg.MessageID = fmt.Sprintf("<%s@%s>", id, messageIDDomain(s.fromEmail))
+	}
+
+	if err := s.transport.Send(ctx, msg); err != nil {
+		s.logger.Errorf("%s: failed to send email: %v", op, err)
 		return err
 	}
 
 	return nil
 }
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// withToken appends a token query parameter to a link.
+func withToken(link, token string) string {
+	sep := "?"
+	if strings.Contains(link, "?") {
+		sep = "&"
+	}
+	return link + sep + "token=" + url.QueryEscape(token)
+}
+
+// messageIDDomain returns the domain part of the sender address for use in Message-ID headers.
+func messageIDDomain(from string) string {
+	if _, domain, ok := strings.Cut(from, "@"); ok {
+		return strings.TrimSuffix(domain, ">")
+	}
+	return "localhost"
+}
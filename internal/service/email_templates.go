@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// defaultEmailTemplates holds the built-in templates. The layout is:
+//
+//	layout.html              HTML frame shared by every email, includes the "content" template and may use .Subject
+//	<locale>/<name>.txt      defines "subject"; the rest of the file is the plain text body
+//	<locale>/<name>.html     defines "content", the HTML body placed inside the layout
+//
+//go:embed templates
+var defaultEmailTemplates embed.FS
+
+// defaultEmailLocale is used when no template exists for the recipient's locale.
+const defaultEmailLocale = "en"
+
+// emailTemplateNames lists the templates every locale of the default set provides.
+var emailTemplateNames = []string{
+	emailKindPasswordReset,
+	emailKindEmailChangeConfirm,
+	emailKindEmailChangedNotice,
+	emailKindPasswordChanged,
+	emailKindVerification,
+	emailKindAccountExists,
+	emailKindNewLoginAlert,
+	emailKindLoginChallenge,
+	emailKindOrgInvitation,
+	emailKindAccountInvitation,
+}
+
+// EmailTemplateData is the data available to email templates.
+type EmailTemplateData struct {
+	Name     string
+	Email    string
+	Link     string
+	NewEmail string
+	Code     string
+
+	Device    string
+	IPAddress string
+	Time      string
+
+	Organization string
+	Inviter      string
+	Role         string
+}
+
+// RenderedEmail is an email ready to be sent. HTML is empty when the template has no HTML part.
+type RenderedEmail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// EmailTemplates renders localized emails from the built-in templates. Files in an optional
+// override directory, laid out the same way, take precedence over the built-in ones.
+type EmailTemplates struct {
+	sources []fs.FS
+
+	mu    sync.Mutex
+	cache map[string]*emailTemplate
+}
+
+// NewEmailTemplates loads the templates, checking that the default locale renders with any overrides applied.
+func NewEmailTemplates(overrideDir string) (*EmailTemplates, error) {
+	defaults, err := fs.Sub(defaultEmailTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &EmailTemplates{
+		sources: []fs.FS{defaults},
+		cache:   make(map[string]*emailTemplate),
+	}
+	if overrideDir != "" {
+		info, err := os.Stat(overrideDir)
+		if err != nil {
+			return nil, fmt.Errorf("email templates: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("email templates: %s is not a directory", overrideDir)
+		}
+		t.sources = []fs.FS{os.DirFS(overrideDir), defaults}
+	}
+
+	for _, name := range emailTemplateNames {
+		if _, err := t.lookup(defaultEmailLocale, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Render renders the named template in the best available locale for the recipient.
+func (t *EmailTemplates) Render(name, locale string, data *EmailTemplateData) (*RenderedEmail, error) {
+	tmpl, err := t.lookup(locale, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("email template %s: %w", name, err)
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("email template %s: %w", name, err)
+	}
+
+	email := &RenderedEmail{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+	if tmpl.html != nil {
+		var html bytes.Buffer
+		layoutData := struct {
+			*EmailTemplateData
+			Subject string
+		}{data, email.Subject}
+		if err := tmpl.html.ExecuteTemplate(&html, "layout.html", layoutData); err != nil {
+			return nil, fmt.Errorf("email template %s: %w", name, err)
+		}
+		email.HTML = html.String()
+	}
+
+	return email, nil
+}
+
+// lookup returns the parsed template for the first of the locale, its base language and the
+// default locale that has one.
+func (t *EmailTemplates) lookup(locale, name string) (*emailTemplate, error) {
+	key := locale + "/" + name
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tmpl, ok := t.cache[key]; ok {
+		return tmpl, nil
+	}
+
+	for _, candidate := range localeCandidates(locale) {
+		tmpl, err := t.parse(candidate, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.cache[key] = tmpl
+		return tmpl, nil
+	}
+
+	return nil, fmt.Errorf("email template %s: not found for locale %q", name, locale)
+}
+
+// parse parses the templates of one locale. It returns fs.ErrNotExist if the locale has no text template.
+func (t *EmailTemplates) parse(locale, name string) (*emailTemplate, error) {
+	textSrc, err := t.readFile(locale + "/" + name + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.New(name).Parse(textSrc)
+	if err != nil {
+		return nil, fmt.Errorf("email template %s/%s.txt: %w", locale, name, err)
+	}
+	if text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("email template %s/%s.txt: missing subject", locale, name)
+	}
+
+	tmpl := &emailTemplate{text: text}
+
+	htmlSrc, err := t.readFile(locale + "/" + name + ".html")
+	if errors.Is(err, fs.ErrNotExist) {
+		return tmpl, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	layout, err := t.readFile("layout.html")
+	if err != nil {
+		return nil, err
+	}
+
+	html, err := htmltemplate.New("layout.html").Parse(layout)
+	if err != nil {
+		return nil, fmt.Errorf("email template layout.html: %w", err)
+	}
+	if _, err := html.Parse(htmlSrc); err != nil {
+		return nil, fmt.Errorf("email template %s/%s.html: %w", locale, name, err)
+	}
+	tmpl.html = html
+
+	return tmpl, nil
+}
+
+// readFile reads a template file from the first source that has it.
+func (t *EmailTemplates) readFile(path string) (string, error) {
+	for _, source := range t.sources {
+		b, err := fs.ReadFile(source, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fs.ErrNotExist
+}
+
+// localeCandidates returns the locales to try for a BCP 47 tag, e.g. "pt-BR", "pt", "en".
+func localeCandidates(locale string) []string {
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			candidates = append(candidates, base)
+		}
+	}
+	return append(candidates, defaultEmailLocale)
+}
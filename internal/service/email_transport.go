@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Email backends selectable with EMAIL_BACKEND.
+const (
+	EmailBackendSMTP    = "smtp"
+	EmailBackendMaildir = "maildir"
+	EmailBackendStdout  = "stdout"
+	EmailBackendMemory  = "memory"
+)
+
+// TLS modes of the SMTP backend.
+const (
+	SMTPTLSAuto     = "auto"     // STARTTLS when the server offers it
+	SMTPTLSNone     = "none"     // never use TLS
+	SMTPTLSStartTLS = "starttls" // require STARTTLS
+	SMTPTLSImplicit = "tls"      // connect over TLS, usually on port 465
+)
+
+// smtpTimeout bounds a whole SMTP conversation when the context has no earlier deadline.
+const smtpTimeout = 30 * time.Second
+
+// EmailTransport delivers rendered emails.
+type EmailTransport interface {
+	Send(ctx context.Context, msg *EmailMessage) error
+}
+
+// EmailTransportConfig selects and configures an email backend.
+type EmailTransportConfig struct {
+	Backend string
+
+	SMTPHost               string
+	SMTPPort               string
+	SMTPUsername           string
+	SMTPPassword           string
+	SMTPTLS                string
+	SMTPInsecureSkipVerify bool
+
+	MaildirPath  string
+	CaptureLimit int
+}
+
+// NewEmailTransport returns the transport for the configured backend.
+func NewEmailTransport(cfg EmailTransportConfig) (EmailTransport, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", EmailBackendSMTP:
+		switch cfg.SMTPTLS {
+		case "":
+			cfg.SMTPTLS = SMTPTLSAuto
+		case SMTPTLSAuto, SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit:
+		default:
+			return nil, fmt.Errorf("unsupported SMTP TLS mode %q", cfg.SMTPTLS)
+		}
+		return &smtpTransport{
+			host:               cfg.SMTPHost,
+			port:               cfg.SMTPPort,
+			username:           cfg.SMTPUsername,
+			password:           cfg.SMTPPassword,
+			tlsMode:            cfg.SMTPTLS,
+			insecureSkipVerify: cfg.SMTPInsecureSkipVerify,
+		}, nil
+	case EmailBackendMaildir:
+		return NewMaildirTransport(cfg.MaildirPath)
+	case EmailBackendStdout:
+		return &writerTransport{w: os.Stdout}, nil
+	case EmailBackendMemory:
+		return NewCaptureTransport(cfg.CaptureLimit), nil
+	default:
+		return nil, fmt.Errorf("unsupported email backend %q", cfg.Backend)
+	}
+}
+
+// smtpTransport sends emails to an SMTP server.
+type smtpTransport struct {
+	host               string
+	port               string
+	username           string
+	password           string
+	tlsMode            string
+	insecureSkipVerify bool
+}
+
+func (t *smtpTransport) Send(ctx context.Context, msg *EmailMessage) error {
+	data, err := msg.MIME()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	// Create the full address with host and port
+	addr := net.JoinHostPort(t.host, t.port)
+	tlsConfig := &tls.Config{ServerName: t.host, InsecureSkipVerify: t.insecureSkipVerify}
+
+	var conn net.Conn
+	if t.tlsMode == SMTPTLSImplicit {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	switch t.tlsMode {
+	case SMTPTLSStartTLS, SMTPTLSAuto:
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if t.tlsMode == SMTPTLSStartTLS {
+			return fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+		}
+	}
+
+	// Authenticate
+	if t.username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+				return err
+			}
+		}
+	}
+
+	//	Send the message
+	if err := client.Mail(msg.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// maildirTransport stores emails as files in a Maildir, which most mail clients can open.
+type maildirTransport struct {
+	dir string
+	seq atomic.Uint64
+}
+
+// NewMaildirTransport returns a transport writing to the Maildir at dir, creating it if needed.
+func NewMaildirTransport(dir string) (EmailTransport, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("maildir path is not set")
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &maildirTransport{dir: dir}, nil
+}
+
+func (t *maildirTransport) Send(ctx context.Context, msg *EmailMessage) error {
+	data, err := msg.MIME()
+	if err != nil {
+		return err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	name := fmt.Sprintf("%d.%d_%d.%s", time.Now().Unix(), os.Getpid(), t.seq.Add(1), strings.ReplaceAll(host, "/", "_"))
+
+	// Write to tmp and move to new so readers never see a partial file
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// writerTransport prints a readable copy of every email, for local development.
+type writerTransport struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *writerTransport) Send(ctx context.Context, msg *EmailMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err := fmt.Fprintf(t.w, "----- email -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s----- end of email -----\n",
+		msg.From, msg.To, msg.Subject, msg.Text)
+	return err
+}
+
+// CaptureTransport keeps sent emails in memory so tests can inspect them. Only the most
+// recent emails up to the limit are kept.
+type CaptureTransport struct {
+	mu       sync.Mutex
+	limit    int
+	messages []EmailMessage
+}
+
+// NewCaptureTransport returns an empty capture transport. A limit of 0 or less keeps 1000 emails.
+func NewCaptureTransport(limit int) *CaptureTransport {
+	if limit <= 0 {
+		limit = 1000
+	}
+	return &CaptureTransport{limit: limit}
+}
+
+func (t *CaptureTransport) Send(ctx context.Context, msg *EmailMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	captured := *msg
+	if captured.MessageID == "" {
+		captured.MessageID = "<" + uuid.NewString() + ">"
+	}
+	t.messages = append(t.messages, captured)
+	if len(t.messages) > t.limit {
+		t.messages = t.messages[len(t.messages)-t.limit:]
+	}
+	return nil
+}
+
+// Messages returns the captured emails, oldest first. A non-empty to only returns emails to that address.
+func (t *CaptureTransport) Messages(to string) []EmailMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	messages := make([]EmailMessage, 0, len(t.messages))
+	for _, msg := range t.messages {
+		if to == "" || strings.EqualFold(msg.To, to) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Clear removes all captured emails.
+func (t *CaptureTransport) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrRoleNotFound         = errors.New("role not found")
+	ErrRegistrationRequired = errors.New("registration required")
+)
+
+type InvitationService interface {
+	Invite(ctx context.Context, inviterID uuid.UUID, req *models.CreateInvitationRequest) (*models.OrganizationInvitation, error)
+	ListInvitations(ctx context.Context) ([]models.OrganizationInvitation, error)
+	ResendInvitation(ctx context.Context, id uuid.UUID) error
+	RevokeInvitation(ctx context.Context, id uuid.UUID) error
+	AcceptInvitation(ctx context.Context, req *models.AcceptInvitationRequest) (*models.OrganizationInvitation, error)
+}
+
+// invitationService invites people to the organization the context is scoped to. Accepting an
+// invitation adds the invited address to the organization with the invitation's role, registering
+// an account for it first when there is none.
+type invitationService struct {
+	logger         logger.Logger
+	invitationRepo repositories.OrganizationInvitationRepository
+	orgRepo        repositories.OrganizationRepository
+	userRepo       repositories.UserRepository
+	txManager      repositories.TxManager
+	emailService   EmailService
+	authService    *AuthService
+	ttl            time.Duration
+}
+
+func NewInvitationService(
+	logger logger.Logger,
+	invitationRepo repositories.OrganizationInvitationRepository,
+	orgRepo repositories.OrganizationRepository,
+	userRepo repositories.UserRepository,
+	txManager repositories.TxManager,
+	emailService EmailService,
+	authService *AuthService,
+	ttl time.Duration,
+) InvitationService {
+	return &invitationService{
+		logger:         logger,
+		invitationRepo: invitationRepo,
+		orgRepo:        orgRepo,
+		userRepo:       userRepo,
+		txManager:      txManager,
+		emailService:   emailService,
+		authService:    authService,
+		ttl:            ttl,
+	}
+}
+
+// Invite invites an email address to the organization and emails them the invitation.
+// Inviting an address again replaces its pending invitation.
+func (s *invitationService) Invite(ctx context.Context, inviterID uuid.UUID, req *models.CreateInvitationRequest) (*models.OrganizationInvitation, error) {
+	const op = "InvitationService.Invite"
+
+	invitation := &models.OrganizationInvitation{
+		Email:     req.Email,
+		Role:      req.Role,
+		Locale:    req.Locale,
+		InvitedBy: &inviterID,
+	}
+	if invitation.Role == "" {
+		invitation.Role = OrgRoleMember
+	}
+	if invitation.Locale == "" {
+		invitation.Locale = defaultEmailLocale
+	}
+
+	hasRole, err := s.orgRepo.HasRole(ctx, invitation.Role)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to look up role %s: %v", op, invitation.Role, err)
+		return nil, err
+	}
+	if !hasRole {
+		return nil, ErrRoleNotFound
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		token, err := s.issue(ctx, invitation)
+		if err != nil {
+			return err
+		}
+		if err := s.invitationRepo.Create(ctx, invitation); err != nil {
+			return err
+		}
+		return s.send(ctx, invitation, token)
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to invite %s: %v", op, req.Email, err)
+		return nil, err
+	}
+
+	s.logger.Infof("%s: User %s invited %s to organization %s", op, inviterID, invitation.Email, invitation.OrgID)
+	return invitation, nil
+}
+
+// ListInvitations returns the pending invitations of the organization.
+func (s *invitationService) ListInvitations(ctx context.Context) ([]models.OrganizationInvitation, error) {
+	const op = "InvitationService.ListInvitations"
+
+	invitations, err := s.invitationRepo.ListPending(ctx)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to list invitations: %v", op, err)
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// ResendInvitation emails a pending invitation again with a new link and a renewed expiry.
+// The link sent earlier stops working.
+func (s *invitationService) ResendInvitation(ctx context.Context, id uuid.UUID) error {
+	const op = "InvitationService.ResendInvitation"
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		invitation, err := s.invitationRepo.FindPending(ctx, id)
+		if err != nil {
+			return err
+		}
+		if invitation == nil {
+			return ErrInvitationNotFound
+		}
+
+		token, err := s.issue(ctx, invitation)
+		if err != nil {
+			return err
+		}
+		if _, err := s.invitationRepo.Renew(ctx, id, invitation.TokenHash, invitation.ExpiresAt); err != nil {
+			return err
+		}
+		return s.send(ctx, invitation, token)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInvitationNotFound) {
+			s.logger.Errorf("%s: Failed to resend invitation %s: %v", op, id, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RevokeInvitation deletes a pending invitation so its link stops working.
+func (s *invitationService) RevokeInvitation(ctx context.Context, id uuid.UUID) error {
+	const op = "InvitationService.RevokeInvitation"
+
+	deleted, err := s.invitationRepo.Delete(ctx, id)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to delete invitation %s: %v", op, id, err)
+		return err
+	}
+	if !deleted {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation adds the invited address to the organization with the invitation's role. When no
+// account exists for the address yet, one is registered with the name and password of the request,
+// and ErrRegistrationRequired is returned if they are missing. The invitation stays valid until
+// it has been accepted.
+func (s *invitationService) AcceptInvitation(ctx context.Context, req *models.AcceptInvitationRequest) (*models.OrganizationInvitation, error) {
+	const op = "InvitationService.AcceptInvitation"
+
+	var invitation *models.OrganizationInvitation
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		invitation, err = s.invitationRepo.Consume(ctx, utils.HashToken(req.Token))
+		if err != nil {
+			return err
+		}
+		if invitation == nil {
+			return ErrInvalidToken
+		}
+
+		exists, err := s.userRepo.ExistsbyEmail(ctx, invitation.Email)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if req.Name == "" || req.Password == "" {
+				return ErrRegistrationRequired
+			}
+
+			locale := req.Locale
+			if locale == "" {
+				locale = invitation.Locale
+			}
+			err := s.authService.Register(ctx, &models.RegisterRequest{
+				Name:     req.Name,
+				Email:    invitation.Email,
+				Password: req.Password,
+				Locale:   locale,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		user, err := s.userRepo.FindbyEmail(ctx, invitation.Email)
+		if err != nil {
+			return err
+		}
+		// the token was mailed to the address, so accepting it proves the user owns the address, and
+		// the account is not swept away as an unverified one
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return err
+		}
+
+		ctx = repositories.WithOrganization(ctx, invitation.OrgID)
+		if err := s.orgRepo.AddMember(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.orgRepo.AssignRole(ctx, user.ID, invitation.Role)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRegistrationRequired):
+			// the caller needs the invited address to ask for the account details
+			return invitation, err
+		case !errors.Is(err, ErrInvalidToken):
+			s.logger.Errorf("%s: Failed to accept invitation: %v", op, err)
+		}
+		return nil, err
+	}
+
+	s.logger.Infof("%s: %s joined organization %s as %s", op, invitation.Email, invitation.OrgID, invitation.Role)
+	return invitation, nil
+}
+
+// issue generates a new token for the invitation, storing its hash and expiry on it, and returns the token.
+func (s *invitationService) issue(ctx context.Context, invitation *models.OrganizationInvitation) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	invitation.TokenHash = utils.HashToken(token)
+	invitation.ExpiresAt = time.Now().Add(s.ttl)
+	return token, nil
+}
+
+// send emails the invitation, addressing existing users by name and in their language.
+func (s *invitationService) send(ctx context.Context, invitation *models.OrganizationInvitation, token string) error {
+	org, err := s.orgRepo.FindByID(ctx, invitation.OrgID)
+	if err != nil {
+		return err
+	}
+	if org == nil {
+		return ErrInvitationNotFound
+	}
+
+	notice := &models.InvitationNotice{
+		Organization: org.Name,
+		Role:         invitation.Role,
+	}
+	if invitation.InvitedBy != nil {
+		inviter, err := s.userRepo.FindbyID(ctx, *invitation.InvitedBy)
+		switch {
+		case err == nil:
+			notice.Inviter = inviter.Name
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+	}
+
+	to := models.EmailRecipient{Email: invitation.Email, Locale: invitation.Locale}
+	user, err := s.userRepo.FindbyEmail(ctx, invitation.Email)
+	if err == nil {
+		to = recipientOf(user)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return s.emailService.SendOrganizationInvitation(ctx, to, notice, token)
+}
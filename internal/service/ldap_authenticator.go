@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+// LDAPConfig configures the LDAP authenticator.
+type LDAPConfig struct {
+	// URL of the directory, ldap:// or ldaps://
+	URL      string
+	StartTLS bool
+	// BindDN and BindPassword are the service account used to look users up. Searches are
+	// anonymous when BindDN is empty.
+	BindDN       string
+	BindPassword string
+	UserBaseDN   string
+	// UserFilter finds the entry of a user; every %s is replaced with the escaped login.
+	UserFilter     string
+	EmailAttribute string
+	NameAttribute  string
+	// GroupRoles maps groups to global roles as role:groupDN pairs separated by semicolons.
+	GroupRoles string
+	Timeout    time.Duration
+}
+
+type ldapGroupRole struct {
+	group *ldap.DN
+	role  string
+}
+
+// ldapIdentity is what the directory tells about a user who bound successfully.
+type ldapIdentity struct {
+	dn     string
+	email  string
+	name   string
+	groups []string
+}
+
+// ldapAuthenticator binds to a directory, e.g. Active Directory, as the user logging in. Users are
+// created locally on their first login and their mapped roles follow their groups on every login.
+type ldapAuthenticator struct {
+	cfg        LDAPConfig
+	groupRoles []ldapGroupRole
+	// managed lists the roles that come from groups; other roles of the users are left alone
+	managed   []string
+	userRepo  repositories.UserRepository
+	roleRepo  repositories.RoleRepository
+	txManager repositories.TxManager
+	logger    logger.Logger
+}
+
+func NewLDAPAuthenticator(
+	cfg LDAPConfig,
+	userRepo repositories.UserRepository,
+	roleRepo repositories.RoleRepository,
+	txManager repositories.TxManager,
+	logger logger.Logger,
+) (Authenticator, error) {
+	if cfg.URL == "" || cfg.UserBaseDN == "" || cfg.UserFilter == "" {
+		return nil, fmt.Errorf("LDAP needs a URL, a user base DN and a user filter")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+
+	a := &ldapAuthenticator{
+		cfg:       cfg,
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+		txManager: txManager,
+		logger:    logger,
+	}
+
+	for _, pair := range strings.Split(cfg.GroupRoles, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		role, group, ok := strings.Cut(pair, ":")
+		role = strings.TrimSpace(role)
+		if !ok || role == "" {
+			return nil, fmt.Errorf("invalid LDAP group mapping %q, expected role:groupDN", pair)
+		}
+		dn, err := ldap.ParseDN(strings.TrimSpace(group))
+		if err != nil {
+			return nil, fmt.Errorf("invalid group DN in LDAP group mapping %q: %w", pair, err)
+		}
+		a.groupRoles = append(a.groupRoles, ldapGroupRole{group: dn, role: role})
+		if !slices.Contains(a.managed, role) {
+			a.managed = append(a.managed, role)
+		}
+	}
+
+	return a, nil
+}
+
+func (a *ldapAuthenticator) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	const op = "ldapAuthenticator.Authenticate"
+
+	identity, err := a.bind(email, password)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			a.logger.Errorf("%s: Failed to authenticate %s against the directory: %v", op, email, err)
+			return nil, err
+		}
+
+		a.logger.Errorf("%s: Directory refused the credentials of %s", op, email)
+		// users who logged in before get the failure counted against them
+		user, err := a.userRepo.FindbyEmail(ctx, email)
+		if err != nil {
+			return nil, ErrInvalidCredentials
+		}
+		return user, ErrInvalidCredentials
+	}
+
+	user, err := a.provision(ctx, identity)
+	if err != nil {
+		a.logger.Errorf("%s: Failed to provision user %s: %v", op, identity.dn, err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (a *ldapAuthenticator) LocalPasswords() bool {
+	return false
+}
+
+// bind looks up the entry of a login with the service account and binds as it with password.
+func (a *ldapAuthenticator) bind(login, password string) (*ldapIdentity, error) {
+	// an empty password makes an unauthenticated bind, which many directories accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("bind as service account: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "%s", ldap.EscapeFilter(login))
+	attributes := []string{a.cfg.EmailAttribute, a.cfg.NameAttribute, "memberOf"}
+	// a size limit of 2 is enough to tell a unique entry from an ambiguous login
+	req := ldap.NewSearchRequest(
+		a.cfg.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(a.cfg.Timeout.Seconds()), false, filter, attributes, nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("search for user: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("bind as user: %w", err)
+	}
+
+	identity := &ldapIdentity{
+		dn:     entry.DN,
+		email:  entry.GetAttributeValue(a.cfg.EmailAttribute),
+		name:   entry.GetAttributeValue(a.cfg.NameAttribute),
+		groups: entry.GetAttributeValues("memberOf"),
+	}
+	if identity.email == "" {
+		identity.email = login
+	}
+	if identity.name == "" {
+		identity.name, _, _ = strings.Cut(identity.email, "@")
+	}
+	return identity, nil
+}
+
+func (a *ldapAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("connect to directory: %w", err)
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		u, _ := url.Parse(a.cfg.URL)
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// ldapExternalIDPrefix marks the external IDs of users that belong to the directory.
+const ldapExternalIDPrefix = "ldap:"
+
+// provision returns the local user of a directory identity, creating it on the first login, and
+// gives it the roles its groups map to. Local accounts that were not created for the same
+// directory entry are never taken over.
+func (a *ldapAuthenticator) provision(ctx context.Context, identity *ldapIdentity) (*models.User, error) {
+	const op = "ldapAuthenticator.provision"
+
+	roles := a.rolesFor(identity.groups)
+
+	user, err := a.userRepo.FindbyEmail(ctx, identity.email)
+	switch {
+	case err == nil:
+		if !linkedTo(user, identity.dn) {
+			a.logger.Errorf("%s: Refused login of %s, the local account %s does not belong to the directory", op, identity.dn, user.ID)
+			return nil, ErrInvalidCredentials
+		}
+		if err := a.roleRepo.SyncGlobalRoles(ctx, user.ID, a.managed, roles); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	// The local password is never used, the directory checks every login
+	password, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID uuid.UUID
+	externalID := ldapExternalIDPrefix + identity.dn
+	err = a.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		userID, err = a.userRepo.Create(ctx, &models.CreateNewUser{
+			Name:         identity.name,
+			Email:        identity.email,
+			PasswordHash: passwordHash,
+			Locale:       defaultEmailLocale,
+		})
+		if err != nil {
+			return err
+		}
+		if err := a.userRepo.MarkEmailVerified(ctx, userID); err != nil {
+			return err
+		}
+		if err := a.userRepo.SetExternalID(ctx, userID, &externalID); err != nil {
+			return err
+		}
+		return a.roleRepo.SyncGlobalRoles(ctx, userID, a.managed, roles)
+	})
+	if err != nil {
+		// a concurrent first login of the same user got there first
+		if isUniqueViolation(err) {
+			return a.provision(ctx, identity)
+		}
+		return nil, err
+	}
+
+	a.logger.Infof("%s: Provisioned user %s for %s", op, userID, identity.dn)
+	return a.userRepo.FindbyID(ctx, userID)
+}
+
+// linkedTo reports whether user was provisioned for the directory entry dn.
+func linkedTo(user *models.User, dn string) bool {
+	if user.ExternalID == nil {
+		return false
+	}
+	linked, ok := strings.CutPrefix(*user.ExternalID, ldapExternalIDPrefix)
+	if !ok {
+		return false
+	}
+	linkedDN, err := ldap.ParseDN(linked)
+	if err != nil {
+		return false
+	}
+	entryDN, err := ldap.ParseDN(dn)
+	return err == nil && linkedDN.EqualFold(entryDN)
+}
+
+// rolesFor returns the roles the groups of a user map to.
+func (a *ldapAuthenticator) rolesFor(groups []string) []string {
+	roles := []string{}
+	for _, group := range groups {
+		dn, err := ldap.ParseDN(group)
+		if err != nil {
+			continue
+		}
+		for _, gr := range a.groupRoles {
+			if gr.group.EqualFold(dn) && !slices.Contains(roles, gr.role) {
+				roles = append(roles, gr.role)
+			}
+		}
+	}
+	return roles
+}
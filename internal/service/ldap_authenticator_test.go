@@ -0,0 +1,379 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+const (
+	testServiceDN       = "cn=svc,dc=example,dc=com"
+	testServicePassword = "svc-secret"
+	testAdminsGroup     = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+// directoryEntry is a user of the directory stand-in.
+type directoryEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeDirectory is an in-process LDAP server that answers simple binds and equality searches.
+type fakeDirectory struct {
+	mu      sync.Mutex
+	entries []directoryEntry
+}
+
+func startDirectory(t *testing.T, entries ...directoryEntry) (*fakeDirectory, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	d := &fakeDirectory{entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d, "ldap://" + listener.Addr().String()
+}
+
+func (d *fakeDirectory) setGroups(dn string, groups ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.entries {
+		if d.entries[i].dn == dn {
+			d.entries[i].attrs["memberOf"] = groups
+		}
+	}
+}
+
+func (d *fakeDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	boundDN := ""
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Value.(string)
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if d.checkPassword(name, op.Children[2].Data.String()) {
+				boundDN, code = name, ldap.LDAPResultSuccess
+			}
+			writeMessage(conn, id, ldapResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			if boundDN != testServiceDN {
+				writeMessage(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				writeMessage(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultFilterError))
+				continue
+			}
+			for _, entry := range d.search(filter) {
+				writeMessage(conn, id, searchEntry(entry))
+			}
+			writeMessage(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		default:
+			return
+		}
+	}
+}
+
+func (d *fakeDirectory) checkPassword(dn, password string) bool {
+	if dn == testServiceDN {
+		return password == testServicePassword
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entry := range d.entries {
+		if entry.dn == dn {
+			return entry.password == password
+		}
+	}
+	return false
+}
+
+// search supports the (attribute=value) filters the tests configure.
+func (d *fakeDirectory) search(filter string) []directoryEntry {
+	attr, value, _ := strings.Cut(strings.Trim(filter, "()"), "=")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var found []directoryEntry
+	for _, entry := range d.entries {
+		if slices.ContainsFunc(entry.attrs[attr], func(v string) bool { return strings.EqualFold(v, value) }) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+func writeMessage(conn net.Conn, id int64, op *ber.Packet) {
+	msg := ber.NewSequence("LDAP Response")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	msg.AppendChild(op)
+	_, _ = conn.Write(msg.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code uint16) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return res
+}
+
+func searchEntry(entry directoryEntry) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attrs := ber.NewSequence("attributes")
+	for name, values := range entry.attrs {
+		attr := ber.NewSequence("attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	res.AppendChild(attrs)
+	return res
+}
+
+// memoryUsers keeps users in memory. Methods the authenticator does not use panic.
+type memoryUsers struct {
+	repositories.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func (r *memoryUsers) FindbyEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return &models.User{}, sql.ErrNoRows
+}
+
+func (r *memoryUsers) FindbyID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return &models.User{}, sql.ErrNoRows
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *models.CreateNewUser) (uuid.UUID, error) {
+	id := uuid.New()
+	r.users[id] = &models.User{
+		ID:           id,
+		Name:         user.Name,
+		Email:        user.Email,
+		PasswordHash: user.PasswordHash,
+		Locale:       user.Locale,
+		IsActive:     true,
+	}
+	return id, nil
+}
+
+func (r *memoryUsers) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	r.users[id].EmailVerifiedAt = &now
+	return nil
+}
+
+func (r *memoryUsers) SetExternalID(ctx context.Context, id uuid.UUID, externalID *string) error {
+	r.users[id].ExternalID = externalID
+	return nil
+}
+
+// memoryRoles records the global roles given to users.
+type memoryRoles struct {
+	repositories.RoleRepository
+	roles map[uuid.UUID][]string
+}
+
+func (r *memoryRoles) SyncGlobalRoles(ctx context.Context, userID uuid.UUID, managed, granted []string) error {
+	if userID == uuid.Nil {
+		return errors.New("sync roles of the nil user")
+	}
+	kept := slices.DeleteFunc(slices.Clone(r.roles[userID]), func(role string) bool { return slices.Contains(managed, role) })
+	r.roles[userID] = append(kept, granted...)
+	return nil
+}
+
+type noTx struct{}
+
+func (noTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Infof(string, ...interface{})  {}
+func (discardLogger) Fatalf(string, ...interface{}) {}
+func (discardLogger) Errorf(string, ...interface{}) {}
+func (discardLogger) Debugf(string, ...interface{}) {}
+
+const aliceDN = "uid=alice,ou=people,dc=example,dc=com"
+
+func newTestLDAP(t *testing.T) (Authenticator, *fakeDirectory, *memoryUsers, *memoryRoles) {
+	t.Helper()
+
+	directory, url := startDirectory(t, directoryEntry{
+		dn:       aliceDN,
+		password: "alice-secret",
+		attrs: map[string][]string{
+			"mail":     {"alice@example.com"},
+			"cn":       {"Alice Liddell"},
+			"memberOf": {testAdminsGroup},
+		},
+	})
+	users := &memoryUsers{users: map[uuid.UUID]*models.User{}}
+	roles := &memoryRoles{roles: map[uuid.UUID][]string{}}
+
+	auth, err := NewLDAPAuthenticator(LDAPConfig{
+		URL:            url,
+		BindDN:         testServiceDN,
+		BindPassword:   testServicePassword,
+		UserBaseDN:     "ou=people,dc=example,dc=com",
+		UserFilter:     "(mail=%s)",
+		EmailAttribute: "mail",
+		NameAttribute:  "cn",
+		GroupRoles:     "admin:" + testAdminsGroup,
+		Timeout:        5 * time.Second,
+	}, users, roles, noTx{}, discardLogger{})
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator: %v", err)
+	}
+	return auth, directory, users, roles
+}
+
+func TestLDAPAuthenticatorFirstLogin(t *testing.T) {
+	auth, _, users, roles := newTestLDAP(t)
+
+	user, err := auth.Authenticate(context.Background(), "alice@example.com", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.ID == uuid.Nil || !user.IsActive {
+		t.Fatalf("got user %+v, want a provisioned active user", user)
+	}
+	stored := users.users[user.ID]
+	if stored.Name != "Alice Liddell" || stored.EmailVerifiedAt == nil {
+		t.Errorf("stored user %+v, want name from the directory and a verified email", stored)
+	}
+	if stored.ExternalID == nil || *stored.ExternalID != ldapExternalIDPrefix+aliceDN {
+		t.Errorf("external ID = %v, want it linked to %s", stored.ExternalID, aliceDN)
+	}
+	if got := roles.roles[user.ID]; !slices.Equal(got, []string{"admin"}) {
+		t.Errorf("roles = %v, want [admin]", got)
+	}
+}
+
+func TestLDAPAuthenticatorReturningLogin(t *testing.T) {
+	auth, directory, users, roles := newTestLDAP(t)
+	ctx := context.Background()
+
+	first, err := auth.Authenticate(ctx, "alice@example.com", "alice-secret")
+	if err != nil {
+		t.Fatalf("first Authenticate: %v", err)
+	}
+	roles.roles[first.ID] = append(roles.roles[first.ID], "support")
+
+	// leaving the group takes the mapped role away but keeps roles given locally
+	directory.setGroups(aliceDN)
+	again, err := auth.Authenticate(ctx, "alice@example.com", "alice-secret")
+	if err != nil {
+		t.Fatalf("second Authenticate: %v", err)
+	}
+	if again.ID != first.ID || len(users.users) != 1 {
+		t.Fatalf("returning login created another user")
+	}
+	if got := roles.roles[first.ID]; !slices.Equal(got, []string{"support"}) {
+		t.Errorf("roles = %v, want [support]", got)
+	}
+
+	directory.setGroups(aliceDN, testAdminsGroup)
+	if _, err := auth.Authenticate(ctx, "alice@example.com", "alice-secret"); err != nil {
+		t.Fatalf("third Authenticate: %v", err)
+	}
+	if got := roles.roles[first.ID]; !slices.Equal(got, []string{"support", "admin"}) {
+		t.Errorf("roles = %v, want [support admin]", got)
+	}
+}
+
+func TestLDAPAuthenticatorWrongPassword(t *testing.T) {
+	auth, _, users, _ := newTestLDAP(t)
+	ctx := context.Background()
+
+	if _, err := auth.Authenticate(ctx, "alice@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: err = %v, want ErrInvalidCredentials", err)
+	}
+	if len(users.users) != 0 {
+		t.Fatalf("a failed login provisioned a user")
+	}
+
+	user, err := auth.Authenticate(ctx, "alice@example.com", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	failed, err := auth.Authenticate(ctx, "alice@example.com", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("known user: err = %v, want ErrInvalidCredentials", err)
+	}
+	if failed == nil || failed.ID != user.ID {
+		t.Errorf("known user: got %v, want the user so the failure is counted", failed)
+	}
+
+	if _, err := auth.Authenticate(ctx, "alice@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("empty password: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPAuthenticatorKeepsLocalAccounts(t *testing.T) {
+	auth, _, users, roles := newTestLDAP(t)
+
+	local := uuid.New()
+	users.users[local] = &models.User{ID: local, Email: "alice@example.com", IsActive: true}
+
+	if _, err := auth.Authenticate(context.Background(), "alice@example.com", "alice-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if users.users[local].ExternalID != nil || len(roles.roles[local]) != 0 {
+		t.Errorf("the local account was taken over by the directory")
+	}
+}
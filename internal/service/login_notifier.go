@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// LoginNotifier remembers the devices and IP addresses users sign in from and emails an alert
+// when a sign-in comes from a new one. The alert links back to ReportLogin.
+type LoginNotifier struct {
+	Devices   repositories.KnownDeviceRepository
+	Alerts    repositories.LoginAlertRepository
+	Sessions  repositories.SessionRepository
+	Users     repositories.UserRepository
+	TxManager repositories.TxManager
+	Email     EmailService
+	Resets    PasswordResetService
+	Logger    logger.Logger
+	// AlertTTL is how long the "this wasn't me" link in an alert stays valid.
+	AlertTTL time.Duration
+}
+
+// deviceCookieHash returns the known-device key for a device cookie.
+func deviceCookieHash(deviceToken string) string {
+	return utils.HashToken("cookie:" + deviceToken)
+}
+
+// deviceFingerprintHash returns the known-device key for clients that do not send the device cookie.
+func deviceFingerprintHash(client *models.ClientInfo) string {
+	return utils.HashToken("fingerprint:" + client.UserAgent)
+}
+
+// knownDeviceHash returns the key the client's device is looked up by: its device cookie, or its
+// fingerprint for clients that do not send the cookie.
+func knownDeviceHash(client *models.ClientInfo) string {
+	if client.DeviceToken != "" {
+		return deviceCookieHash(client.DeviceToken)
+	}
+	return deviceFingerprintHash(client)
+}
+
+// CheckLogin records the device and IP address of a successful sign-in and sends an alert if either
+// is new for the user. deviceToken is the device cookie sent by the client, or the one issued with
+// this sign-in if it sent none. The first sign-in of a user is never reported. Failures are only
+// logged since the login itself already succeeded.
+func (n *LoginNotifier) CheckLogin(ctx context.Context, user *models.User, client *models.ClientInfo, sessionID uuid.UUID, deviceToken string) {
+	const op = "LoginNotifier.CheckLogin"
+
+	// Clients without the cookie are recognized by their fingerprint until they send it
+	lookup := knownDeviceHash(client)
+	hashes := []string{lookup}
+	if hash := deviceCookieHash(deviceToken); hash != lookup {
+		hashes = append(hashes, hash)
+	}
+
+	hasAny, err := n.Devices.HasAny(ctx, user.ID)
+	if err != nil {
+		n.Logger.Errorf("%s: Failed to look up devices of user %s: %v", op, user.ID, err)
+		return
+	}
+	knownDevice, err := n.Devices.IsKnownDevice(ctx, user.ID, lookup)
+	if err != nil {
+		n.Logger.Errorf("%s: Failed to look up device of user %s: %v", op, user.ID, err)
+		return
+	}
+	knownIP, err := n.Devices.IsKnownIP(ctx, user.ID, client.IPAddress)
+	if err != nil {
+		n.Logger.Errorf("%s: Failed to look up IP address of user %s: %v", op, user.ID, err)
+		return
+	}
+
+	err = n.TxManager.WithinTx(ctx, func(ctx context.Context) error {
+		for _, hash := range hashes {
+			if err := n.Devices.Remember(ctx, user.ID, hash, client.UserAgent, client.IPAddress); err != nil {
+				return err
+			}
+		}
+
+		if !hasAny || (knownDevice && knownIP) {
+			return nil
+		}
+
+		token, err := utils.GenerateSecureToken(32)
+		if err != nil {
+			return err
+		}
+		err = n.Alerts.Create(ctx, &models.LoginAlert{
+			TokenHash:    utils.HashToken(token),
+			UserID:       user.ID,
+			SessionID:    sessionID,
+			DeviceHashes: hashes,
+			ExpiresAt:    time.Now().Add(n.AlertTTL),
+		})
+		if err != nil {
+			return err
+		}
+
+		device := client.Device
+		if device == "" {
+			device = describeDevice(client.UserAgent)
+		}
+
+		n.Logger.Infof("%s: Sign-in of user %s from a new device or IP %s", op, user.ID, client.IPAddress)
+		return n.Email.SendNewLoginAlert(ctx, recipientOf(user), &models.LoginNotice{
+			Device:    device,
+			IPAddress: client.IPAddress,
+			Time:      time.Now(),
+		}, token)
+	})
+	if err != nil {
+		n.Logger.Errorf("%s: Failed to record sign-in of user %s: %v", op, user.ID, err)
+	}
+}
+
+// ReportLogin handles the "this wasn't me" link of an alert: it signs out the reported session,
+// forgets its device and sends the user a password reset email.
+func (n *LoginNotifier) ReportLogin(ctx context.Context, token string) error {
+	const op = "LoginNotifier.ReportLogin"
+
+	var user *models.User
+	err := n.TxManager.WithinTx(ctx, func(ctx context.Context) error {
+		alert, err := n.Alerts.Consume(ctx, utils.HashToken(token))
+		if err != nil {
+			return err
+		}
+		if alert == nil {
+			return ErrInvalidToken
+		}
+
+		if _, err := n.Sessions.Delete(ctx, alert.SessionID, alert.UserID); err != nil {
+			return err
+		}
+		if err := n.Devices.Forget(ctx, alert.UserID, alert.DeviceHashes); err != nil {
+			return err
+		}
+
+		user, err = n.Users.FindbyID(ctx, alert.UserID)
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			n.Logger.Errorf("%s: Failed to revoke reported session: %v", op, err)
+		}
+		return err
+	}
+
+	n.Logger.Infof("%s: User %s reported a sign-in, session revoked", op, user.ID)
+
+	if _, err := n.Resets.RequestReset(ctx, user.Email); err != nil {
+		n.Logger.Errorf("%s: Failed to start password reset for user %s: %v", op, user.ID, err)
+		return err
+	}
+
+	return nil
+}
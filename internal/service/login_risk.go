@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/risk"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var ErrLoginBlocked = errors.New("login blocked")
+
+const (
+	// loginChallengeCodeDigits is the length of the code emailed for risky logins.
+	loginChallengeCodeDigits = 6
+	// maxLoginChallengeAttempts is how many wrong codes a challenge accepts before it is discarded.
+	maxLoginChallengeAttempts = 5
+	// loginHistorySize is how many past logins the time-of-day rule compares with.
+	loginHistorySize = 20
+)
+
+// LoginRisk records login attempts, scores logins with correct credentials and confirms risky
+// ones with a code sent by email.
+type LoginRisk struct {
+	Attempts   repositories.LoginAttemptRepository
+	Devices    repositories.KnownDeviceRepository
+	Challenges repositories.LoginChallengeRepository
+	TxManager  repositories.TxManager
+	Email      EmailService
+	Engine     *risk.Engine
+	// GeoIP locates IP addresses for the impossible travel and new country rules. It may be nil.
+	GeoIP  *risk.GeoIPDatabase
+	Logger logger.Logger
+	// FailureWindow is how far back failed attempts count towards the velocity rule.
+	FailureWindow time.Duration
+	// ChallengeTTL is how long the emailed code stays valid.
+	ChallengeTTL time.Duration
+}
+
+// Assess gathers the signals for a login of user from client and scores them.
+func (r *LoginRisk) Assess(ctx context.Context, user *models.User, client *models.ClientInfo) (*risk.Assessment, error) {
+	now := time.Now()
+	signals := &risk.Signals{
+		Time:     now,
+		Location: r.GeoIP.Lookup(client.IPAddress),
+	}
+
+	last, err := r.Attempts.LastSuccess(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		signals.FirstLogin = true
+	} else {
+		signals.LastLogin = &risk.PastLogin{Time: last.CreatedAt}
+		if last.Latitude != nil && last.Longitude != nil {
+			signals.LastLogin.Location = &risk.Location{Latitude: *last.Latitude, Longitude: *last.Longitude}
+		}
+	}
+
+	if signals.KnownDevice, err = r.Devices.IsKnownDevice(ctx, user.ID, knownDeviceHash(client)); err != nil {
+		return nil, err
+	}
+	if signals.KnownIPRange, err = r.Attempts.HasSuccessFromPrefix(ctx, user.ID, risk.NetworkPrefix(client.IPAddress)); err != nil {
+		return nil, err
+	}
+	if signals.Location != nil && signals.Location.Country != "" {
+		if signals.KnownCountry, err = r.Attempts.HasSuccessFromCountry(ctx, user.ID, signals.Location.Country); err != nil {
+			return nil, err
+		}
+	}
+	if signals.RecentFailures, err = r.Attempts.CountFailuresSince(ctx, user.Email, now.Add(-r.FailureWindow)); err != nil {
+		return nil, err
+	}
+	if signals.PastLoginTimes, err = r.Attempts.RecentSuccessTimes(ctx, user.ID, loginHistorySize); err != nil {
+		return nil, err
+	}
+
+	return r.Engine.Assess(signals), nil
+}
+
+// Record stores a login attempt. user is nil for unknown emails and assessment is nil when the
+// attempt was not scored. Failures are only logged so they never change the login outcome.
+func (r *LoginRisk) Record(ctx context.Context, user *models.User, email string, client *models.ClientInfo, outcome string, assessment *risk.Assessment) {
+	const op = "LoginRisk.Record"
+
+	attempt := &models.LoginAttempt{
+		Email:      email,
+		IPAddress:  client.IPAddress,
+		IPPrefix:   risk.NetworkPrefix(client.IPAddress),
+		UserAgent:  client.UserAgent,
+		DeviceHash: knownDeviceHash(client),
+		Outcome:    outcome,
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if location := r.GeoIP.Lookup(client.IPAddress); location != nil {
+		attempt.Country = &location.Country
+		attempt.Latitude = &location.Latitude
+		attempt.Longitude = &location.Longitude
+	}
+	if assessment != nil {
+		attempt.RiskScore = assessment.Score
+		attempt.RiskReasons = assessment.Reasons
+	}
+
+	if err := r.Attempts.Record(ctx, attempt); err != nil {
+		r.Logger.Errorf("%s: Failed to record login attempt for %s: %v", op, email, err)
+	}
+}
+
+// StartChallenge emails the user a code that has to be entered to finish the login, and returns the challenge ID.
+func (r *LoginRisk) StartChallenge(ctx context.Context, user *models.User) (uuid.UUID, error) {
+	code, err := utils.GenerateNumericCode(loginChallengeCodeDigits)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id := uuid.New()
+	err = r.TxManager.WithinTx(ctx, func(ctx context.Context) error {
+		err := r.Challenges.Create(ctx, &models.LoginChallenge{
+			ID:        id,
+			UserID:    user.ID,
+			CodeHash:  challengeCodeHash(id, code),
+			ExpiresAt: time.Now().Add(r.ChallengeTTL),
+		})
+		if err != nil {
+			return err
+		}
+		return r.Email.SendLoginChallengeEmail(ctx, recipientOf(user), code)
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+// VerifyChallenge checks the code of a challenge and returns the user it was issued to. Wrong codes,
+// unknown or expired challenges and challenges with too many wrong codes return ErrInvalidToken.
+func (r *LoginRisk) VerifyChallenge(ctx context.Context, id uuid.UUID, code string) (uuid.UUID, error) {
+	challenge, err := r.Challenges.FindValid(ctx, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if challenge == nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	if challenge.CodeHash != challengeCodeHash(id, code) {
+		if challenge.Attempts+1 >= maxLoginChallengeAttempts {
+			err = r.Challenges.Delete(ctx, id)
+		} else {
+			err = r.Challenges.IncrementAttempts(ctx, id)
+		}
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	// Each code finishes one login
+	if err := r.Challenges.Delete(ctx, id); err != nil {
+		return uuid.Nil, err
+	}
+
+	return challenge.UserID, nil
+}
+
+// challengeCodeHash binds a code to its challenge, so the short code cannot be matched across challenges.
+func challengeCodeHash(id uuid.UUID, code string) string {
+	return utils.HashToken(id.String() + ":" + code)
+}
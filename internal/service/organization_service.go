@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotOrganizationMember = errors.New("not a member of the organization")
+	ErrSlugTaken             = errors.New("organization slug already in use")
+	ErrInvalidSlug           = errors.New("slug may only contain lowercase letters, digits and hyphens")
+)
+
+// Roles every new organization starts with. The creator becomes its owner.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+// orgRolePermissions are the permissions granted by the roles every organization starts with.
+var orgRolePermissions = map[string][]string{
+	OrgRoleOwner:  {"org:manage", "org:members:read", "authz:check", "authz:manage"},
+	OrgRoleMember: {"org:members:read"},
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type OrganizationService interface {
+	ListOrganizations(ctx context.Context, userID uuid.UUID) ([]models.OrganizationMembership, error)
+	CreateOrganization(ctx context.Context, userID uuid.UUID, req *models.CreateOrganizationRequest) (*models.Organization, error)
+	ListMembers(ctx context.Context) ([]models.OrganizationMember, error)
+}
+
+type organizationService struct {
+	logger    logger.Logger
+	orgRepo   repositories.OrganizationRepository
+	txManager repositories.TxManager
+}
+
+func NewOrganizationService(logger logger.Logger, orgRepo repositories.OrganizationRepository, txManager repositories.TxManager) OrganizationService {
+	return &organizationService{
+		logger:    logger,
+		orgRepo:   orgRepo,
+		txManager: txManager,
+	}
+}
+
+// ListOrganizations returns the organizations a user belongs to, marking the one ctx is scoped to.
+func (s *organizationService) ListOrganizations(ctx context.Context, userID uuid.UUID) ([]models.OrganizationMembership, error) {
+	const op = "OrganizationService.ListOrganizations"
+
+	orgs, err := s.orgRepo.ListForUser(ctx, userID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to list organizations for user %s: %v", op, userID, err)
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// CreateOrganization creates an organization with the default roles and makes the user its owner.
+func (s *organizationService) CreateOrganization(ctx context.Context, userID uuid.UUID, req *models.CreateOrganizationRequest) (*models.Organization, error) {
+	const op = "OrganizationService.CreateOrganization"
+
+	org := &models.Organization{
+		Name: strings.TrimSpace(req.Name),
+		Slug: strings.ToLower(strings.TrimSpace(req.Slug)),
+	}
+	if !slugPattern.MatchString(org.Slug) {
+		return nil, ErrInvalidSlug
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.orgRepo.Create(ctx, org); err != nil {
+			return err
+		}
+
+		ctx = repositories.WithOrganization(ctx, org.ID)
+		for _, role := range []string{OrgRoleOwner, OrgRoleMember} {
+			if err := s.orgRepo.CreateRole(ctx, role, orgRolePermissions[role]); err != nil {
+				return err
+			}
+		}
+		if err := s.orgRepo.AddMember(ctx, userID); err != nil {
+			return err
+		}
+		return s.orgRepo.AssignRole(ctx, userID, OrgRoleOwner)
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrSlugTaken
+		}
+
+		s.logger.Errorf("%s: Failed to create organization %s: %v", op, org.Slug, err)
+		return nil, err
+	}
+
+	s.logger.Infof("%s: User %s created organization %s", op, userID, org.ID)
+	return org, nil
+}
+
+// ListMembers returns the members of the organization ctx is scoped to.
+func (s *organizationService) ListMembers(ctx context.Context) ([]models.OrganizationMember, error) {
+	const op = "OrganizationService.ListMembers"
+
+	members, err := s.orgRepo.ListMembers(ctx)
+	if err != nil {
+		if !errors.Is(err, repositories.ErrNoOrganization) {
+			s.logger.Errorf("%s: Failed to list members: %v", op, err)
+		}
+		return nil, err
+	}
+
+	return members, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/google/uuid"
+)
+
+// PasswordHistory prevents users from going back to recently used passwords.
+type PasswordHistory struct {
+	Repo repositories.PasswordHistoryRepository
+	// Size is how many previous passwords are remembered. Zero disables the reuse check.
+	Size int
+	// MinAge is how long a password must be kept before the user may change it again.
+	MinAge time.Duration
+}
+
+// CheckReuse returns a *PasswordPolicyError if password matches the current or a remembered password.
+func (h *PasswordHistory) CheckReuse(ctx context.Context, user *models.User, field, password string) error {
+	if h.Size <= 0 {
+		return nil
+	}
+
+	entries, err := h.Repo.ListRecent(ctx, user.ID, h.Size)
+	if err != nil {
+		return err
+	}
+
+	hashes := []string{user.PasswordHash}
+	for _, entry := range entries {
+		hashes = append(hashes, entry.PasswordHash)
+	}
+
+	for _, hash := range hashes {
+		if utils.VerifyPassword(hash, password) == nil {
+			return &PasswordPolicyError{Violations: []models.FieldError{{
+				Field:   field,
+				Code:    "reused",
+				Message: fmt.Sprintf("must not match any of your last %d passwords", h.Size),
+			}}}
+		}
+	}
+
+	return nil
+}
+
+// CheckMinAge returns a *PasswordPolicyError if the current password was set less than MinAge ago.
+func (h *PasswordHistory) CheckMinAge(ctx context.Context, userID uuid.UUID, field string) error {
+	if h.MinAge <= 0 {
+		return nil
+	}
+
+	entries, err := h.Repo.ListRecent(ctx, userID, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 && time.Since(entries[0].CreatedAt) < h.MinAge {
+		return &PasswordPolicyError{Violations: []models.FieldError{{
+			Field:   field,
+			Code:    "too_recent",
+			Message: fmt.Sprintf("your password can only be changed once every %s", h.MinAge),
+		}}}
+	}
+
+	return nil
+}
+
+// Record remembers a newly set password hash and forgets the ones that fell out of the history.
+func (h *PasswordHistory) Record(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	if err := h.Repo.Add(ctx, userID, passwordHash); err != nil {
+		return err
+	}
+
+	// keep at least one entry so the minimum age can still be checked
+	keep := h.Size
+	if keep < 1 {
+		keep = 1
+	}
+	return h.Repo.Prune(ctx, userID, keep)
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+)
+
+// PasswordPolicyError is returned when a password breaks one or more policy rules.
+type PasswordPolicyError struct {
+	Violations []models.FieldError
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password policy violation: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy decides whether a password may be set for an account.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	Breached      *BreachedPasswordList
+}
+
+// Validate checks password against every rule and returns a *PasswordPolicyError listing all violations.
+// field is the request field the errors are reported against; email and name are the account owner's.
+func (p *PasswordPolicy) Validate(field, password, email, name string) error {
+	var violations []models.FieldError
+	add := func(code, message string) {
+		violations = append(violations, models.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		add("too_short", fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	// bcrypt only looks at the first 72 bytes, so the limit is in bytes
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		add("too_long", fmt.Sprintf("must be at most %d bytes long", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		add("missing_upper", "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add("missing_lower", "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add("missing_digit", "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add("missing_symbol", "must contain a symbol")
+	}
+
+	if containsPersonalInfo(password, email, name) {
+		add("contains_personal_info", "must not contain your email address or name")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("checking breached passwords: %w", err)
+		}
+		if breached {
+			add("breached", "has appeared in a data breach, choose a different password")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsPersonalInfo reports whether the password contains the email local part or any part of the name.
+func containsPersonalInfo(password, email, name string) bool {
+	lowered := strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok {
+		parts = append(parts, local)
+	}
+
+	for _, part := range parts {
+		// very short fragments would reject too many passwords
+		if len(part) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// BreachedPasswordList looks passwords up in a directory of hash-prefix range files, the layout the
+// Pwned Passwords downloader writes: each file is named after the first 5 hex characters of the
+// SHA-1 hashes it holds, such as "21BD1.txt", and lists the remaining 35 characters of each hash as
+// "SUFFIX:COUNT" lines. A lookup only reads the range file of the password's prefix. A missing range
+// file holds no hashes, so a partial list can be used, and lines with a count of 0 are padding.
+type BreachedPasswordList struct {
+	dir    string
+	ranges int
+}
+
+const (
+	breachedPrefixLength = 5
+	breachedSuffixLength = sha1.Size*2 - breachedPrefixLength
+)
+
+// LoadBreachedPasswordList opens a directory of hash-prefix range files. Every name in it has to be
+// a range file, and the first one has to be in the range file format, so a directory in another
+// layout is rejected here rather than found to hold no passwords. The lines of the other files are
+// checked as lookups read them.
+func LoadBreachedPasswordList(dir string) (*BreachedPasswordList, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &BreachedPasswordList{dir: dir}
+	for _, entry := range entries {
+		prefix, ok := breachedRangePrefix(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			return nil, fmt.Errorf("%s: expected only range files named after an upper case 5 character hash prefix", filepath.Join(dir, entry.Name()))
+		}
+		if list.ranges == 0 {
+			if _, err := list.search(prefix, ""); err != nil {
+				return nil, err
+			}
+		}
+		list.ranges++
+	}
+	if list.ranges == 0 {
+		return nil, fmt.Errorf("%s: no range files", dir)
+	}
+
+	return list, nil
+}
+
+// Contains reports whether the password is in the list.
+func (l *BreachedPasswordList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return l.search(hash[:breachedPrefixLength], hash[breachedPrefixLength:])
+}
+
+// Ranges returns the number of range files in the list.
+func (l *BreachedPasswordList) Ranges() int {
+	return l.ranges
+}
+
+// search reports whether the range file of prefix lists suffix. A malformed line anywhere in the
+// file is an error rather than skipped, so a damaged file is noticed instead of passing passwords.
+func (l *BreachedPasswordList) search(prefix, suffix string) (bool, error) {
+	path := filepath.Join(l.dir, prefix+".txt")
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	found := false
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		hash, count, ok := strings.Cut(strings.TrimSuffix(scanner.Text(), "\r"), ":")
+		if !ok || len(hash) != breachedSuffixLength || !isHex(strings.ToUpper(hash)) || !isDigits(count) {
+			return false, fmt.Errorf("%s:%d: expected a SUFFIX:COUNT line", path, n)
+		}
+		if strings.EqualFold(hash, suffix) && strings.TrimLeft(count, "0") != "" {
+			found = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	return found, nil
+}
+
+// breachedRangePrefix returns the hash prefix of a range file name such as "21BD1.txt". Lookups
+// open the file named after the upper case prefix, so lower case names are not range files.
+func breachedRangePrefix(name string) (string, bool) {
+	prefix, ok := strings.CutSuffix(name, ".txt")
+	if !ok || len(prefix) != breachedPrefixLength || !isHex(prefix) {
+		return "", false
+	}
+	return prefix, true
+}
+
+// isHex reports whether s is made of upper case hex digits only.
+func isHex(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789ABCDEF") == ""
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
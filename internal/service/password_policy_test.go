@@ -0,0 +1,163 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeBreachedRanges writes the hashes of passwords as range files, the way the Pwned Passwords
+// downloader does, and returns the directory.
+func writeBreachedRanges(t *testing.T, passwords ...string) string {
+	t.Helper()
+	ranges := map[string][]string{}
+	for i, p := range passwords {
+		hash := sha1Hex(p)
+		ranges[hash[:5]] = append(ranges[hash[:5]], fmt.Sprintf("%s:%d", hash[5:], i+1))
+	}
+
+	dir := t.TempDir()
+	for prefix, lines := range ranges {
+		writeRangeFile(t, dir, prefix+".txt", strings.Join(lines, "\r\n"))
+	}
+	return dir
+}
+
+func writeRangeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeRangeDir writes a directory holding a single file.
+func writeRangeDir(t *testing.T, name, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeRangeFile(t, dir, name, content)
+	return dir
+}
+
+func TestBreachedPasswordList(t *testing.T) {
+	var breached []string
+	for i := range 500 {
+		breached = append(breached, fmt.Sprintf("password%d", i))
+	}
+	list, err := LoadBreachedPasswordList(writeBreachedRanges(t, breached...))
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswordList: %v", err)
+	}
+
+	for _, p := range breached {
+		if ok, err := list.Contains(p); err != nil || !ok {
+			t.Errorf("Contains(%q) = %t, %v, want true", p, ok, err)
+		}
+	}
+	for _, p := range []string{"", "password500", "correct horse battery staple"} {
+		if ok, err := list.Contains(p); err != nil || ok {
+			t.Errorf("Contains(%q) = %t, %v, want false", p, ok, err)
+		}
+	}
+}
+
+func TestBreachedPasswordListPadding(t *testing.T) {
+	hash := sha1Hex("hunter2")
+	dir := t.TempDir()
+	writeRangeFile(t, dir, hash[:5]+".txt", strings.ToLower(hash[5:])+":0\n")
+
+	list, err := LoadBreachedPasswordList(dir)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswordList: %v", err)
+	}
+	if ok, err := list.Contains("hunter2"); err != nil || ok {
+		t.Errorf("Contains(hunter2) = %t, %v, want false for a padding line", ok, err)
+	}
+}
+
+func TestBreachedPasswordListRejectsMalformedLines(t *testing.T) {
+	hash := sha1Hex("hunter2")
+	valid := hash[5:] + ":3"
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"blank line", "\n" + valid + "\n"},
+		{"comment", "# pwned passwords\n" + valid + "\n"},
+		{"full hash", hash + ":3\n"},
+		{"missing count", hash[5:] + "\n"},
+		{"bad count", hash[5:] + ":x\n"},
+		{"plain password", "hunter2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// the first range file is checked at load, so the malformed one is loaded second
+			writeRangeFile(t, dir, "00000.txt", "0000000000000000000000000000000000A:1\n")
+			writeRangeFile(t, dir, hash[:5]+".txt", tt.content)
+
+			list, err := LoadBreachedPasswordList(dir)
+			if err != nil {
+				t.Fatalf("LoadBreachedPasswordList: %v", err)
+			}
+			if ok, err := list.Contains("hunter2"); err == nil {
+				t.Errorf("Contains(hunter2) = %t, nil, want an error", ok)
+			}
+
+			if _, err := LoadBreachedPasswordList(writeRangeDir(t, hash[:5]+".txt", tt.content)); err == nil {
+				t.Error("LoadBreachedPasswordList accepted a malformed first range file")
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswordListRejectsOtherLayouts(t *testing.T) {
+	hash := sha1Hex("hunter2")
+
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{"empty directory", t.TempDir()},
+		{"sorted hash file", writeRangeDir(t, "pwned-passwords-sha1-ordered-by-hash.txt", hash+":3\n")},
+		{"lower case prefix", writeRangeDir(t, strings.ToLower(hash[:5])+".txt", hash[5:]+":3\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadBreachedPasswordList(tt.dir); err == nil {
+				t.Error("LoadBreachedPasswordList accepted the directory")
+			}
+		})
+	}
+
+	if _, err := LoadBreachedPasswordList(filepath.Join(writeBreachedRanges(t, "hunter2"), hash[:5]+".txt")); err == nil {
+		t.Error("LoadBreachedPasswordList accepted a range file instead of a directory")
+	}
+}
+
+func TestPasswordPolicyBreached(t *testing.T) {
+	list, err := LoadBreachedPasswordList(writeBreachedRanges(t, "Summer2024!"))
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswordList: %v", err)
+	}
+	policy := &PasswordPolicy{MinLength: 8, Breached: list}
+
+	err = policy.Validate("password", "Summer2024!", "alice@example.com", "Alice")
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0].Code != "breached" {
+		t.Errorf("Validate = %v, want a breached violation", err)
+	}
+	if err := policy.Validate("password", "Winter2024!", "alice@example.com", "Alice"); err != nil {
+		t.Errorf("Validate = %v, want nil", err)
+	}
+}
@@ -2,19 +2,26 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/Nucleussss/auth-service/internal/db/models"
 	"github.com/Nucleussss/auth-service/internal/repositories"
 	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
 
 	// import utils
 	"github.com/Nucleussss/auth-service/internal/utils"
 )
 
+// backgroundResetTimeout bounds a reset requested in the background, which outlives the request.
+const backgroundResetTimeout = 30 * time.Second
+
 type PasswordResetService interface {
 	RequestReset(ctx context.Context, email string) (string, error)
+	RequestResetInBackground(ctx context.Context, email string)
+	Invite(ctx context.Context, email string) error
 	ResetPassword(ctx context.Context, token string, newPassword string) error
 }
 
@@ -22,23 +29,39 @@ type passwordResetService struct {
 	logger            logger.Logger
 	userRepo          repositories.UserRepository
 	passwordResetRepo repositories.PasswordResetRepository
+	sessionRepo       repositories.SessionRepository
+	txManager         repositories.TxManager
 	emailService      EmailService
+	passwordPolicy    *PasswordPolicy
+	passwordHistory   *PasswordHistory
 	tokenExpiry       time.Duration
+	// invitationExpiry is how long the links of users invited to choose their first password work
+	invitationExpiry time.Duration
 }
 
 func NewPasswordResetService(
 	logger logger.Logger,
 	userRepo repositories.UserRepository,
 	passwordResetRepo repositories.PasswordResetRepository,
+	sessionRepo repositories.SessionRepository,
+	txManager repositories.TxManager,
 	emailService EmailService,
+	passwordPolicy *PasswordPolicy,
+	passwordHistory *PasswordHistory,
 	tokenExpiry time.Duration,
+	invitationExpiry time.Duration,
 ) PasswordResetService {
 	return &passwordResetService{
 		logger:            logger,
 		userRepo:          userRepo,
 		passwordResetRepo: passwordResetRepo,
+		sessionRepo:       sessionRepo,
+		txManager:         txManager,
 		emailService:      emailService,
+		passwordPolicy:    passwordPolicy,
+		passwordHistory:   passwordHistory,
 		tokenExpiry:       tokenExpiry,
+		invitationExpiry:  invitationExpiry,
 	}
 }
 
@@ -47,64 +70,156 @@ func (s *passwordResetService) RequestReset(ctx context.Context, email string) (
 
 	user, err := s.userRepo.FindbyEmail(ctx, email)
 	if err != nil {
+		// Unknown emails look like a success to the caller so accounts cannot be enumerated
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Infof("%s: No user with email %s, not sending a reset email", op, email)
+			return "", nil
+		}
 		s.logger.Errorf("%s: Failed find email in the database: %v ", op, err)
 		return " ", err
 	}
 
-	// Generate a secure token for the password reset request
-	token, err := utils.GenerateSecureToken(32)
+	token, err := s.issue(ctx, user, s.tokenExpiry, s.emailService.SendPasswordResetEmail)
 	if err != nil {
+		s.logger.Errorf("%s: Failed Save the password reset record to the database: %v ", op, err)
 		return " ", err
 	}
 
-	// Create a new password reset record
-	reset := &models.PasswordReset{
-		Token:     token,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(s.tokenExpiry),
+	return token, nil
+}
+
+// Invite emails a user whose account was created for them a link to choose their password. The
+// link lasts as long as invitations do, as the user may only get to it days later.
+func (s *passwordResetService) Invite(ctx context.Context, email string) error {
+	const op = "PasswordResetService.Invite"
+
+	user, err := s.userRepo.FindbyEmail(ctx, email)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to find user %s: %v", op, email, err)
+		return err
 	}
 
-	// Save the password reset record to the database
-	if err = s.passwordResetRepo.Create(ctx, reset); err != nil {
-		s.logger.Errorf("%s: Failed Save the password reset record to the database: %v ", op, err)
-		return " ", err
+	if _, err := s.issue(ctx, user, s.invitationExpiry, s.emailService.SendAccountInvitation); err != nil {
+		s.logger.Errorf("%s: Failed to invite user %s: %v", op, user.ID, err)
+		return err
 	}
+	return nil
+}
 
-	// Send the password reset email to the user
-	if err := s.emailService.SendPasswordResetEmail(user.Email, token); err != nil {
+// issue creates a reset token for the user that expires after expiry and sends it with send.
+func (s *passwordResetService) issue(ctx context.Context, user *models.User, expiry time.Duration, send func(context.Context, models.EmailRecipient, string) error) (string, error) {
+	// Generate a secure token for the password reset request
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
 		return "", err
 	}
 
+	// Create a new password reset record. Only a hash of the token is stored.
+	reset := &models.PasswordReset{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(expiry),
+	}
+
+	// Replace any older reset tokens so only the newest one works, and queue the
+	// email in the same transaction so it is sent exactly when the token exists
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.passwordResetRepo.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := s.passwordResetRepo.Create(ctx, reset); err != nil {
+			return err
+		}
+		return send(ctx, recipientOf(user), token)
+	})
+	if err != nil {
+		return "", err
+	}
 	return token, nil
 }
 
-// explain this function.
+// RequestResetInBackground requests a reset without waiting for it. A known email costs a
+// transaction and an email while an unknown one costs a lookup, so callers answering anonymous
+// requests use it to respond in the same time either way.
+func (s *passwordResetService) RequestResetInBackground(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backgroundResetTimeout)
+	go func() {
+		defer cancel()
+		// RequestReset logs its failures
+		_, _ = s.RequestReset(ctx, email)
+	}()
+}
+
+// ResetPassword sets a new password using a reset token. The token is consumed, the password
+// updated and every session of the user revoked in a single transaction.
 func (s *passwordResetService) ResetPassword(ctx context.Context, token string, newPassword string) error {
 	var op = "PasswordResetService.ResetPassword"
 
-	// Find the password reset record in the database using the token
-	reset, err := s.passwordResetRepo.FindValidToken(ctx, token)
+	var user *models.User
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Consume the password reset record so the token cannot be used twice
+		reset, err := s.passwordResetRepo.Consume(ctx, utils.HashToken(token))
+		if err != nil {
+			s.logger.Errorf("%s: Failed to find password reset record: %v", op, err)
+			return err
+		}
+		if reset == nil {
+			s.logger.Errorf("%s: Password reset token is invalid or expired", op)
+			return ErrInvalidToken
+		}
+
+		// Check the new password against the password policy
+		user, err = s.userRepo.FindbyID(ctx, reset.UserID)
+		if err != nil {
+			s.logger.Errorf("%s: Failed to find user %s: %v", op, reset.UserID, err)
+			return err
+		}
+		if err := s.passwordPolicy.Validate("new_password", newPassword, user.Email, user.Name); err != nil {
+			s.logger.Errorf("%s: Password rejected by policy for user %s", op, user.ID)
+			return err
+		}
+
+		// Do not allow going back to a recently used password
+		if err := s.passwordHistory.CheckReuse(ctx, user, "new_password", newPassword); err != nil {
+			s.logger.Errorf("%s: Password reuse check failed for user %s: %v", op, user.ID, err)
+			return err
+		}
+
+		// Hash the new password before updating it in the database
+		hashedPassword, err := utils.HashPassword(newPassword)
+		if err != nil {
+			s.logger.Errorf("%s: Failed to hash password %v", op, err)
+			return err
+		}
+
+		// Update the user's password in the database
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			s.logger.Errorf("%s: Failed to update user password %v", op, err)
+			return err
+		}
+
+		if err := s.passwordHistory.Record(ctx, user.ID, hashedPassword); err != nil {
+			s.logger.Errorf("%s: Failed to record password history %v", op, err)
+			return err
+		}
+
+		// Whoever knew the old password must not stay signed in
+		if err := s.sessionRepo.DeleteByUser(ctx, user.ID, uuid.Nil); err != nil {
+			s.logger.Errorf("%s: Failed to revoke sessions %v", op, err)
+			return err
+		}
+
+		// No other reset token of the user should remain usable
+		if err := s.passwordResetRepo.DeleteByUser(ctx, user.ID); err != nil {
+			return err
+		}
+
+		return s.emailService.SendPasswordChangedEmail(ctx, recipientOf(user))
+	})
 	if err != nil {
-		s.logger.Errorf("%s: Failed to find password reset record: %v", op, err)
-		return err
-	}
-	if reset == nil {
-		s.logger.Errorf("%s: Failed to find password reset record: %v", op, err)
-		return errors.New("invalid or expired token")
-	}
-
-	// Hash the new password before updating it in the database
-	hashedPassword, err := utils.HashPassword(newPassword)
-	if err != nil {
-		s.logger.Errorf("%s: Failed to hash password %v", op, err)
-		return err
-	}
-
-	// Update the user's password in the database with the
-	if err := s.userRepo.UpdatePassword(ctx, reset.UserID, hashedPassword); err != nil {
-		s.logger.Errorf("%s: Failed to update user password %v", op, err)
 		return err
 	}
 
-	return s.passwordResetRepo.Delete(ctx, token)
+	s.logger.Infof("%s: Reset password for user %s", op, user.ID)
+	return nil
 }
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService interface {
+	ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error
+}
+
+type sessionService struct {
+	logger      logger.Logger
+	sessionRepo repositories.SessionRepository
+}
+
+func NewSessionService(logger logger.Logger, sessionRepo repositories.SessionRepository) SessionService {
+	return &sessionService{
+		logger:      logger,
+		sessionRepo: sessionRepo,
+	}
+}
+
+// ListSessions returns the active sessions of a user and marks the one making the request.
+func (s *sessionService) ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID uuid.UUID) ([]models.Session, error) {
+	const op = "SessionService.ListSessions"
+
+	sessions, err := s.sessionRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to list sessions for user %s: %v", op, userID, err)
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs a single device out.
+func (s *sessionService) RevokeSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error {
+	const op = "SessionService.RevokeSession"
+
+	deleted, err := s.sessionRepo.Delete(ctx, sessionID, userID)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to delete session %s: %v", op, sessionID, err)
+		return err
+	}
+	if !deleted {
+		return ErrSessionNotFound
+	}
+
+	s.logger.Infof("%s: Revoked session %s for user %s", op, sessionID, userID)
+	return nil
+}
+
+// describeDevice builds a short human readable device name from a user agent string.
+func describeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := "Unknown OS"
+	for _, p := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	return browser + " on " + platform
+}
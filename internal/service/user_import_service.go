@@ -0,0 +1,434 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nucleussss/auth-service/internal/db/models"
+	"github.com/Nucleussss/auth-service/internal/repositories"
+	"github.com/Nucleussss/auth-service/internal/utils"
+	"github.com/Nucleussss/auth-service/pkg/logger"
+	"github.com/google/uuid"
+	"golang.org/x/text/language"
+)
+
+// Formats of user import and export files.
+const (
+	UserFileCSV  = "csv"
+	UserFileJSON = "json"
+)
+
+// importBatchSize is the number of users inserted per statement.
+const importBatchSize = 500
+
+// maxLocaleLength is the size of the locale column of users.
+const maxLocaleLength = 16
+
+// noPasswordHash is stored for users imported without a password. It matches no password, so they
+// cannot log in until they set one through the emailed link.
+const noPasswordHash = "!"
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported format, use csv or json")
+	ErrInvalidImportFile = errors.New("invalid import file")
+)
+
+// UserImportService creates users in bulk from files and exports them in the same formats.
+type UserImportService interface {
+	Import(ctx context.Context, actorID uuid.UUID, users []models.ImportUser, opts models.ImportOptions) (*models.ImportResult, error)
+	Export(ctx context.Context, actorID uuid.UUID, w io.Writer, format string, withPasswordHashes bool) error
+}
+
+type userImportService struct {
+	logger               logger.Logger
+	userRepo             repositories.UserRepository
+	roleRepo             repositories.RoleRepository
+	auditRepo            repositories.AuditLogRepository
+	txManager            repositories.TxManager
+	passwordResetService PasswordResetService
+}
+
+func NewUserImportService(
+	logger logger.Logger,
+	userRepo repositories.UserRepository,
+	roleRepo repositories.RoleRepository,
+	auditRepo repositories.AuditLogRepository,
+	txManager repositories.TxManager,
+	passwordResetService PasswordResetService,
+) UserImportService {
+	return &userImportService{
+		logger:               logger,
+		userRepo:             userRepo,
+		roleRepo:             roleRepo,
+		auditRepo:            auditRepo,
+		txManager:            txManager,
+		passwordResetService: passwordResetService,
+	}
+}
+
+// DecodeUsers reads the users of an import file. CSV files start with a header naming the columns,
+// in any order: email, name, password_hash, locale and roles, with roles separated by semicolons.
+// JSON files hold an array of users. Unknown columns and fields are ignored, so exported files can
+// be imported again.
+func DecodeUsers(r io.Reader, format string) ([]models.ImportUser, error) {
+	switch format {
+	case UserFileCSV:
+		return decodeUsersCSV(r)
+	case UserFileJSON:
+		var users []models.ImportUser
+		if err := json.NewDecoder(r).Decode(&users); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		return users, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func decodeUsersCSV(r io.Reader) ([]models.ImportUser, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("%w: the header has no email column", ErrInvalidImportFile)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	users := []models.ImportUser{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return users, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+
+		user := models.ImportUser{
+			Email:        field(record, "email"),
+			Name:         field(record, "name"),
+			PasswordHash: field(record, "password_hash"),
+			Locale:       field(record, "locale"),
+		}
+		for _, role := range strings.Split(field(record, "roles"), ";") {
+			if role = strings.TrimSpace(role); role != "" {
+				user.Roles = append(user.Roles, role)
+			}
+		}
+		users = append(users, user)
+	}
+}
+
+// Import validates every user and, unless it is a dry run or a row was rejected, creates them all
+// with verified email addresses and their roles in one transaction.
+func (s *userImportService) Import(ctx context.Context, actorID uuid.UUID, users []models.ImportUser, opts models.ImportOptions) (*models.ImportResult, error) {
+	const op = "UserImportService.Import"
+
+	result := &models.ImportResult{
+		DryRun: opts.DryRun,
+		Total:  len(users),
+		Errors: []models.ImportRowError{},
+	}
+
+	rejected, err := s.validate(ctx, users, opts)
+	if err != nil {
+		s.logger.Errorf("%s: Failed to validate users: %v", op, err)
+		return nil, err
+	}
+	result.Errors = rejected
+	if len(rejected) > 0 || opts.DryRun {
+		return result, nil
+	}
+
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		for start := 0; start < len(users); start += importBatchSize {
+			batch := users[start:min(start+importBatchSize, len(users))]
+
+			newUsers := make([]models.CreateNewUser, len(batch))
+			for i, user := range batch {
+				newUsers[i] = models.CreateNewUser{
+					Name:         user.Name,
+					Email:        user.Email,
+					PasswordHash: user.PasswordHash,
+					Locale:       user.Locale,
+				}
+				if user.PasswordHash == "" {
+					newUsers[i].PasswordHash = noPasswordHash
+				}
+			}
+			ids, err := s.userRepo.CreateBatch(ctx, newUsers)
+			if err != nil {
+				return err
+			}
+
+			var roleUserIDs []uuid.UUID
+			var roleNames []string
+			for i, user := range batch {
+				for _, role := range user.Roles {
+					roleUserIDs = append(roleUserIDs, ids[i])
+					roleNames = append(roleNames, role)
+				}
+			}
+			if err := s.roleRepo.AddGlobalRoles(ctx, roleUserIDs, roleNames); err != nil {
+				return err
+			}
+
+			for _, user := range batch {
+				if user.PasswordHash != "" {
+					continue
+				}
+				if err := s.passwordResetService.Invite(ctx, user.Email); err != nil {
+					return err
+				}
+				result.Invited++
+			}
+			result.Imported += len(batch)
+		}
+
+		return s.auditRepo.Create(ctx, &models.AuditLog{
+			ActorID: actorOf(actorID),
+			Action:  models.AuditUsersImported,
+			Details: map[string]any{"imported": result.Imported, "invited": result.Invited},
+		})
+	})
+	if err != nil {
+		// a user with one of the emails was created since the validation
+		if isUniqueViolation(err) {
+			return nil, ErrEmailTaken
+		}
+		s.logger.Errorf("%s: Failed to import users: %v", op, err)
+		return nil, err
+	}
+
+	s.logger.Infof("%s: Imported %d users, %d invited", op, result.Imported, result.Invited)
+	return result, nil
+}
+
+// validate normalizes the users in place and returns the rejected ones, ordered by row.
+func (s *userImportService) validate(ctx context.Context, users []models.ImportUser, opts models.ImportOptions) ([]models.ImportRowError, error) {
+	rejected := []models.ImportRowError{}
+	reject := func(row int, email, format string, args ...any) {
+		rejected = append(rejected, models.ImportRowError{Row: row, Email: email, Error: fmt.Sprintf(format, args...)})
+	}
+
+	rowOf := map[string]int{}
+	knownRoles := map[string]bool{}
+	var emails []string
+	for i := range users {
+		user := &users[i]
+		row := i + 1
+
+		user.Email = strings.TrimSpace(user.Email)
+		user.Name = strings.TrimSpace(user.Name)
+		if user.Name == "" {
+			user.Name = user.Email
+		}
+		if user.Locale == "" {
+			user.Locale = defaultEmailLocale
+		}
+
+		if !isEmail(user.Email) || len(user.Email) > 255 {
+			reject(row, user.Email, "invalid email")
+			continue
+		}
+		// emails differing only in case belong to the same person
+		key := strings.ToLower(user.Email)
+		if first, ok := rowOf[key]; ok {
+			reject(row, user.Email, "duplicate of row %d", first)
+			continue
+		}
+		rowOf[key] = row
+		emails = append(emails, key)
+
+		if len(user.Name) > 255 {
+			reject(row, user.Email, "name is longer than 255 characters")
+			continue
+		}
+		// the same check as the bcp47_language_tag binding of the other requests taking a locale
+		if _, err := language.Parse(user.Locale); err != nil || len(user.Locale) > maxLocaleLength {
+			reject(row, user.Email, "invalid locale")
+			continue
+		}
+		if user.PasswordHash == "" && !opts.Invite {
+			reject(row, user.Email, "password_hash is required unless users are invited")
+			continue
+		}
+		if user.PasswordHash != "" {
+			if err := utils.ValidatePasswordHash(user.PasswordHash); err != nil {
+				reject(row, user.Email, "password_hash must be a bcrypt or argon2id hash: %v", err)
+				continue
+			}
+		}
+		for _, role := range user.Roles {
+			known, ok := knownRoles[role]
+			if !ok {
+				found, err := s.roleRepo.FindGlobalRoleByName(ctx, role)
+				if err != nil {
+					return nil, err
+				}
+				known = found != nil
+				knownRoles[role] = known
+			}
+			if !known {
+				reject(row, user.Email, "unknown role %q", role)
+				break
+			}
+		}
+	}
+
+	if len(emails) > 0 {
+		existing, err := s.userRepo.ExistingEmails(ctx, emails)
+		if err != nil {
+			return nil, err
+		}
+		for _, email := range existing {
+			row := rowOf[strings.ToLower(email)]
+			reject(row, users[row-1].Email, "email already in use")
+		}
+	}
+
+	// a row rejected for its email may also have been rejected before
+	slices.SortStableFunc(rejected, func(a, b models.ImportRowError) int { return a.Row - b.Row })
+	return slices.CompactFunc(rejected, func(a, b models.ImportRowError) bool { return a.Row == b.Row }), nil
+}
+
+// Export writes every user with their global roles, oldest first, as read from the database.
+// Password hashes are left out unless asked for.
+func (s *userImportService) Export(ctx context.Context, actorID uuid.UUID, w io.Writer, format string, withPasswordHashes bool) error {
+	const op = "UserImportService.Export"
+
+	if format != UserFileCSV && format != UserFileJSON {
+		return ErrUnsupportedFormat
+	}
+
+	err := s.auditRepo.Create(ctx, &models.AuditLog{
+		ActorID: actorOf(actorID),
+		Action:  models.AuditUsersExported,
+		Details: map[string]any{"format": format, "password_hashes": withPasswordHashes},
+	})
+	if err != nil {
+		s.logger.Errorf("%s: Failed to audit export: %v", op, err)
+		return err
+	}
+
+	exported := 0
+	toExport := func(user *models.User, roles []string) models.ExportUser {
+		exported++
+		out := models.ExportUser{
+			Email:         user.Email,
+			Name:          user.Name,
+			Locale:        user.Locale,
+			Roles:         roles,
+			Active:        user.IsActive,
+			EmailVerified: user.EmailVerifiedAt != nil,
+			CreatedAt:     user.CreatedAt,
+		}
+		if withPasswordHashes && user.PasswordHash != noPasswordHash {
+			out.PasswordHash = user.PasswordHash
+		}
+		return out
+	}
+
+	if format == UserFileJSON {
+		err = exportJSON(ctx, s.userRepo, w, toExport)
+	} else {
+		err = exportCSV(ctx, s.userRepo, w, withPasswordHashes, toExport)
+	}
+	if err != nil {
+		s.logger.Errorf("%s: Failed to export users: %v", op, err)
+		return err
+	}
+
+	s.logger.Infof("%s: Exported %d users", op, exported)
+	return nil
+}
+
+func exportCSV(ctx context.Context, userRepo repositories.UserRepository, w io.Writer, withPasswordHashes bool, toExport func(*models.User, []string) models.ExportUser) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"email", "name", "locale", "roles", "active", "email_verified", "created_at"}
+	if withPasswordHashes {
+		header = slices.Insert(header, 2, "password_hash")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	err := userRepo.ForEachWithRoles(ctx, func(user *models.User, roles []string) error {
+		out := toExport(user, roles)
+		record := []string{
+			out.Email,
+			out.Name,
+			out.Locale,
+			strings.Join(out.Roles, ";"),
+			strconv.FormatBool(out.Active),
+			strconv.FormatBool(out.EmailVerified),
+			out.CreatedAt.UTC().Format(time.RFC3339),
+		}
+		if withPasswordHashes {
+			record = slices.Insert(record, 2, out.PasswordHash)
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportJSON(ctx context.Context, userRepo repositories.UserRepository, w io.Writer, toExport func(*models.User, []string) models.ExportUser) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	// users are written one by one, so the array is never built in memory
+	first := true
+	err := userRepo.ForEachWithRoles(ctx, func(user *models.User, roles []string) error {
+		sep := ",\n"
+		if first {
+			sep, first = "\n", false
+		}
+		data, err := json.Marshal(toExport(user, roles))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, sep+string(data))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n]\n")
+	return err
+}
+
+// actorOf returns the audit log actor for an admin, nil for the command line.
+func actorOf(actorID uuid.UUID) *uuid.UUID {
+	if actorID == uuid.Nil {
+		return nil
+	}
+	return &actorID
+}
@@ -1,15 +1,396 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownHashFormat   = errors.New("unknown password hash format")
+	ErrMalformedHash       = errors.New("malformed password hash")
+	ErrUnknownHashFunction = errors.New("unknown password hashing algorithm")
+	ErrHashTooCostly       = errors.New("password hash parameters exceed the allowed cost")
 )
 
+// PasswordHasher hashes passwords into self-describing, PHC style strings
+// ("$<id>$<params>$<salt>$<hash>") and verifies passwords against them.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password using the hasher's current parameters.
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch if password does not match the encoded hash.
+	Verify(encoded, password string) error
+	// NeedsRehash reports whether encoded was made with other parameters than the current ones.
+	NeedsRehash(encoded string) bool
+	// Recognizes reports whether encoded was made by this kind of hasher.
+	Recognizes(encoded string) bool
+}
+
+// defaultHasher is used by HashPassword, VerifyPassword and PasswordNeedsRehash.
+var defaultHasher PasswordHasher = NewMultiHasher(&BcryptHasher{Cost: bcrypt.DefaultCost})
+
+// SetPasswordHasher replaces the hasher used by the package level helpers.
+func SetPasswordHasher(hasher PasswordHasher) {
+	defaultHasher = hasher
+}
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return defaultHasher.Hash(password)
 }
 
 func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return defaultHasher.Verify(hashedPassword, password)
+}
+
+// PasswordNeedsRehash reports whether a stored hash should be replaced by one made with the current settings.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return defaultHasher.NeedsRehash(hashedPassword)
+}
+
+// Limits on the parameters of hashes made elsewhere. Every login verifies the stored hash, so a
+// hash with a huge cost would make each attempt at the account burn memory and CPU.
+const (
+	maxImportedBcryptCost        = 14
+	maxImportedArgon2Memory      = 256 * 1024 // KiB
+	maxImportedArgon2Iterations  = 10
+	maxImportedArgon2Parallelism = 16
+	maxImportedArgon2Length      = 64 // bytes, of both the salt and the key
+)
+
+// ValidatePasswordHash checks that encoded is a well-formed bcrypt or argon2id hash, e.g. one
+// imported from another system, without doing any hashing work. Hashes costlier to verify than
+// the limits above return ErrHashTooCostly.
+func ValidatePasswordHash(encoded string) error {
+	switch {
+	case (&BcryptHasher{}).Recognizes(encoded):
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil || len(encoded) != 60 {
+			return ErrMalformedHash
+		}
+		if cost > maxImportedBcryptCost {
+			return ErrHashTooCostly
+		}
+	case (&Argon2idHasher{}).Recognizes(encoded):
+		version, memory, iterations, parallelism, salt, key, err := (&Argon2idHasher{}).decode(encoded)
+		if err != nil || version != argon2.Version || memory == 0 || iterations == 0 || parallelism == 0 || len(salt) == 0 || len(key) == 0 {
+			return ErrMalformedHash
+		}
+		if memory > maxImportedArgon2Memory || iterations > maxImportedArgon2Iterations ||
+			parallelism > maxImportedArgon2Parallelism || len(salt) > maxImportedArgon2Length || len(key) > maxImportedArgon2Length {
+			return ErrHashTooCostly
+		}
+	default:
+		return ErrUnknownHashFormat
+	}
+	return nil
+}
+
+// PasswordHashConfig selects the algorithm used for new hashes and its parameters.
+type PasswordHashConfig struct {
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	ScryptLogN        uint8
+	ScryptR           int
+	ScryptP           int
+}
+
+// NewPasswordHasher returns a hasher that creates hashes with the configured algorithm
+// and still verifies hashes made by any supported algorithm.
+func NewPasswordHasher(cfg PasswordHashConfig) (PasswordHasher, error) {
+	bcryptHasher := &BcryptHasher{Cost: cfg.BcryptCost}
+	argon2Hasher := &Argon2idHasher{Memory: cfg.Argon2Memory, Iterations: cfg.Argon2Iterations, Parallelism: cfg.Argon2Parallelism}
+	scryptHasher := &ScryptHasher{LogN: cfg.ScryptLogN, R: cfg.ScryptR, P: cfg.ScryptP}
+
+	switch cfg.Algorithm {
+	case "", "bcrypt":
+		return NewMultiHasher(bcryptHasher, argon2Hasher, scryptHasher), nil
+	case "argon2id":
+		return NewMultiHasher(argon2Hasher, bcryptHasher, scryptHasher), nil
+	case "scrypt":
+		return NewMultiHasher(scryptHasher, bcryptHasher, argon2Hasher), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownHashFunction, cfg.Algorithm)
+	}
+}
+
+// MultiHasher hashes with its preferred hasher and verifies with whichever hasher recognizes the hash.
+type MultiHasher struct {
+	preferred PasswordHasher
+	hashers   []PasswordHasher
+}
+
+// NewMultiHasher creates a MultiHasher. The first hasher is used for new hashes.
+func NewMultiHasher(preferred PasswordHasher, others ...PasswordHasher) *MultiHasher {
+	return &MultiHasher{
+		preferred: preferred,
+		hashers:   append([]PasswordHasher{preferred}, others...),
+	}
+}
+
+func (m *MultiHasher) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+func (m *MultiHasher) Verify(encoded, password string) error {
+	for _, hasher := range m.hashers {
+		if hasher.Recognizes(encoded) {
+			return hasher.Verify(encoded, password)
+		}
+	}
+	return ErrUnknownHashFormat
+}
+
+func (m *MultiHasher) NeedsRehash(encoded string) bool {
+	if !m.preferred.Recognizes(encoded) {
+		return true
+	}
+	return m.preferred.NeedsRehash(encoded)
+}
+
+func (m *MultiHasher) Recognizes(encoded string) bool {
+	for _, hasher := range m.hashers {
+		if hasher.Recognizes(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// BcryptHasher uses bcrypt, whose own "$2a$<cost>$..." format already follows the PHC layout.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	return string(bytes), err
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost()
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Argon2idHasher encodes hashes as "$argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<hash>".
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+func (h *Argon2idHasher) params() (memory, iterations uint32, parallelism uint8) {
+	memory, iterations, parallelism = h.Memory, h.Iterations, h.Parallelism
+	if memory == 0 {
+		memory = 64 * 1024
+	}
+	if iterations == 0 {
+		iterations = 3
+	}
+	if parallelism == 0 {
+		parallelism = 2
+	}
+	return memory, iterations, parallelism
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	memory, iterations, parallelism := h.params()
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, memory, iterations, parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// decode splits an encoded argon2id hash into its parameters, salt and key.
+func (h *Argon2idHasher) decode(encoded string) (version int, memory, iterations uint32, parallelism uint8, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return 0, 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return 0, 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return 0, 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return 0, 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return 0, 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	return version, memory, iterations, parallelism, salt, key, nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) error {
+	version, memory, iterations, parallelism, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return err
+	}
+	if version != argon2.Version {
+		return ErrMalformedHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	version, memory, iterations, parallelism, _, _, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+
+	wantMemory, wantIterations, wantParallelism := h.params()
+	return version != argon2.Version || memory != wantMemory || iterations != wantIterations || parallelism != wantParallelism
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// ScryptHasher encodes hashes as "$scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>".
+type ScryptHasher struct {
+	LogN uint8
+	R    int
+	P    int
+}
+
+const (
+	scryptSaltLength = 16
+	scryptKeyLength  = 32
+)
+
+func (h *ScryptHasher) params() (logN uint8, r, p int) {
+	logN, r, p = h.LogN, h.R, h.P
+	if logN == 0 {
+		logN = 15
+	}
+	if r == 0 {
+		r = 8
+	}
+	if p == 0 {
+		p = 1
+	}
+	return logN, r, p
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	logN, r, p := h.params()
+
+	salt := make([]byte, scryptSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, scryptKeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		logN, r, p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// decode splits an encoded scrypt hash into its parameters, salt and key.
+func (h *ScryptHasher) decode(encoded string) (logN uint8, r, p int, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	return logN, r, p, salt, key, nil
+}
+
+func (h *ScryptHasher) Verify(encoded, password string) error {
+	logN, r, p, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return err
+	}
+
+	other, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(key))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *ScryptHasher) NeedsRehash(encoded string) bool {
+	logN, r, p, _, _, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+
+	wantLogN, wantR, wantP := h.params()
+	return logN != wantLogN || r != wantR || p != wantP
+}
 
+func (h *ScryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$scrypt$")
 }
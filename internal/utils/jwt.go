@@ -10,25 +10,91 @@ import (
 	"github.com/google/uuid"
 )
 
-func GenerateJWTToken(userID uuid.UUID, secretKey string) (string, error) {
+// jwtExpiration reads the token lifetime in hours from JWT_EXPIRATION.
+func jwtExpiration() (time.Duration, error) {
 	expString := os.Getenv("JWT_EXPIRATION")
 
 	// convert the expiration string to an integer duration in hours
 	expDuration, err := strconv.Atoi(expString)
 	if err != nil {
-		return "", fmt.Errorf("invalid JWT_EXPIRATION: %v", err)
+		return 0, fmt.Errorf("invalid JWT_EXPIRATION: %v", err)
+	}
+
+	return time.Hour * time.Duration(expDuration), nil
+}
+
+func GenerateJWTToken(userID uuid.UUID, secretKey string) (string, error) {
+	expDuration, err := jwtExpiration()
+	if err != nil {
+		return "", err
 	}
 
 	// create a new JWT token with the specified claims and secret key
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID.String(),
-		"exp":     time.Now().Add(time.Hour * time.Duration(expDuration)).Unix(),
+		"exp":     time.Now().Add(expDuration).Unix(),
 	})
 
 	// sign the token with the secret key and return it
 	return token.SignedString([]byte(secretKey))
 }
 
+// ScopePasswordChange restricts a token to the change-password route.
+const ScopePasswordChange = "password_change"
+
+// SessionClaims describe a token bound to a session.
+type SessionClaims struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	// OrgID is the organization the token acts in. uuid.Nil leaves the org_id claim out.
+	OrgID uuid.UUID
+	// Permissions are the effective permissions of the user in OrgID, for clients. Nil leaves the
+	// permissions claim out.
+	Permissions []string
+	// Scope restricts what the token may be used for. Empty means full access.
+	Scope string
+	// TTL overrides the lifetime from JWT_EXPIRATION when set.
+	TTL time.Duration
+	// ActorID is the admin impersonating the user, added as the act claim of RFC 8693.
+	// uuid.Nil leaves it out.
+	ActorID uuid.UUID
+}
+
+// GenerateSessionJWTToken creates a JWT bound to a session and returns it together with its expiry time.
+func GenerateSessionJWTToken(claims SessionClaims, secretKey string) (string, time.Time, error) {
+	expDuration := claims.TTL
+	if expDuration == 0 {
+		var err error
+		if expDuration, err = jwtExpiration(); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	expiresAt := time.Now().Add(expDuration)
+
+	mapClaims := jwt.MapClaims{
+		"user_id":    claims.UserID.String(),
+		"session_id": claims.SessionID.String(),
+		"exp":        expiresAt.Unix(),
+	}
+	if claims.OrgID != uuid.Nil {
+		mapClaims["org_id"] = claims.OrgID.String()
+	}
+	if claims.Permissions != nil {
+		mapClaims["permissions"] = claims.Permissions
+	}
+	if claims.Scope != "" {
+		mapClaims["scope"] = claims.Scope
+	}
+	if claims.ActorID != uuid.Nil {
+		mapClaims["act"] = map[string]any{"sub": claims.ActorID.String()}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, mapClaims)
+
+	signed, err := token.SignedString([]byte(secretKey))
+	return signed, expiresAt, err
+}
+
 func ValidateJWTToken(tokenString string, secretKey string) (*jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 
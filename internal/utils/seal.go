@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnsealFailed = errors.New("sealed value is corrupt or was sealed with another key")
+
+// sealedPrefix marks sealed values and the format they are in.
+const sealedPrefix = "v1:"
+
+// Sealer encrypts short secrets, such as the tokens of queued emails, with AES-256-GCM so they can be
+// stored without being usable by whoever reads the database.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a sealer from a 32 byte key.
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("sealing key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// DeriveKey derives a 32 byte key for one purpose from a secret, so a single configured secret can
+// key several uses without them sharing a key.
+func DeriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Seal encrypts plaintext. The context is authenticated but not stored, and has to be passed to
+// Open again, so a sealed value cannot be moved to another record.
+func (s *Sealer) Seal(plaintext, context string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), []byte(context))
+	return sealedPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value made by Seal with the same context.
+func (s *Sealer) Open(sealed, context string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", ErrUnsealFailed
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", ErrUnsealFailed
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(context))
+	if err != nil {
+		return "", ErrUnsealFailed
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether a value looks like it was made by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
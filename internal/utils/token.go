@@ -2,7 +2,9 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"math/big"
 )
 
 func GenerateSecureToken(length int) (string, error) {
@@ -12,3 +14,22 @@ func GenerateSecureToken(length int) (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
+
+// HashToken returns the hex encoded SHA-256 of a token, for storing tokens at rest.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumericCode returns a random code of the given number of decimal digits, for codes users type in.
+func GenerateNumericCode(digits int) (string, error) {
+	code := make([]byte, digits)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}